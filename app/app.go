@@ -3,11 +3,15 @@ package app
 import (
 	"errors"
 	"fmt"
+	"reflect"
+	"sync"
 
 	"github.com/gomodule/redigo/redis"
 	"github.com/sdjnlh/communal"
 	"github.com/sdjnlh/communal/config"
+	"github.com/sdjnlh/communal/log"
 	"github.com/spf13/viper"
+	"go.uber.org/zap"
 	"xorm.io/xorm"
 )
 
@@ -73,6 +77,10 @@ func (app *BaseApp) Register(modules ...communal.IModule) {
 	app.modules = append(app.modules, modules...)
 }
 
+func (app *BaseApp) Modules() []communal.IModule {
+	return app.modules
+}
+
 func (app *BaseApp) SetRedisConnection(conn *redis.Pool) {
 	app.Redis = conn
 }
@@ -124,6 +132,27 @@ func (app *BaseApp) Start(ctx *communal.Context) error {
 		RedisHolder: app,
 	})
 	fmt.Println(app.name + ": service redis starter registered")
+	RegisterStarter(&RpcClientStarter{
+		BaseStarter: BaseStarter{
+			name:     app.Name() + ".RPC_CLIENT",
+			priority: PriorityMiddle,
+		},
+		Namespace: app.name,
+	})
+	RegisterStarter(&ResilienceStarter{
+		BaseStarter: BaseStarter{
+			name:     app.Name() + ".RESILIENCE",
+			priority: PriorityMiddle,
+		},
+		Namespace: app.name,
+	})
+	RegisterStarter(&RegistryStarter{
+		BaseStarter: BaseStarter{
+			name:     app.Name() + ".REGISTRY",
+			priority: PriorityMiddle,
+		},
+		Namespace: app.name,
+	})
 
 	if app.isMaster && app.Mounts != nil {
 		fmt.Println("register mounts")
@@ -135,17 +164,27 @@ func (app *BaseApp) Start(ctx *communal.Context) error {
 	return nil
 }
 
+// Configurator loads the config of an app, RawConfig keeps the config read on start
 type Configurator struct {
 	BaseStarter
 	FileName     string
 	RawConfig    *viper.Viper
 	Subscription []config.Pair
+
+	reloadMu sync.Mutex
 }
 
 func (configurator *Configurator) Subscribe(key string, target interface{}) {
 	configurator.Subscription = append(configurator.Subscription, config.Pair{Key: key, Target: target})
 }
 
+// SubscribeFunc unmarshals the config under key into target on start, onChange is
+// called with target then and with a fresh value of its type on every Reload, to be
+// swapped in by onChange
+func (configurator *Configurator) SubscribeFunc(key string, target interface{}, onChange func(value interface{})) {
+	configurator.Subscription = append(configurator.Subscription, config.Pair{Key: key, Target: target, OnChange: onChange})
+}
+
 /**
 * 1, try to load config with config file name if given
 * 2, try to load config with app name
@@ -175,6 +214,49 @@ func (configurator *Configurator) Start(ctx *communal.Context) error {
 
 	ctx.Set(configurator.app.Name()+".config", configurator.RawConfig)
 
+	if err = configurator.apply(); err != nil {
+		return err
+	}
+	registerConfigurator(configurator)
+	return nil
+}
+
+// Reload reads the config file again into fresh values of the targets subscribed with
+// SubscribeFunc, handing them to their onChange once all are read. Targets subscribed
+// with Subscribe are not reloaded. Reloads are run by the package Reload, e.g. on
+// the ReloadSignals.
+func (configurator *Configurator) Reload() error {
+	configurator.reloadMu.Lock()
+	defer configurator.reloadMu.Unlock()
+
+	if configurator.RawConfig == nil {
+		return errors.New("config not loaded")
+	}
+	raw := viper.New()
+	raw.SetConfigFile(configurator.RawConfig.ConfigFileUsed())
+	if err := raw.ReadInConfig(); err != nil {
+		return err
+	}
+
+	values := make([]interface{}, len(configurator.Subscription))
+	for i, pair := range configurator.Subscription {
+		if pair.OnChange == nil {
+			continue
+		}
+		values[i] = reflect.New(reflect.TypeOf(pair.Target).Elem()).Interface()
+		if err := raw.UnmarshalKey(pair.Key, values[i]); err != nil {
+			return err
+		}
+	}
+	for i, pair := range configurator.Subscription {
+		if pair.OnChange != nil {
+			pair.OnChange(values[i])
+		}
+	}
+	return nil
+}
+
+func (configurator *Configurator) apply() error {
 	if configurator.RawConfig != nil && configurator.Subscription != nil {
 		for _, pair := range configurator.Subscription {
 			//if configurator.RawConfig == nil {
@@ -183,13 +265,46 @@ func (configurator *Configurator) Start(ctx *communal.Context) error {
 			fmt.Println("unmarshal config: ", pair.Key, configurator.RawConfig.Get(pair.Key))
 			//}
 
-			err = configurator.RawConfig.UnmarshalKey(pair.Key, pair.Target)
+			err := configurator.RawConfig.UnmarshalKey(pair.Key, pair.Target)
 			if err != nil {
 				return err
 			}
+			if pair.OnChange != nil {
+				pair.OnChange(pair.Target)
+			}
 			//fmt.Println(pair.Target)
 		}
 	}
 
 	return nil
 }
+
+var (
+	configuratorsMu sync.Mutex
+	configurators   []*Configurator
+)
+
+func registerConfigurator(configurator *Configurator) {
+	configuratorsMu.Lock()
+	configurators = append(configurators, configurator)
+	configuratorsMu.Unlock()
+}
+
+// Reload reloads the config of the started apps, every app is reloaded and the first
+// error is returned
+func Reload() error {
+	configuratorsMu.Lock()
+	cs := configurators
+	configuratorsMu.Unlock()
+
+	var first error
+	for _, configurator := range cs {
+		if err := configurator.Reload(); err != nil {
+			log.Logger.Error("fail to reload config "+configurator.RawConfig.ConfigFileUsed(), zap.Error(err))
+			if first == nil {
+				first = err
+			}
+		}
+	}
+	return first
+}
@@ -0,0 +1,43 @@
+package app
+
+import (
+	"time"
+
+	"github.com/sdjnlh/communal"
+	"github.com/sdjnlh/communal/log"
+	"github.com/sdjnlh/communal/registry"
+	"github.com/sdjnlh/communal/rpc"
+	"github.com/spf13/viper"
+)
+
+const defaultResolveTTL = 10 * time.Second
+
+// RegistryStarter sets up the default registry from the registry config section,
+// rpc services without url are then resolved with it.
+type RegistryStarter struct {
+	BaseStarter
+	Namespace string
+}
+
+func (starter *RegistryStarter) Start(ctx *communal.Context) error {
+	cfg := ctx.MustGet(starter.Namespace + ".config").(*viper.Viper)
+	if !cfg.IsSet("registry") || registry.Default() != nil {
+		return nil
+	}
+
+	reg, err := registry.FromConfig(cfg.Sub("registry"))
+	if err != nil {
+		return err
+	}
+	registry.SetDefault(reg)
+
+	ttl := cfg.GetDuration("registry.ttl")
+	if ttl <= 0 {
+		ttl = defaultResolveTTL
+	}
+	if client, ok := rpc.GetClient().(*rpc.HttpClient); ok {
+		client.SetResolver(registry.NewResolver(reg, &registry.RoundRobin{}, ttl).Url)
+	}
+	log.Logger.Info("registry enabled: " + cfg.GetString("registry.type"))
+	return nil
+}
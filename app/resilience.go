@@ -0,0 +1,27 @@
+package app
+
+import (
+	"github.com/sdjnlh/communal"
+	"github.com/sdjnlh/communal/resilience"
+	"github.com/spf13/viper"
+)
+
+// ResilienceStarter configures the policies of outbound calls from the resilience config section
+type ResilienceStarter struct {
+	BaseStarter
+	Namespace string
+}
+
+func (starter *ResilienceStarter) Start(ctx *communal.Context) error {
+	cfg := ctx.MustGet(starter.Namespace + ".config").(*viper.Viper)
+	if !cfg.IsSet("resilience") {
+		return nil
+	}
+
+	conf := resilience.Config{}
+	if err := cfg.UnmarshalKey("resilience", &conf); err != nil {
+		return err
+	}
+	resilience.Configure(conf)
+	return nil
+}
@@ -0,0 +1,121 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/sdjnlh/communal"
+	"github.com/sdjnlh/communal/log"
+	"github.com/sdjnlh/communal/registry"
+	"github.com/sdjnlh/communal/rpc"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// RpcClientStarter configures the services of the default rpc client from the rpc config section
+type RpcClientStarter struct {
+	BaseStarter
+	Namespace string
+}
+
+func (starter *RpcClientStarter) Start(ctx *communal.Context) error {
+	cfg := ctx.MustGet(starter.Namespace + ".config").(*viper.Viper)
+	if !cfg.IsSet("rpc") {
+		return nil
+	}
+
+	conf := rpc.Config{}
+	if err := cfg.UnmarshalKey("rpc", &conf); err != nil {
+		return err
+	}
+	rpc.Configure(conf)
+	return nil
+}
+
+// RpcServerStarter serves the registered modules with RpcOn over http, and
+// registers the instance when a default registry is set. Secret is required, the
+// server trusts the users of calls signed with it only.
+type RpcServerStarter struct {
+	BaseStarter
+	Service   string
+	Addr      string
+	Advertise string
+	Secret    string
+	Modules   []communal.IModule
+	Server    *rpc.Server
+}
+
+func (starter *RpcServerStarter) Start(ctx *communal.Context) error {
+	if starter.Addr == "" {
+		return errors.New("no rpc address for " + starter.name)
+	}
+	if starter.Secret == "" {
+		return errors.New("no rpc secret for " + starter.name)
+	}
+	if starter.Server == nil {
+		starter.Server = rpc.DefaultServer
+	}
+	starter.Server.SetSecret(starter.Secret)
+
+	for _, im := range starter.Modules {
+		holder, ok := im.(interface{ GetModule() *communal.Module })
+		if !ok {
+			continue
+		}
+		if module := holder.GetModule(); module.RpcOn {
+			starter.Server.Serve(module)
+			log.Logger.Info("serve rpc module " + module.Name)
+		}
+	}
+
+	listener, err := net.Listen("tcp", starter.Addr)
+	if err != nil {
+		return err
+	}
+	server := &http.Server{Handler: starter.Server}
+	go func() {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			log.Logger.Error("rpc server stopped", zap.Error(err))
+		}
+	}()
+	RegisterStopper(NewStopFunc(starter.name, func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		return server.Shutdown(ctx)
+	}))
+
+	return starter.register(listener.Addr().String())
+}
+
+func (starter *RpcServerStarter) register(listenAddr string) error {
+	reg := registry.Default()
+	if reg == nil {
+		return nil
+	}
+
+	address := starter.Advertise
+	if address == "" {
+		host, _ := os.Hostname()
+		_, port, _ := net.SplitHostPort(listenAddr)
+		address = net.JoinHostPort(host, port)
+	}
+	instance := &registry.Instance{
+		Id:      starter.Service + "-" + address,
+		Service: starter.Service,
+		Address: address,
+		Healthy: true,
+	}
+	if err := reg.Register(context.Background(), instance); err != nil {
+		return err
+	}
+	log.Logger.Info("rpc instance registered", zap.String("id", instance.Id))
+
+	RegisterStopper(NewStopFunc(starter.name+".DEREGISTER", func() error {
+		return reg.Deregister(context.Background(), instance)
+	}))
+	return nil
+}
@@ -6,6 +6,14 @@ import (
 
 type Service struct {
 	BaseApp
+
+	// RpcAddr is the listen address of the rpc server, started when Rpc is set
+	RpcAddr string
+	// RpcAdvertise is the address registered for discovery, RpcAddr on this host by default
+	RpcAdvertise string
+	// RpcSecret is shared with the clients of the rpc server, which sign their calls
+	// with it, see rpc.Server.SetSecret
+	RpcSecret string
 }
 
 func NewService(name string) *Service {
@@ -26,5 +34,19 @@ func (app *Service) Start(ctx *communal.Context) error {
 		return err
 	}
 
+	if app.Rpc {
+		RegisterStarter(&RpcServerStarter{
+			BaseStarter: BaseStarter{
+				name:     app.name + ".RPC_SERVER",
+				priority: PriorityLow,
+			},
+			Service:   app.name,
+			Addr:      app.RpcAddr,
+			Advertise: app.RpcAdvertise,
+			Secret:    app.RpcSecret,
+			Modules:   app.Modules(),
+		})
+	}
+
 	return nil
 }
@@ -5,8 +5,10 @@ import (
 	"reflect"
 	"strconv"
 	"sync"
+	"time"
 
 	"github.com/sdjnlh/communal"
+	"github.com/sdjnlh/communal/metrics"
 )
 
 const (
@@ -96,6 +98,8 @@ func (base *BaseStarter) Start(ctx *communal.Context) error {
 
 var (
 	controller = &StartController{}
+
+	starterDuration = metrics.NewGauge("app_starter_duration_seconds", "Time the starters took to start.", "starter")
 )
 
 func RegisterStarter(starter Starter) {
@@ -103,11 +107,20 @@ func RegisterStarter(starter Starter) {
 	controller.register(starter)
 }
 
+// Start runs the registered starters by priority. When one fails, the stoppers of the
+// started ones are run, see Stop and StopSignals. Configs are reloaded on the
+// ReloadSignals.
 func Start() error {
 	controller.ctx = communal.Context{}
 	err := controller.startNext()
 	controller = nil
-	return err
+	if err != nil {
+		_ = Stop()
+		return err
+	}
+	stopOnSignal(StopSignals)
+	reloadOnSignal(ReloadSignals)
+	return nil
 }
 
 type StartListener func(ctx communal.Context) error
@@ -119,7 +132,9 @@ func OnStarted(starterName string, listener StartListener) {
 	controller.listenersMap[starterName] = append(controller.listenersMap[starterName], listener)
 }
 
-func init() {}
+func init() {
+	metrics.Register(starterDuration)
+}
 
 type StartController struct {
 	ctx           communal.Context
@@ -204,7 +219,9 @@ func (controller *StartController) startStarter(starter Starter) error {
 	if starter.Started() {
 		panic("starter " + starter.Name() + " has been started")
 	}
+	begin := time.Now()
 	err := starter.Start(&controller.ctx)
+	starterDuration.Set(time.Since(begin).Seconds(), starter.Name())
 	if err != nil {
 		return err
 	} else {
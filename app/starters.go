@@ -8,6 +8,7 @@ import (
 	"github.com/gomodule/redigo/redis"
 	"github.com/sdjnlh/communal"
 	"github.com/sdjnlh/communal/log"
+	"github.com/sdjnlh/communal/metrics"
 	"github.com/spf13/viper"
 	"go.uber.org/zap"
 	"xorm.io/xorm"
@@ -57,6 +58,7 @@ func (starter *DbStarter) Start(ctx *communal.Context) error {
 				return err
 			}
 			ctx.Set("db."+dbn, conn)
+			metrics.Register(metrics.DB(dbn, conn))
 
 			if len(dbListeners) == 0 || len(dbListeners[dbn]) == 0 {
 				continue
@@ -96,6 +98,7 @@ func (starter *RedisStarter) Start(ctx *communal.Context) error {
 			return err
 		}
 		ctx.Set("redis."+dbn, conn)
+		metrics.Register(metrics.Redis(dbn, conn))
 	} else {
 		conn = ctx.Get("redis." + dbn).(*redis.Pool)
 	}
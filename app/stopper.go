@@ -0,0 +1,106 @@
+package app
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/sdjnlh/communal/log"
+	"go.uber.org/zap"
+)
+
+// Stopper releases what a starter acquired, e.g. deregisters a service instance
+type Stopper interface {
+	Name() string
+	Stop() error
+}
+
+type StopFunc struct {
+	name string
+	stop func() error
+}
+
+func NewStopFunc(name string, stop func() error) *StopFunc {
+	return &StopFunc{name: name, stop: stop}
+}
+
+func (sf *StopFunc) Name() string {
+	return sf.name
+}
+
+func (sf *StopFunc) Stop() error {
+	return sf.stop()
+}
+
+var (
+	stopMu   sync.Mutex
+	stoppers []Stopper
+
+	// StopSignals make the process run Stop and exit once started, set it to nil
+	// before Start to handle signals and call Stop yourself
+	StopSignals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+
+	// ReloadSignals make the process run Reload once started, set it to nil before
+	// Start to reload the config otherwise
+	ReloadSignals = []os.Signal{syscall.SIGHUP}
+)
+
+func RegisterStopper(stopper Stopper) {
+	stopMu.Lock()
+	stoppers = append(stoppers, stopper)
+	stopMu.Unlock()
+}
+
+// Stop runs the registered stoppers in reverse order of registration, every
+// stopper runs and the first error is returned.
+func Stop() error {
+	stopMu.Lock()
+	ss := stoppers
+	stoppers = nil
+	stopMu.Unlock()
+
+	var first error
+	for i := len(ss) - 1; i >= 0; i-- {
+		if err := ss[i].Stop(); err != nil {
+			log.Logger.Error("fail to stop "+ss[i].Name(), zap.Error(err))
+			if first == nil {
+				first = err
+			}
+		}
+	}
+	return first
+}
+
+// stopOnSignal runs Stop and exits on the first of signals
+func stopOnSignal(signals []os.Signal) {
+	if len(signals) == 0 {
+		return
+	}
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, signals...)
+	go func() {
+		sig := <-ch
+		signal.Stop(ch)
+		log.Logger.Info("stopping on signal " + sig.String())
+		if err := Stop(); err != nil {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}()
+}
+
+// reloadOnSignal runs Reload on every one of signals
+func reloadOnSignal(signals []os.Signal) {
+	if len(signals) == 0 {
+		return
+	}
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, signals...)
+	go func() {
+		for sig := range ch {
+			log.Logger.Info("reloading config on signal " + sig.String())
+			_ = Reload()
+		}
+	}()
+}
@@ -0,0 +1,184 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/sdjnlh/communal"
+	"github.com/sdjnlh/communal/errors"
+	"github.com/sdjnlh/communal/log"
+)
+
+// Doer sends the requests of a client, *http.Client is the default one
+type Doer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// Auth authenticates the requests of a client
+type Auth interface {
+	Apply(req *http.Request) error
+}
+
+type AuthFunc func(req *http.Request) error
+
+func (fn AuthFunc) Apply(req *http.Request) error {
+	return fn(req)
+}
+
+// Bearer authenticates requests with an Authorization: Bearer header
+func Bearer(token string) Auth {
+	return Header("Authorization", "Bearer "+token)
+}
+
+// Header authenticates requests with a fixed header, e.g. an api key
+func Header(name string, value string) Auth {
+	return AuthFunc(func(req *http.Request) error {
+		req.Header.Set(name, value)
+		return nil
+	})
+}
+
+// Client calls the api endpoints of a service, answers are decoded into a
+// communal.IResult and failures are returned as BizErrors.
+type Client struct {
+	BaseUrl string
+	Auth    Auth
+	Doer    Doer
+}
+
+type Option func(client *Client)
+
+func WithAuth(auth Auth) Option {
+	return func(client *Client) {
+		client.Auth = auth
+	}
+}
+
+func WithDoer(doer Doer) Option {
+	return func(client *Client) {
+		client.Doer = doer
+	}
+}
+
+// WithTransport sends requests with an http.Client over transport
+func WithTransport(transport http.RoundTripper) Option {
+	return func(client *Client) {
+		client.Doer = &http.Client{Transport: transport}
+	}
+}
+
+func New(baseUrl string, options ...Option) *Client {
+	client := &Client{BaseUrl: strings.TrimSuffix(baseUrl, "/"), Doer: http.DefaultClient}
+	for _, option := range options {
+		option(client)
+	}
+	return client
+}
+
+// Call sends body, when not nil, as JSON to path and decodes the answer into result.
+// A result that is not ok is returned as its error.
+func (client *Client) Call(ctx context.Context, method string, path string, query url.Values, body interface{}, result communal.IResult) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return errors.InvalidParams().AddError(errors.InvalidField("body", "", err.Error()))
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	u := client.BaseUrl + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequest(method, u, reader)
+	if err != nil {
+		return errors.Wrap(err, errors.Common_ServerError)
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", "application/json")
+	if requestId := log.RequestIdFrom(ctx); requestId != "" {
+		req.Header.Set(log.RequestIdHeader, requestId)
+	}
+	if reader != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if client.Auth != nil {
+		if err = client.Auth.Apply(req); err != nil {
+			return &errors.SimpleBizError{Code: errors.Common_Unauthorized, Msg: err.Error()}
+		}
+	}
+
+	resp, err := client.Doer.Do(req)
+	if err != nil {
+		return errors.Wrap(err, errors.Common_RPCError)
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return errors.Wrap(err, errors.Common_RPCError)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return decodeError(resp.StatusCode, data)
+	}
+
+	if result == nil || len(data) == 0 {
+		return nil
+	}
+	result.SetError(&errors.SimpleBizError{})
+	if err = json.Unmarshal(data, result); err != nil {
+		return errors.Wrap(err, errors.Common_RPCError)
+	}
+	if !result.IsOk() {
+		if be := result.Err(); be != nil && be.GetCode() != "" {
+			return be
+		}
+		return errors.ServerError()
+	}
+	return nil
+}
+
+// decodeError reads the error of a failed answer, which is either a BizError or a
+// Result carrying it, falling back to the code of the status.
+func decodeError(status int, data []byte) error {
+	result := &struct {
+		Err *errors.SimpleBizError `json:"err"`
+	}{}
+	if json.Unmarshal(data, result) == nil && result.Err != nil && result.Err.Code != "" {
+		return result.Err
+	}
+	be := &errors.SimpleBizError{}
+	if json.Unmarshal(data, be) == nil && be.Code != "" {
+		return be
+	}
+
+	switch status {
+	case http.StatusBadRequest:
+		return errors.InvalidParams()
+	case http.StatusUnauthorized:
+		return errors.Unauthorized()
+	case http.StatusForbidden:
+		return errors.Forbidden()
+	case http.StatusNotFound:
+		return errors.NotFound()
+	case http.StatusConflict:
+		return errors.Conflict()
+	case http.StatusPreconditionFailed:
+		return errors.PreconditionFailed()
+	case http.StatusTooManyRequests:
+		return errors.TooManyRequests()
+	}
+	return errors.ServerErrorWithMsg(fmt.Sprintf("%d %s", status, http.StatusText(status)))
+}
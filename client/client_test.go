@@ -0,0 +1,99 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/sdjnlh/communal"
+	"github.com/sdjnlh/communal/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+type Article struct {
+	Id    int64  `json:"id,string"`
+	Title string `json:"title"`
+}
+
+type ArticleFilter struct {
+	communal.Page
+	Title string    `form:"title"`
+	Tags  []string  `form:"tag"`
+	Since time.Time `form:"since"`
+	Skip  string    `form:"-"`
+}
+
+func TestClient_Call(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/articles/1":
+			assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+			_ = json.NewEncoder(w).Encode(&communal.Result{Ok: true, Data: &Article{Id: 1, Title: "hello"}})
+		case "/articles":
+			assert.Equal(t, "hello", r.URL.Query().Get("title"))
+			_ = json.NewEncoder(w).Encode(&communal.FilterResult{
+				Result: communal.Result{Ok: true, Data: []*Article{{Id: 1}, {Id: 2}}},
+				Page:   &communal.Page{P: 1, Ps: 10, Cnt: 2},
+			})
+		case "/articles/2":
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(errors.InvalidParams().AddError(errors.InvalidField("title", errors.FIELD_BAD_FORMAT, "")))
+		case "/articles/3":
+			w.WriteHeader(http.StatusInternalServerError)
+			_ = json.NewEncoder(w).Encode(&communal.Result{Error: errors.NotFound()})
+		default:
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+	defer server.Close()
+
+	c := New(server.URL+"/", WithAuth(Bearer("token")))
+	article := &Article{}
+	assert.NoError(t, c.Call(context.Background(), http.MethodGet, Path("/articles/:id", 1), nil, nil, &communal.Result{Data: article}))
+	assert.Equal(t, "hello", article.Title)
+
+	var articles []*Article
+	result := &communal.FilterResult{Result: communal.Result{Data: &articles}}
+	assert.NoError(t, c.Call(context.Background(), http.MethodGet, "/articles", Query(&ArticleFilter{Title: "hello"}), nil, result))
+	assert.Len(t, articles, 2)
+	assert.Equal(t, int64(2), result.Page.Cnt)
+
+	err := c.Call(context.Background(), http.MethodPut, "/articles/2", nil, article, &communal.Result{})
+	be, ok := err.(errors.BizError)
+	assert.True(t, ok)
+	assert.Equal(t, errors.Common_InvalidParams, be.GetCode())
+	assert.Equal(t, "title", (*be.GetErrors())[0].(*errors.FieldError).Name)
+
+	err = c.Call(context.Background(), http.MethodGet, "/articles/3", nil, nil, &communal.Result{})
+	assert.Equal(t, errors.Common_NotFound, err.(errors.BizError).GetCode())
+
+	err = c.Call(context.Background(), http.MethodDelete, "/articles/4", nil, nil, &communal.Result{})
+	assert.Equal(t, errors.Common_Forbidden, err.(errors.BizError).GetCode())
+}
+
+func TestQuery(t *testing.T) {
+	since := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	values := Query(&ArticleFilter{Page: communal.Page{P: 2}, Title: "a b", Tags: []string{"x", "y"}, Since: since, Skip: "skip"})
+	assert.Equal(t, url.Values{
+		"p":     {"2"},
+		"title": {"a b"},
+		"tag":   {"x", "y"},
+		"since": {"2020-01-02T03:04:05Z"},
+	}, values)
+
+	values = StatsQuery(nil, &communal.StatsQuery{
+		Aggregates: []communal.Aggregate{{Func: "count"}, {Func: "sum", Column: "amount"}},
+		GroupBy:    []string{"status", "type"},
+		Bucket:     communal.BucketDay,
+	})
+	assert.Equal(t, "count,sum:amount", values.Get("agg"))
+	assert.Equal(t, "status,type", values.Get("group"))
+	assert.Equal(t, "day", values.Get("bucket"))
+
+	assert.Equal(t, "/articles/1/history", Path("/articles/:id/history", int64(1)))
+}
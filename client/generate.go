@@ -0,0 +1,297 @@
+package client
+
+import (
+	"bytes"
+	"errors"
+	"go/format"
+	"io"
+	"path"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode"
+)
+
+// kinds of operations a client can be generated for
+const (
+	KindGet     = "Get"
+	KindCreate  = "Create"
+	KindUpdate  = "Update"
+	KindPatch   = "Patch"
+	KindDelete  = "Delete"
+	KindList    = "List"
+	KindStats   = "Stats"
+	KindHistory = "History"
+)
+
+// Spec describes the client package to generate, e.g. as read from the
+// endpoint builders by web.ClientSpec
+type Spec struct {
+	Package  string
+	Services []*Service
+}
+
+// Service is generated as {Name}Client, with a method per operation
+type Service struct {
+	Name       string
+	Operations []*Operation
+}
+
+// Operation is one endpoint, Domain is the type of the entity, or of the array for
+// List, and Filter the type of the filter of List and Stats. Types which can not be
+// referred to from another package are answered as raw JSON.
+type Operation struct {
+	Name   string
+	Kind   string
+	Method string
+	Path   string
+	Domain reflect.Type
+	Filter reflect.Type
+}
+
+type operationData struct {
+	*Operation
+	Client string
+	Type   string
+	Filter string
+}
+
+type serviceData struct {
+	Name       string
+	Client     string
+	Operations []*operationData
+}
+
+type packageData struct {
+	Package  string
+	Imports  []string
+	Services []*serviceData
+}
+
+// the receivers, params and locals of the template are prefixed with p, not to shadow
+// the packages of domain types, commonly named domain, data or model
+var clientTemplate = template.Must(template.New("client").Parse(`// Code generated by communal. DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+{{- range .Imports}}
+	{{.}}
+{{- end}}
+)
+{{range .Services}}
+// {{.Client}} calls the {{.Name}} api
+type {{.Client}} struct {
+	*client.Client
+}
+
+func New{{.Client}}(pClient *client.Client) *{{.Client}} {
+	return &{{.Client}}{Client: pClient}
+}
+{{range .Operations}}{{template "operation" .}}{{end}}{{end}}
+{{- define "operation"}}
+{{- if eq .Kind "Get"}}
+func (pc *{{.Client}}) {{.Name}}(pCtx context.Context, pId int64) (*{{.Type}}, error) {
+	pData := new({{.Type}})
+	pErr := pc.Call(pCtx, "{{.Method}}", client.Path("{{.Path}}", pId), nil, nil, &communal.Result{Data: pData})
+	return pData, pErr
+}
+{{else if eq .Kind "Create"}}
+func (pc *{{.Client}}) {{.Name}}(pCtx context.Context, pDomain *{{.Type}}) (*{{.Type}}, error) {
+	pErr := pc.Call(pCtx, "{{.Method}}", client.Path("{{.Path}}"), nil, pDomain, &communal.Result{Data: pDomain})
+	return pDomain, pErr
+}
+{{else if eq .Kind "Update"}}
+func (pc *{{.Client}}) {{.Name}}(pCtx context.Context, pId int64, pDomain *{{.Type}}) error {
+	return pc.Call(pCtx, "{{.Method}}", client.Path("{{.Path}}", pId), nil, pDomain, &communal.Result{})
+}
+{{else if eq .Kind "Patch"}}
+func (pc *{{.Client}}) {{.Name}}(pCtx context.Context, pId int64, pPatch interface{}) (*{{.Type}}, error) {
+	pData := new({{.Type}})
+	pErr := pc.Call(pCtx, "{{.Method}}", client.Path("{{.Path}}", pId), nil, pPatch, &communal.Result{Data: pData})
+	return pData, pErr
+}
+{{else if eq .Kind "Delete"}}
+func (pc *{{.Client}}) {{.Name}}(pCtx context.Context, pId int64) error {
+	return pc.Call(pCtx, "{{.Method}}", client.Path("{{.Path}}", pId), nil, nil, &communal.Result{})
+}
+{{else if eq .Kind "List"}}
+func (pc *{{.Client}}) {{.Name}}(pCtx context.Context, pFilter {{.Filter}}) ({{.Type}}, *communal.Page, error) {
+	pData := new({{.Type}})
+	pResult := &communal.FilterResult{Result: communal.Result{Data: pData}}
+	pErr := pc.Call(pCtx, "{{.Method}}", client.Path("{{.Path}}"), client.Query(pFilter), nil, pResult)
+	return *pData, pResult.Page, pErr
+}
+{{else if eq .Kind "Stats"}}
+func (pc *{{.Client}}) {{.Name}}(pCtx context.Context, pFilter {{.Filter}}, pQuery *communal.StatsQuery) (*communal.Stats, error) {
+	pData := &communal.Stats{}
+	pErr := pc.Call(pCtx, "{{.Method}}", client.Path("{{.Path}}"), client.StatsQuery(pFilter, pQuery), nil, &communal.Result{Data: pData})
+	return pData, pErr
+}
+{{else if eq .Kind "History"}}
+func (pc *{{.Client}}) {{.Name}}(pCtx context.Context, pId int64, pPage *communal.Page) ([]*communal.History, *communal.Page, error) {
+	var pData []*communal.History
+	pResult := &communal.FilterResult{Result: communal.Result{Data: &pData}}
+	pErr := pc.Call(pCtx, "{{.Method}}", client.Path("{{.Path}}", pId), client.Query(pPage), nil, pResult)
+	return pData, pResult.Page, pErr
+}
+{{end}}
+{{- end}}`))
+
+// typed tells the kinds of operations whose methods refer to the domain type
+var typed = map[string]bool{KindGet: true, KindCreate: true, KindUpdate: true, KindPatch: true, KindList: true}
+
+// Generate writes the gofmt-ed source of a client package for spec
+func Generate(w io.Writer, spec *Spec) error {
+	imports := &importSet{aliases: map[string]string{}, used: map[string]bool{}}
+	imports.add("context")
+	imports.add("github.com/sdjnlh/communal")
+	imports.add("github.com/sdjnlh/communal/client")
+
+	data := &packageData{Package: spec.Package}
+	for _, service := range spec.Services {
+		if len(service.Operations) == 0 {
+			continue
+		}
+		sd := &serviceData{Name: service.Name, Client: exportedName(service.Name) + "Client"}
+		for _, op := range service.Operations {
+			od := &operationData{Operation: op, Client: sd.Client}
+			if op.Domain != nil {
+				od.Type = imports.typeName(elem(op.Domain))
+			}
+			if op.Filter != nil {
+				od.Filter = imports.typeName(op.Filter)
+			}
+			if od.Type == "" && typed[op.Kind] {
+				od.Type = "json.RawMessage"
+				if op.Kind == KindList {
+					od.Type = "[]json.RawMessage"
+				}
+				imports.add("encoding/json")
+			}
+			if od.Filter == "" {
+				od.Filter = "interface{}"
+			}
+			sd.Operations = append(sd.Operations, od)
+		}
+		data.Services = append(data.Services, sd)
+	}
+	if len(data.Services) == 0 {
+		return errors.New("no operation to generate a client for")
+	}
+	data.Imports = imports.list()
+
+	buf := &bytes.Buffer{}
+	if err := clientTemplate.Execute(buf, data); err != nil {
+		return err
+	}
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(src)
+	return err
+}
+
+func elem(t reflect.Type) reflect.Type {
+	if t.Kind() == reflect.Ptr {
+		return t.Elem()
+	}
+	return t
+}
+
+func exportedName(name string) string {
+	var sb strings.Builder
+	upper := true
+	for _, r := range name {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = true
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+// importSet names the packages of referred types, aliasing packages with the same name
+type importSet struct {
+	aliases map[string]string
+	used    map[string]bool
+}
+
+func (set *importSet) add(pkgPath string) string {
+	if alias, ok := set.aliases[pkgPath]; ok {
+		return alias
+	}
+	alias := path.Base(pkgPath)
+	for i := 2; set.used[alias]; i++ {
+		alias = path.Base(pkgPath) + strconv.Itoa(i)
+	}
+	set.aliases[pkgPath] = alias
+	set.used[alias] = true
+	return alias
+}
+
+func (set *importSet) list() []string {
+	var paths []string
+	for pkgPath := range set.aliases {
+		paths = append(paths, pkgPath)
+	}
+	sort.Strings(paths)
+
+	var imports []string
+	for _, pkgPath := range paths {
+		if alias := set.aliases[pkgPath]; alias != path.Base(pkgPath) {
+			imports = append(imports, alias+" "+strconv.Quote(pkgPath))
+		} else {
+			imports = append(imports, strconv.Quote(pkgPath))
+		}
+	}
+	return imports
+}
+
+// typeName answers how t is referred to from the generated package, or "" when it can not be
+func (set *importSet) typeName(t reflect.Type) string {
+	if !referable(t) {
+		return ""
+	}
+	if t.Name() != "" {
+		if t.PkgPath() == "" {
+			return t.Name()
+		}
+		return set.add(t.PkgPath()) + "." + t.Name()
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		return "*" + set.typeName(t.Elem())
+	case reflect.Slice:
+		return "[]" + set.typeName(t.Elem())
+	case reflect.Map:
+		return "map[" + set.typeName(t.Key()) + "]" + set.typeName(t.Elem())
+	}
+	return "interface{}"
+}
+
+// referable tells whether t is exported from an importable package, or built of such types
+func referable(t reflect.Type) bool {
+	if t.Name() != "" {
+		return t.PkgPath() == "" || t.PkgPath() != "main" && unicode.IsUpper([]rune(t.Name())[0])
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Slice:
+		return referable(t.Elem())
+	case reflect.Map:
+		return referable(t.Key()) && referable(t.Elem())
+	case reflect.Interface:
+		return t.NumMethod() == 0
+	}
+	return false
+}
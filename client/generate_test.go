@@ -0,0 +1,46 @@
+package client
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerate(t *testing.T) {
+	type local struct{}
+	spec := &Spec{Package: "articleclient", Services: []*Service{{
+		Name: "article_tag",
+		Operations: []*Operation{
+			{Name: "Get", Kind: KindGet, Method: "GET", Path: "/tags/:id", Domain: reflect.TypeOf(&Article{})},
+			{Name: "List", Kind: KindList, Method: "GET", Path: "/tags", Domain: reflect.TypeOf(&[]*Article{}), Filter: reflect.TypeOf(&ArticleFilter{})},
+			{Name: "Create", Kind: KindCreate, Method: "POST", Path: "/tags", Domain: reflect.TypeOf(&local{})},
+			{Name: "Delete", Kind: KindDelete, Method: "DELETE", Path: "/tags/:id"},
+		},
+	}}}
+
+	buf := &bytes.Buffer{}
+	assert.NoError(t, Generate(buf, spec))
+	src := buf.String()
+	assert.Contains(t, src, `"encoding/json"`)
+	assert.Contains(t, src, "type ArticleTagClient struct")
+	assert.Contains(t, src, "func (pc *ArticleTagClient) Get(pCtx context.Context, pId int64) (*client.Article, error)")
+	assert.Contains(t, src, "func (pc *ArticleTagClient) List(pCtx context.Context, pFilter *client.ArticleFilter) ([]*client.Article, *communal.Page, error)")
+	assert.Contains(t, src, "func (pc *ArticleTagClient) Create(pCtx context.Context, pDomain *json.RawMessage) (*json.RawMessage, error)")
+	assert.Contains(t, src, `pc.Call(pCtx, "DELETE", client.Path("/tags/:id", pId), nil, nil, &communal.Result{})`)
+
+	assert.Error(t, Generate(buf, &Spec{Package: "empty"}))
+}
+
+func TestImportSet(t *testing.T) {
+	set := &importSet{aliases: map[string]string{}, used: map[string]bool{}}
+	assert.Equal(t, "model", set.add("a.com/model"))
+	assert.Equal(t, "model2", set.add("b.com/model"))
+	assert.Equal(t, "model", set.add("a.com/model"))
+	assert.Equal(t, []string{`"a.com/model"`, `model2 "b.com/model"`}, set.list())
+	assert.Equal(t, "map[string][]*client.Article", func() string {
+		type Article struct{}
+		return set.typeName(reflect.TypeOf(map[string][]*Article{}))
+	}())
+}
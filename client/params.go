@@ -0,0 +1,125 @@
+package client
+
+import (
+	"encoding"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/sdjnlh/communal"
+)
+
+// Path fills the :name params of pattern in order, e.g. Path("/articles/:id", 1)
+func Path(pattern string, params ...interface{}) string {
+	segments := strings.Split(pattern, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") && len(params) > 0 {
+			segments[i] = url.PathEscape(fmt.Sprint(params[0]))
+			params = params[1:]
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// Query encodes the form tagged fields of a filter, embedded structs included,
+// zero values are left out.
+func Query(filter interface{}) url.Values {
+	values := url.Values{}
+	if filter != nil {
+		encodeQuery(values, reflect.ValueOf(filter))
+	}
+	return values
+}
+
+// StatsQuery encodes a filter with the agg, group and bucket params of a stats query
+func StatsQuery(filter interface{}, query *communal.StatsQuery) url.Values {
+	values := Query(filter)
+	if query == nil {
+		return values
+	}
+
+	var aggs []string
+	for _, agg := range query.Aggregates {
+		if agg.Column != "" {
+			aggs = append(aggs, agg.Func+":"+agg.Column)
+		} else {
+			aggs = append(aggs, agg.Func)
+		}
+	}
+	if len(aggs) > 0 {
+		values.Set("agg", strings.Join(aggs, ","))
+	}
+	if len(query.GroupBy) > 0 {
+		values.Set("group", strings.Join(query.GroupBy, ","))
+	}
+	if query.Bucket != "" {
+		values.Set("bucket", query.Bucket)
+	}
+	return values
+}
+
+func encodeQuery(values url.Values, v reflect.Value) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return
+	}
+
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := strings.Split(field.Tag.Get("form"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			if field.Anonymous {
+				encodeQuery(values, v.Field(i))
+			}
+			continue
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+
+		fv := v.Field(i)
+		if fv.Kind() == reflect.Slice || fv.Kind() == reflect.Array {
+			for j := 0; j < fv.Len(); j++ {
+				if str, ok := queryValue(fv.Index(j)); ok {
+					values.Add(name, str)
+				}
+			}
+			continue
+		}
+		if str, ok := queryValue(fv); ok {
+			values.Set(name, str)
+		}
+	}
+}
+
+func queryValue(v reflect.Value) (string, bool) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return "", false
+		}
+		v = v.Elem()
+	}
+	if v.IsZero() {
+		return "", false
+	}
+
+	switch value := v.Interface().(type) {
+	case time.Time:
+		return value.Format(time.RFC3339), true
+	case encoding.TextMarshaler:
+		text, err := value.MarshalText()
+		return string(text), err == nil
+	}
+	return fmt.Sprint(v.Interface()), true
+}
@@ -14,9 +14,13 @@ const (
 	PREFIX_DB              = "db"
 )
 
+// Pair subscribes Target to the config under Key, which is unmarshalled into Target on
+// start. OnChange, when set, is called with Target then, and on every reload with a
+// fresh value of the type of Target, Target itself is left as started.
 type Pair struct {
-	Key    string
-	Target interface{}
+	Key      string
+	Target   interface{}
+	OnChange func(value interface{})
 }
 
 var (
@@ -0,0 +1,64 @@
+package communal
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sdjnlh/communal/log"
+)
+
+// RequestIdKey is the key of the request id in gin contexts
+const RequestIdKey = log.RequestIdKey
+
+type uidKey struct{}
+
+type orgIdKey struct{}
+
+// WithUser stores the current user in a plain context, UidFrom and OrgIdFrom read it
+// from those, and from gin contexts under the keys the state builders set.
+func WithUser(ctx context.Context, uid int64, orgId int64) context.Context {
+	ctx = context.WithValue(ctx, uidKey{}, uid)
+	return context.WithValue(ctx, orgIdKey{}, orgId)
+}
+
+// UidFrom reads the current user id from a gin or plain context, 0 if absent.
+func UidFrom(ctx context.Context) int64 {
+	return int64Value(ctx, UserIdKey, uidKey{})
+}
+
+// OrgIdFrom reads the current user's organization id from a gin or plain context, 0 if absent.
+func OrgIdFrom(ctx context.Context) int64 {
+	return int64Value(ctx, UserOrgIdKey, orgIdKey{})
+}
+
+// RequestIdFrom reads the request id from a gin or plain context, "" if absent.
+func RequestIdFrom(ctx context.Context) string {
+	return log.RequestIdFrom(ctx)
+}
+
+// int64Value reads ginKey from gin contexts and key from plain ones
+func int64Value(ctx context.Context, ginKey string, key interface{}) int64 {
+	if ctx == nil {
+		return 0
+	}
+
+	var value interface{}
+	if c, ok := ctx.(*gin.Context); ok {
+		value, _ = c.Get(ginKey)
+	} else {
+		value = ctx.Value(key)
+	}
+	switch v := value.(type) {
+	case int64:
+		return v
+	case int:
+		return int64(v)
+	case float64:
+		return int64(v)
+	case string:
+		i, _ := strconv.ParseInt(v, 10, 64)
+		return i
+	}
+	return 0
+}
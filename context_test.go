@@ -0,0 +1,28 @@
+package communal
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sdjnlh/communal/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUserContext(t *testing.T) {
+	ctx := log.WithRequestId(WithUser(context.Background(), 42, 7), "r1")
+	assert.Equal(t, int64(42), UidFrom(ctx))
+	assert.Equal(t, int64(7), OrgIdFrom(ctx))
+	assert.Equal(t, "r1", RequestIdFrom(ctx))
+
+	// plain string keys set by other packages are not taken for the user
+	other := context.WithValue(context.Background(), UserIdKey, int64(9))
+	assert.Equal(t, int64(0), UidFrom(other))
+
+	c := &gin.Context{}
+	c.Set(UserIdKey, int64(5))
+	c.Set(RequestIdKey, "r2")
+	assert.Equal(t, int64(5), UidFrom(c))
+	assert.Equal(t, int64(0), OrgIdFrom(c))
+	assert.Equal(t, "r2", RequestIdFrom(c))
+}
@@ -107,6 +107,8 @@ type Result struct {
 	Data  interface{}            `json:"data,omitempty"`
 	User  interface{}            `json:"user,omitempty"`
 	Extra map[string]interface{} `json:"extra,omitempty"`
+	// RequestId is set on failures, to find the logs of the request
+	RequestId string `json:"requestId,omitempty"`
 }
 
 func (r *Result) IsOk() bool {
@@ -13,6 +13,9 @@ type SimpleBizError struct {
 	Code   string      `json:"code,omitempty"`
 	Msg    string      `json:"msg,omitempty"`
 	Errors *[]BizError `json:"errors,omitempty"`
+	// cause and stack are for the logs, they are never marshalled
+	cause error
+	stack []uintptr
 }
 
 type FieldError struct {
@@ -25,9 +28,17 @@ func (err *SimpleBizError) Error() string {
 		return ""
 	}
 
+	msg := err.Msg
+	if err.cause != nil {
+		if msg == "" {
+			msg = err.Code
+		}
+		msg += ": " + err.cause.Error()
+	}
+
 	if err.Errors != nil {
 		sb := bytes.Buffer{}
-		sb.WriteString(err.Msg)
+		sb.WriteString(msg)
 
 		for _, fe := range *err.Errors {
 			sb.WriteByte('\n')
@@ -36,7 +47,7 @@ func (err *SimpleBizError) Error() string {
 
 		return sb.String()
 	} else {
-		return err.Msg
+		return msg
 	}
 }
 
@@ -85,6 +96,10 @@ const (
 	FIELD_BAD_FORMAT     = "BAD_FORMAT"
 	Common_Unauthorized  = "c.UNAUTHORIZED"
 	Common_Forbidden     = "c.FORBIDDEN"
+
+	Common_PreconditionFailed = "c.PRECONDITION_FAILED"
+	Common_Conflict           = "c.CONFLICT"
+	Common_TooManyRequests    = "c.TOO_MANY_REQUESTS"
 	//Common_InvalidField  = "c.INVALID_FIELD"
 )
 
@@ -112,6 +127,18 @@ func Forbidden() *SimpleBizError {
 	return &SimpleBizError{Code: Common_Forbidden}
 }
 
+func PreconditionFailed() *SimpleBizError {
+	return &SimpleBizError{Code: Common_PreconditionFailed}
+}
+
+func Conflict() *SimpleBizError {
+	return &SimpleBizError{Code: Common_Conflict}
+}
+
+func TooManyRequests() *SimpleBizError {
+	return &SimpleBizError{Code: Common_TooManyRequests}
+}
+
 func NotFoundWithMsg(msg string) *SimpleBizError {
 	return &SimpleBizError{Code: Common_NotFound, Msg: msg}
 }
@@ -1,8 +1,10 @@
 package errors
 
 import (
-	"github.com/stretchr/testify/assert"
+	"encoding/json"
 	"testing"
+
+	"github.com/stretchr/testify/assert"
 )
 
 func TestAddError(t *testing.T) {
@@ -12,3 +14,19 @@ func TestAddError(t *testing.T) {
 	err.AddError(InvalidParams())
 	assert.Equal(t, true, err.HasError(), "")
 }
+
+func TestUnmarshalJSON(t *testing.T) {
+	err := InvalidParams()
+	err.AddError(InvalidField("id", "empty", "empty id"))
+	bts, e := json.Marshal(err)
+	assert.NoError(t, e)
+
+	var decoded BizError = &SimpleBizError{}
+	assert.NoError(t, json.Unmarshal(bts, decoded))
+	assert.Equal(t, Common_InvalidParams, decoded.GetCode())
+	assert.Len(t, *decoded.GetErrors(), 1)
+	fe, ok := (*decoded.GetErrors())[0].(*FieldError)
+	assert.True(t, ok)
+	assert.Equal(t, "id", fe.Name)
+	assert.Equal(t, "empty", fe.GetCode())
+}
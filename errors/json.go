@@ -0,0 +1,51 @@
+package errors
+
+import "encoding/json"
+
+// jsonError is the wire form of SimpleBizError and FieldError, nested errors
+// carrying a name are decoded as field errors.
+type jsonError struct {
+	Code   string       `json:"code,omitempty"`
+	Msg    string       `json:"msg,omitempty"`
+	Name   string       `json:"name,omitempty"`
+	Errors []*jsonError `json:"errors,omitempty"`
+}
+
+func (je *jsonError) fill(err *SimpleBizError) {
+	err.Code = je.Code
+	err.Msg = je.Msg
+	err.Errors = nil
+	for _, child := range je.Errors {
+		err.AddError(child.bizError())
+	}
+}
+
+func (je *jsonError) bizError() BizError {
+	err := &SimpleBizError{}
+	je.fill(err)
+	if je.Name != "" {
+		return &FieldError{SimpleBizError: err, Name: je.Name}
+	}
+	return err
+}
+
+// UnmarshalJSON restores nested errors, so that a BizError survives a JSON round trip
+func (err *SimpleBizError) UnmarshalJSON(data []byte) error {
+	je := &jsonError{}
+	if e := json.Unmarshal(data, je); e != nil {
+		return e
+	}
+	je.fill(err)
+	return nil
+}
+
+func (err *FieldError) UnmarshalJSON(data []byte) error {
+	je := &jsonError{}
+	if e := json.Unmarshal(data, je); e != nil {
+		return e
+	}
+	err.SimpleBizError = &SimpleBizError{}
+	je.fill(err.SimpleBizError)
+	err.Name = je.Name
+	return nil
+}
@@ -0,0 +1,158 @@
+package errors
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// Level is the level failures with a code are logged at
+type Level int8
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var levelNames = []string{"debug", "info", "warn", "error"}
+
+func (level Level) String() string {
+	if level < LevelDebug || level > LevelError {
+		return strconv.Itoa(int(level))
+	}
+	return levelNames[level]
+}
+
+func (level Level) MarshalText() ([]byte, error) {
+	return []byte(level.String()), nil
+}
+
+// Code describes how errors with a code are answered. Errors whose details are not
+// Public reach clients with their code and the default Message only.
+type Code struct {
+	Code    string `json:"code"`
+	Status  int    `json:"status"`
+	Message string `json:"message,omitempty"`
+	Level   Level  `json:"level"`
+	Public  bool   `json:"public"`
+}
+
+// codes not registered are answered with 500 and their details, logged as errors
+var unregistered = Code{Status: http.StatusInternalServerError, Level: LevelError, Public: true}
+
+var registry = struct {
+	sync.RWMutex
+	codes map[string]Code
+}{codes: map[string]Code{}}
+
+// Register adds codes to the registry, replacing the codes registered before
+func Register(codes ...Code) {
+	registry.Lock()
+	defer registry.Unlock()
+	for _, code := range codes {
+		registry.codes[code.Code] = code
+	}
+}
+
+// Lookup answers the registered code
+func Lookup(code string) (Code, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+	c, ok := registry.codes[code]
+	return c, ok
+}
+
+// Codes answers the registered codes, sorted
+func Codes() []Code {
+	registry.RLock()
+	codes := make([]Code, 0, len(registry.codes))
+	for _, code := range registry.codes {
+		codes = append(codes, code)
+	}
+	registry.RUnlock()
+	sort.Slice(codes, func(i, j int) bool { return codes[i].Code < codes[j].Code })
+	return codes
+}
+
+// CodeOf answers the code of err, or of the BizError it wraps, other errors are server
+// errors
+func CodeOf(err error) Code {
+	code := Common_ServerError
+	if be := bizErrorOf(err); be != nil && be.GetCode() != "" {
+		code = be.GetCode()
+	}
+	if c, ok := Lookup(code); ok {
+		return c
+	}
+	c := unregistered
+	c.Code = code
+	return c
+}
+
+// StatusOf answers the http status of err
+func StatusOf(err error) int {
+	return CodeOf(err).Status
+}
+
+// LevelOf answers the level err is logged at
+func LevelOf(err error) Level {
+	return CodeOf(err).Level
+}
+
+// Public answers err as sent to clients, without its cause. Errors which are not
+// BizErrors and errors whose details are not public are replaced by their code and its
+// default message.
+func Public(err error) BizError {
+	code := CodeOf(err)
+	be := bizErrorOf(err)
+	if be == nil || !code.Public {
+		return &SimpleBizError{Code: code.Code, Msg: code.Message}
+	}
+	msg := be.GetMsg()
+	if msg == "" {
+		msg = code.Message
+	}
+	// a copy, without the cause
+	return &SimpleBizError{Code: be.GetCode(), Msg: msg, Errors: be.GetErrors()}
+}
+
+// bizErrorOf answers the first BizError along the chain of err
+func bizErrorOf(err error) BizError {
+	var be BizError
+	if As(err, &be) {
+		return be
+	}
+	return nil
+}
+
+// Dump writes the registered codes as a markdown table, for documentation
+func Dump(w io.Writer) error {
+	if _, err := fmt.Fprintln(w, "| Code | Status | Message | Level | Public |\n| --- | --- | --- | --- | --- |"); err != nil {
+		return err
+	}
+	for _, code := range Codes() {
+		if _, err := fmt.Fprintf(w, "| %s | %d | %s | %s | %t |\n", code.Code, code.Status, code.Message, code.Level, code.Public); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func init() {
+	Register(
+		Code{Code: Common_InvalidParams, Status: http.StatusBadRequest, Message: "invalid params", Level: LevelInfo, Public: true},
+		Code{Code: Common_Unauthorized, Status: http.StatusUnauthorized, Message: "unauthorized", Level: LevelInfo, Public: true},
+		Code{Code: Common_Forbidden, Status: http.StatusForbidden, Message: "forbidden", Level: LevelWarn, Public: true},
+		Code{Code: Common_NotFound, Status: http.StatusNotFound, Message: "not found", Level: LevelInfo, Public: true},
+		Code{Code: Common_Conflict, Status: http.StatusConflict, Message: "conflict", Level: LevelInfo, Public: true},
+		Code{Code: Common_PreconditionFailed, Status: http.StatusPreconditionFailed, Message: "precondition failed", Level: LevelInfo, Public: true},
+		Code{Code: Common_TooManyRequests, Status: http.StatusTooManyRequests, Message: "too many requests", Level: LevelInfo, Public: true},
+		Code{Code: Common_ServerError, Status: http.StatusInternalServerError, Message: "server error", Level: LevelError},
+		Code{Code: Common_RPCError, Status: http.StatusInternalServerError, Message: "server error", Level: LevelError},
+	)
+}
@@ -0,0 +1,37 @@
+package errors
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistry(t *testing.T) {
+	Register(Code{Code: "order.CLOSED", Status: http.StatusUnprocessableEntity, Message: "order closed", Level: LevelWarn, Public: true},
+		Code{Code: "order.LEDGER", Status: http.StatusBadGateway, Message: "ledger unavailable", Level: LevelError})
+
+	assert.Equal(t, http.StatusNotFound, StatusOf(NotFound()))
+	assert.Equal(t, http.StatusUnprocessableEntity, StatusOf(&SimpleBizError{Code: "order.CLOSED"}))
+	assert.Equal(t, LevelWarn, LevelOf(&SimpleBizError{Code: "order.CLOSED"}))
+	assert.Equal(t, http.StatusInternalServerError, StatusOf(fmt.Errorf("dial tcp: refused")))
+	assert.Equal(t, http.StatusInternalServerError, StatusOf(&SimpleBizError{Code: "x.UNKNOWN"}))
+	assert.Equal(t, LevelError, LevelOf(&SimpleBizError{Code: "x.UNKNOWN"}))
+
+	assert.Equal(t, &SimpleBizError{Code: Common_ServerError, Msg: "server error"}, Public(fmt.Errorf("dial tcp: refused")))
+	assert.Equal(t, &SimpleBizError{Code: Common_ServerError, Msg: "server error"}, Public(ServerErrorWithMsg("pq: relation missing")))
+	assert.Equal(t, &SimpleBizError{Code: "order.LEDGER", Msg: "ledger unavailable"}, Public(&SimpleBizError{Code: "order.LEDGER", Msg: "10.0.0.3 timeout"}))
+	assert.Equal(t, &SimpleBizError{Code: "order.CLOSED", Msg: "order closed"}, Public(&SimpleBizError{Code: "order.CLOSED"}))
+	invalid := InvalidParams().AddError(InvalidField("id", "", "bad id"))
+	assert.Equal(t, "invalid params", Public(invalid).GetMsg())
+	assert.Len(t, *Public(invalid).GetErrors(), 1)
+	unknown := &SimpleBizError{Code: "x.UNKNOWN", Msg: "detail"}
+	assert.Equal(t, unknown, Public(unknown))
+
+	buf := &bytes.Buffer{}
+	assert.NoError(t, Dump(buf))
+	assert.Contains(t, buf.String(), "| order.CLOSED | 422 | order closed | warn | true |\n")
+	assert.Contains(t, buf.String(), "| c.SERVER_ERROR | 500 | server error | error | false |\n")
+}
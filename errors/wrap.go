@@ -0,0 +1,115 @@
+package errors
+
+import (
+	stderrors "errors"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// CaptureStack makes Wrap record the stack of the wrapped errors, for the logs
+var CaptureStack = false
+
+// Wrap answers an error with code caused by cause, which is logged but never sent to
+// clients. cause may be nil.
+func Wrap(cause error, code string) *SimpleBizError {
+	return wrap(cause, code, "")
+}
+
+// WrapWithMsg answers an error with code and msg caused by cause
+func WrapWithMsg(cause error, code string, msg string) *SimpleBizError {
+	return wrap(cause, code, msg)
+}
+
+func wrap(cause error, code string, msg string) *SimpleBizError {
+	err := &SimpleBizError{Code: code, Msg: msg, cause: cause}
+	if CaptureStack {
+		err.stack = callers(1)
+	}
+	return err
+}
+
+// WithStack records the stack of the caller
+func (err *SimpleBizError) WithStack() *SimpleBizError {
+	err.stack = callers(0)
+	return err
+}
+
+// Unwrap answers the cause of err
+func (err *SimpleBizError) Unwrap() error {
+	if err == nil {
+		return nil
+	}
+	return err.cause
+}
+
+// Is matches BizErrors by code, so errors.Is(err, errors.NotFound()) tells whether
+// err, or an error it wraps, has the code c.NOT_FOUND
+func (err *SimpleBizError) Is(target error) bool {
+	be, ok := target.(BizError)
+	return ok && err != nil && be.GetCode() != "" && be.GetCode() == err.Code
+}
+
+// Stack answers the stack recorded for err, "" when none was
+func (err *SimpleBizError) Stack() string {
+	if err == nil || len(err.stack) == 0 {
+		return ""
+	}
+	sb := strings.Builder{}
+	frames := runtime.CallersFrames(err.stack)
+	for {
+		frame, more := frames.Next()
+		sb.WriteString(frame.Function)
+		sb.WriteString("\n\t")
+		sb.WriteString(frame.File)
+		sb.WriteByte(':')
+		sb.WriteString(strconv.Itoa(frame.Line))
+		sb.WriteByte('\n')
+		if !more {
+			break
+		}
+	}
+	return sb.String()
+}
+
+// callers answers the stack of the caller of the function recording it, skipping skip
+// more frames
+func callers(skip int) []uintptr {
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(3+skip, pcs)
+	return pcs[:n]
+}
+
+// Is is errors.Is of the standard library
+func Is(err error, target error) bool {
+	return stderrors.Is(err, target)
+}
+
+// As is errors.As of the standard library
+func As(err error, target interface{}) bool {
+	return stderrors.As(err, target)
+}
+
+// Unwrap is errors.Unwrap of the standard library
+func Unwrap(err error) error {
+	return stderrors.Unwrap(err)
+}
+
+// HasCode tells whether err, or an error it wraps, has code
+func HasCode(err error, code string) bool {
+	return stderrors.Is(err, &SimpleBizError{Code: code})
+}
+
+// StackOf answers the first stack recorded along the chain of err
+func StackOf(err error) string {
+	for err != nil {
+		if be, ok := err.(*SimpleBizError); ok && len(be.stack) > 0 {
+			return be.Stack()
+		}
+		if fe, ok := err.(*FieldError); ok && fe.SimpleBizError != nil && len(fe.stack) > 0 {
+			return fe.Stack()
+		}
+		err = stderrors.Unwrap(err)
+	}
+	return ""
+}
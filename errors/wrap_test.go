@@ -0,0 +1,44 @@
+package errors
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWrap(t *testing.T) {
+	cause := fmt.Errorf("read tcp 10.0.0.3:5432: %w", io.ErrUnexpectedEOF)
+	err := Wrap(cause, Common_ServerError)
+
+	assert.Equal(t, "c.SERVER_ERROR: read tcp 10.0.0.3:5432: unexpected EOF", err.Error())
+	assert.Equal(t, cause, Unwrap(err))
+	assert.True(t, Is(err, io.ErrUnexpectedEOF))
+	assert.True(t, Is(err, ServerError()))
+	assert.False(t, Is(err, NotFound()))
+
+	wrapped := fmt.Errorf("load order: %w", WrapWithMsg(cause, Common_NotFound, "no order"))
+	assert.True(t, HasCode(wrapped, Common_NotFound))
+	var be BizError
+	assert.True(t, As(wrapped, &be))
+	assert.Equal(t, "no order", be.GetMsg())
+	assert.Equal(t, Common_NotFound, CodeOf(wrapped).Code)
+
+	data, e := json.Marshal(err)
+	assert.NoError(t, e)
+	assert.Equal(t, `{"code":"c.SERVER_ERROR"}`, string(data))
+	assert.Equal(t, "", StackOf(err))
+}
+
+func TestWrapStack(t *testing.T) {
+	CaptureStack = true
+	defer func() { CaptureStack = false }()
+
+	err := fmt.Errorf("outer: %w", Wrap(io.EOF, Common_RPCError))
+	stack := StackOf(err)
+	assert.Contains(t, stack, "errors.TestWrapStack")
+	assert.NotContains(t, stack, "errors.wrap")
+	assert.Contains(t, NotFound().WithStack().Stack(), "errors.TestWrapStack")
+}
@@ -0,0 +1,270 @@
+package communal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"reflect"
+	"time"
+
+	"github.com/sdjnlh/communal/errors"
+	"github.com/sdjnlh/communal/id"
+	"github.com/sdjnlh/communal/log"
+	"github.com/sdjnlh/communal/util"
+	"go.uber.org/zap"
+	"xorm.io/xorm"
+	"xorm.io/xorm/convert"
+	"xorm.io/xorm/names"
+)
+
+const (
+	HistoryUpdate = "update"
+	HistoryDelete = "delete"
+)
+
+// History is one recorded change of an entity. Diff maps the changed columns to
+// their values before and after the change: {"title": {"from": "a", "to": "b"}}
+type History struct {
+	ID       `xorm:"extends"`
+	Module   string    `xorm:"VARCHAR(64) index" json:"module"`
+	EntityId int64     `xorm:"BIGINT(20) index" json:"entityId,string"`
+	Uid      int64     `xorm:"BIGINT(20)" json:"uid,string"`
+	Op       string    `xorm:"VARCHAR(16)" json:"op"`
+	Diff     Diff      `xorm:"TEXT" json:"diff"`
+	Crt      time.Time `xorm:"TIMESTAMP" json:"crt"`
+}
+
+// Diff is a JsonMap whose numbers are read as json.Number, keeping int64 values exact
+type Diff map[string]interface{}
+
+func (diff *Diff) FromDB(data []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(diff)
+}
+
+func (diff *Diff) ToDB() ([]byte, error) {
+	if diff == nil {
+		return []byte("{}"), nil
+	}
+	return json.Marshal(diff)
+}
+
+// TrackHistory enables change history of the module, stored in table
+func (module *Module) TrackHistory(table string) *Module {
+	module.HistoryTable = table
+	return module
+}
+
+// Track runs change in a transaction and, when history is tracked, records the
+// columns of the entity changed by it together with the user of ctx.
+func (module *Module) Track(ctx context.Context, op string, entityId int64, change func(ss *xorm.Session) error) error {
+	return module.TrackIf(ctx, op, entityId, nil, nil, change)
+}
+
+// TrackIf is Track running change only when check accepts the current entity, loaded
+// into current and locked until change is committed. It answers NotFound when there
+// is no entity of entityId.
+func (module *Module) TrackIf(ctx context.Context, op string, entityId int64, current interface{}, check func() error, change func(ss *xorm.Session) error) (err error) {
+	ss := module.Db.NewSession()
+	defer ss.Close()
+
+	if module.HistoryTable == "" && check == nil {
+		return change(ss)
+	}
+
+	if err = ss.Begin(); err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = ss.Rollback()
+		}
+	}()
+
+	if check != nil {
+		has, err := module.load(ss.Table(module.TableName).ID(entityId).ForUpdate(), current)
+		if err != nil {
+			return err
+		}
+		if !has {
+			return errors.NotFound()
+		}
+		if err = check(); err != nil {
+			return err
+		}
+	}
+	if module.HistoryTable == "" {
+		if err = change(ss); err != nil {
+			return err
+		}
+		return ss.Commit()
+	}
+
+	before, err := module.row(ss, entityId)
+	if err != nil {
+		return err
+	}
+	if err = change(ss); err != nil {
+		return err
+	}
+	after, err := module.row(ss, entityId)
+	if err != nil {
+		return err
+	}
+
+	if diff := diffRows(before, after); len(diff) > 0 {
+		history := &History{
+			Module:   module.Name,
+			EntityId: entityId,
+			Uid:      UidFrom(ctx),
+			Op:       op,
+			Diff:     diff,
+			Crt:      time.Now(),
+		}
+		history.Id, _ = id.Next()
+		if _, err = ss.Table(module.HistoryTable).Insert(history); err != nil {
+			log.Ctx(ctx).Error("fail to record history", zap.String("module", module.Name), zap.Int64("id", entityId), zap.Error(err))
+			return err
+		}
+	}
+
+	return ss.Commit()
+}
+
+// Histories lists the recorded changes of an entity, latest first
+func (module *Module) Histories(ctx context.Context, entityId int64, page *Page, result *FilterResult) error {
+	page.GetPager(0)
+	var histories []*History
+	count, err := module.Db.Table(module.HistoryTable).
+		Where("module = ? and entity_id = ?", module.Name, entityId).
+		Desc("crt", "id").
+		Limit(page.Limit(), page.Skip()).
+		FindAndCount(&histories)
+	if err != nil {
+		return err
+	}
+
+	result.Success(histories)
+	result.Page = page.GetPager(count)
+	return nil
+}
+
+// AsOf loads the entity as it was at the given time into receiver, by reverting
+// the recorded changes made after it. Entities whose crt column is after the time
+// are not found.
+func (module *Module) AsOf(ctx context.Context, entityId int64, at time.Time, receiver interface{}) (found bool, err error) {
+	ss := module.Db.NewSession()
+	defer ss.Close()
+
+	row, err := module.row(ss, entityId)
+	if err != nil || row == nil {
+		return false, err
+	}
+	if crt, ok := timeOf(row["crt"]); ok && crt.After(at) {
+		return false, nil
+	}
+
+	var histories []*History
+	if err = ss.Table(module.HistoryTable).
+		Where("module = ? and entity_id = ? and crt > ?", module.Name, entityId, at).
+		Desc("crt", "id").
+		Find(&histories); err != nil {
+		return false, err
+	}
+	for _, history := range histories {
+		revert(row, history.Diff)
+	}
+
+	return true, fillDomain(receiver, row, module.columnMapper())
+}
+
+func (module *Module) row(ss *xorm.Session, entityId int64) (map[string]interface{}, error) {
+	rows, err := ss.Table(module.TableName).Where("id = ?", entityId).QueryInterface()
+	if err != nil || len(rows) == 0 {
+		return nil, err
+	}
+
+	row := rows[0]
+	for col, value := range row {
+		if bts, ok := value.([]byte); ok {
+			row[col] = string(bts)
+		}
+	}
+	return row, nil
+}
+
+func diffRows(before map[string]interface{}, after map[string]interface{}) Diff {
+	diff := Diff{}
+	for col, to := range after {
+		from := before[col]
+		if !reflect.DeepEqual(from, to) {
+			diff[col] = map[string]interface{}{"from": from, "to": to}
+		}
+	}
+	for col, from := range before {
+		if _, ok := after[col]; !ok {
+			diff[col] = map[string]interface{}{"from": from, "to": nil}
+		}
+	}
+	return diff
+}
+
+func revert(row map[string]interface{}, diff Diff) {
+	for col, change := range diff {
+		if pair, ok := change.(map[string]interface{}); ok {
+			row[col] = pair["from"]
+		}
+	}
+}
+
+// timeOf reads a time column, scanned as a time or formatted by the driver
+func timeOf(value interface{}) (time.Time, bool) {
+	switch v := value.(type) {
+	case time.Time:
+		return v, true
+	case string:
+		for _, layout := range []string{"2006-01-02 15:04:05", time.RFC3339Nano} {
+			if t, err := time.ParseInLocation(layout, v, time.Local); err == nil {
+				return t, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+// fillDomain sets the fields of receiver from column values
+func fillDomain(receiver interface{}, row map[string]interface{}, mapper names.Mapper) error {
+	v := reflect.Indirect(reflect.ValueOf(receiver))
+	for _, field := range util.StructFields(v.Type(), mapper) {
+		value, ok := row[field.Column]
+		if !ok || field.Column == "" || value == nil {
+			continue
+		}
+
+		fv := v.FieldByIndex(field.Index)
+		if str, ok := value.(string); ok {
+			if conversion, ok := fv.Addr().Interface().(convert.Conversion); ok {
+				if err := conversion.FromDB([]byte(str)); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		if timeType := reflect.TypeOf(time.Time{}); fv.Type().ConvertibleTo(timeType) {
+			if tv, ok := timeOf(value); ok {
+				fv.Set(reflect.ValueOf(tv).Convert(fv.Type()))
+				continue
+			}
+		}
+
+		bts, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		if err = json.Unmarshal(bts, fv.Addr().Interface()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
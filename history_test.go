@@ -0,0 +1,89 @@
+package communal
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sdjnlh/communal/internal/dbtest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffRows(t *testing.T) {
+	before := map[string]interface{}{"id": int64(1), "title": "a", "status": int64(1), "dtd": false}
+	after := map[string]interface{}{"id": int64(1), "title": "b", "status": int64(1), "dtd": true}
+
+	diff := diffRows(before, after)
+	assert.Len(t, diff, 2)
+	assert.Equal(t, map[string]interface{}{"from": "a", "to": "b"}, diff["title"])
+	assert.Equal(t, map[string]interface{}{"from": false, "to": true}, diff["dtd"])
+	assert.Empty(t, diffRows(before, before))
+}
+
+func TestRevertAndFill(t *testing.T) {
+	type article struct {
+		ID    `xorm:"extends"`
+		Title string    `json:"title"`
+		Tags  JsonMap   `json:"tags"`
+		Crt   time.Time `json:"crt"`
+	}
+
+	crt := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	row := map[string]interface{}{"id": int64(7), "title": "c", "tags": `{"a":1}`, "crt": crt}
+	// json decoded diffs, latest first
+	revert(row, Diff{"title": map[string]interface{}{"from": "b", "to": "c"}})
+	revert(row, Diff{"title": map[string]interface{}{"from": "a", "to": "b"}})
+
+	a := &article{}
+	assert.NoError(t, fillDomain(a, row, nil))
+	assert.Equal(t, int64(7), a.Id)
+	assert.Equal(t, "a", a.Title)
+	assert.Equal(t, float64(1), a.Tags["a"])
+	assert.True(t, crt.Equal(a.Crt))
+}
+
+func TestModule_AsOf(t *testing.T) {
+	type order struct {
+		ID     `xorm:"extends"`
+		Amount int64     `json:"amount"`
+		Crt    time.Time `json:"crt"`
+	}
+
+	engine, db := dbtest.Open()
+	crt := time.Date(2020, 1, 2, 0, 0, 0, 0, time.Local)
+	db.Rows("FROM `order_history`", []string{"id", "diff", "crt"},
+		[]interface{}{int64(1), `{"amount":{"from":9007199254740993,"to":1}}`, crt.Add(2 * time.Hour)})
+	db.Rows("FROM `order`", []string{"id", "amount", "crt"}, []interface{}{int64(7), int64(1), crt})
+	module := NewModule("order", "order", "/orders").TrackHistory("order_history")
+	module.SetDB(engine)
+
+	o := &order{}
+	found, err := module.AsOf(context.Background(), 7, crt.Add(time.Hour), o)
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, int64(9007199254740993), o.Amount)
+
+	found, err = module.AsOf(context.Background(), 7, crt.Add(-time.Hour), &order{})
+	assert.NoError(t, err)
+	assert.False(t, found)
+}
+
+func TestModule_AsOf_StringTime(t *testing.T) {
+	type order struct {
+		ID  `xorm:"extends"`
+		Crt time.Time `json:"crt"`
+	}
+
+	engine, db := dbtest.Open()
+	crt := time.Date(2020, 1, 2, 3, 4, 5, 0, time.Local)
+	// drivers such as sqlite scan DATETIME columns as text
+	db.Rows("FROM `order`", []string{"id", "crt"}, []interface{}{int64(7), "2020-01-02 03:04:05"})
+	module := NewModule("order", "order", "/orders").TrackHistory("order_history")
+	module.SetDB(engine)
+
+	o := &order{}
+	found, err := module.AsOf(context.Background(), 7, crt.Add(time.Hour), o)
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.True(t, crt.Equal(o.Crt), o.Crt.String())
+}
@@ -0,0 +1,117 @@
+package idempotency
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrClaimLost is answered by Finish and Release when the claim of the request has
+// expired and the key has been claimed again, by a retry, since
+var ErrClaimLost = errors.New("idempotency key claimed by another request")
+
+// Record is the state of a request under an idempotency key, pending until its
+// response is stored. Owner is the random token of the request which claimed it.
+type Record struct {
+	Owner       string `json:"owner"`
+	Hash        string `json:"hash"`
+	Done        bool   `json:"done"`
+	Status      int    `json:"status,omitempty"`
+	ContentType string `json:"contentType,omitempty"`
+	Body        []byte `json:"body,omitempty"`
+}
+
+// Store keeps the records of idempotency keys until they expire
+type Store interface {
+	// Start claims key for ttl with a pending record of hash owned by a new token, when
+	// the key is taken the record found is answered and started is false.
+	Start(ctx context.Context, key string, hash string, ttl time.Duration) (record *Record, started bool, err error)
+	// Finish stores the response of a started key, when it is still claimed by the
+	// owner of record, answering ErrClaimLost otherwise
+	Finish(ctx context.Context, key string, record *Record, ttl time.Duration) error
+	// Release frees a started key still claimed by owner, so that the request can be
+	// retried, answering ErrClaimLost otherwise
+	Release(ctx context.Context, key string, owner string) error
+}
+
+// newOwner answers a random token owning a claim
+func newOwner() (string, error) {
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(token), nil
+}
+
+type entry struct {
+	record *Record
+	expire time.Time
+}
+
+// Memory keeps records in the process, for single instance services and tests
+type Memory struct {
+	mu      sync.Mutex
+	entries map[string]*entry
+	now     func() time.Time
+}
+
+func NewMemory() *Memory {
+	return &Memory{entries: map[string]*entry{}, now: time.Now}
+}
+
+func (memory *Memory) Start(ctx context.Context, key string, hash string, ttl time.Duration) (*Record, bool, error) {
+	memory.mu.Lock()
+	defer memory.mu.Unlock()
+
+	now := memory.now()
+	if e, ok := memory.entries[key]; ok && now.Before(e.expire) {
+		copied := *e.record
+		return &copied, false, nil
+	}
+	for k, e := range memory.entries {
+		if !now.Before(e.expire) {
+			delete(memory.entries, k)
+		}
+	}
+	owner, err := newOwner()
+	if err != nil {
+		return nil, false, err
+	}
+	record := &Record{Owner: owner, Hash: hash}
+	memory.entries[key] = &entry{record: record, expire: now.Add(ttl)}
+	copied := *record
+	return &copied, true, nil
+}
+
+func (memory *Memory) Finish(ctx context.Context, key string, record *Record, ttl time.Duration) error {
+	memory.mu.Lock()
+	defer memory.mu.Unlock()
+
+	if !memory.owned(key, record.Owner) {
+		return ErrClaimLost
+	}
+	copied := *record
+	copied.Done = true
+	memory.entries[key] = &entry{record: &copied, expire: memory.now().Add(ttl)}
+	return nil
+}
+
+func (memory *Memory) Release(ctx context.Context, key string, owner string) error {
+	memory.mu.Lock()
+	defer memory.mu.Unlock()
+
+	if !memory.owned(key, owner) {
+		return ErrClaimLost
+	}
+	delete(memory.entries, key)
+	return nil
+}
+
+// owned tells whether key is claimed by owner and its claim has not expired
+func (memory *Memory) owned(key string, owner string) bool {
+	e, ok := memory.entries[key]
+	return ok && e.record.Owner == owner && memory.now().Before(e.expire)
+}
@@ -0,0 +1,64 @@
+package idempotency
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemory(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	memory := NewMemory()
+	memory.now = func() time.Time { return now }
+
+	claimed, started, err := memory.Start(ctx, "k", "h", time.Minute)
+	assert.NoError(t, err)
+	assert.True(t, started)
+	assert.False(t, claimed.Done)
+
+	record, started, _ := memory.Start(ctx, "k", "other", time.Minute)
+	assert.False(t, started)
+	assert.Equal(t, "h", record.Hash)
+
+	assert.NoError(t, memory.Finish(ctx, "k", &Record{Owner: claimed.Owner, Hash: "h", Status: 200, Body: []byte("{}")}, time.Minute))
+	record, started, _ = memory.Start(ctx, "k", "h", time.Minute)
+	assert.False(t, started)
+	assert.True(t, record.Done)
+	assert.Equal(t, "{}", string(record.Body))
+
+	now = now.Add(time.Minute)
+	record, started, _ = memory.Start(ctx, "k", "h", time.Minute)
+	assert.True(t, started, "expired records are replaced")
+
+	assert.NoError(t, memory.Release(ctx, "k", record.Owner))
+	_, started, _ = memory.Start(ctx, "k", "h", time.Minute)
+	assert.True(t, started)
+}
+
+func TestMemory_ExpiredClaim(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	memory := NewMemory()
+	memory.now = func() time.Time { return now }
+
+	first, started, _ := memory.Start(ctx, "k", "h", time.Second)
+	assert.True(t, started)
+	now = now.Add(2 * time.Second)
+	retry, started, _ := memory.Start(ctx, "k", "h", time.Second)
+	assert.True(t, started, "the retry claims the expired key")
+	assert.NotEqual(t, first.Owner, retry.Owner)
+
+	// the first request ends after the retry claimed the key, it must not touch it
+	assert.Equal(t, ErrClaimLost, memory.Finish(ctx, "k", &Record{Owner: first.Owner, Hash: "h", Status: 200}, time.Minute))
+	assert.Equal(t, ErrClaimLost, memory.Release(ctx, "k", first.Owner))
+	record, started, _ := memory.Start(ctx, "k", "h", time.Second)
+	assert.False(t, started, "the claim of the retry is kept")
+	assert.False(t, record.Done)
+
+	assert.NoError(t, memory.Finish(ctx, "k", &Record{Owner: retry.Owner, Hash: "h", Status: 201}, time.Minute))
+	record, _, _ = memory.Start(ctx, "k", "h", time.Second)
+	assert.Equal(t, 201, record.Status)
+}
@@ -0,0 +1,109 @@
+package idempotency
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// finishIfOwned stores the record of a key, or deletes the key when the record is
+// empty, as long as the key is claimed by the owner
+var finishIfOwned = redis.NewScript(1, `
+local found = redis.call('GET', KEYS[1])
+if not found or cjson.decode(found).owner ~= ARGV[1] then
+	return 0
+end
+if ARGV[2] == '' then
+	redis.call('DEL', KEYS[1])
+else
+	redis.call('SET', KEYS[1], ARGV[2], 'PX', ARGV[3])
+end
+return 1
+`)
+
+// Redis keeps records in redis, shared by all instances of a service
+type Redis struct {
+	Pool   *redis.Pool
+	Prefix string
+}
+
+func NewRedis(pool *redis.Pool) *Redis {
+	return &Redis{Pool: pool, Prefix: "idempotency:"}
+}
+
+func (store *Redis) Start(ctx context.Context, key string, hash string, ttl time.Duration) (*Record, bool, error) {
+	conn, err := store.Pool.GetContext(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	defer conn.Close()
+
+	owner, err := newOwner()
+	if err != nil {
+		return nil, false, err
+	}
+	record := &Record{Owner: owner, Hash: hash}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return nil, false, err
+	}
+	// the key may expire between SET and GET, so claim it again then
+	for i := 0; i < 2; i++ {
+		_, err = redis.String(conn.Do("SET", store.Prefix+key, data, "PX", ttl.Milliseconds(), "NX"))
+		if err == nil {
+			return record, true, nil
+		}
+		if err != redis.ErrNil {
+			return nil, false, err
+		}
+
+		found, err := redis.Bytes(conn.Do("GET", store.Prefix+key))
+		if err == redis.ErrNil {
+			continue
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		existing := &Record{}
+		if err = json.Unmarshal(found, existing); err != nil {
+			return nil, false, err
+		}
+		return existing, false, nil
+	}
+	return nil, false, redis.ErrNil
+}
+
+func (store *Redis) Finish(ctx context.Context, key string, record *Record, ttl time.Duration) error {
+	copied := *record
+	copied.Done = true
+	data, err := json.Marshal(&copied)
+	if err != nil {
+		return err
+	}
+
+	return store.ifOwned(ctx, key, record.Owner, data, ttl)
+}
+
+func (store *Redis) Release(ctx context.Context, key string, owner string) error {
+	return store.ifOwned(ctx, key, owner, nil, 0)
+}
+
+// ifOwned sets the key to data, or deletes it when data is nil, if owner claims it
+func (store *Redis) ifOwned(ctx context.Context, key string, owner string, data []byte, ttl time.Duration) error {
+	conn, err := store.Pool.GetContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	done, err := redis.Int(finishIfOwned.Do(conn, store.Prefix+key, owner, data, ttl.Milliseconds()))
+	if err != nil {
+		return err
+	}
+	if done == 0 {
+		return ErrClaimLost
+	}
+	return nil
+}
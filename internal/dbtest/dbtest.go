@@ -0,0 +1,234 @@
+// Package dbtest opens xorm engines on a fake mysql database recording the statements
+// it runs and answering queries with canned rows, to test the sql built by modules.
+package dbtest
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"xorm.io/xorm"
+	"xorm.io/xorm/dialects"
+	"xorm.io/xorm/schemas"
+)
+
+const driverName = "dbtest"
+
+var (
+	dbs  sync.Map
+	next int64
+)
+
+func init() {
+	sql.Register(driverName, fakeDriver{})
+	dialects.RegisterDriver(driverName, fakeDriver{})
+}
+
+// Statement is a statement run on the database
+type Statement struct {
+	SQL  string
+	Args []interface{}
+}
+
+type answer struct {
+	match    string
+	columns  []string
+	rows     [][]driver.Value
+	affected int64
+	err      error
+}
+
+// DB records the statements run on it and answers them with the first answer whose
+// match the statement contains. Statements without an answer return no rows and
+// affect one row.
+type DB struct {
+	mu         sync.Mutex
+	statements []Statement
+	answers    []answer
+}
+
+// Open answers an engine on a new fake database
+func Open() (*xorm.Engine, *DB) {
+	db := &DB{}
+	dsn := strconv.FormatInt(atomic.AddInt64(&next, 1), 10)
+	dbs.Store(dsn, db)
+	engine, err := xorm.NewEngine(driverName, dsn)
+	if err != nil {
+		panic(err)
+	}
+	return engine, db
+}
+
+// Rows answers the queries containing match with rows of columns
+func (db *DB) Rows(match string, columns []string, rows ...[]interface{}) *DB {
+	values := make([][]driver.Value, len(rows))
+	for i, row := range rows {
+		values[i] = make([]driver.Value, len(row))
+		for j, value := range row {
+			values[i][j] = value
+		}
+	}
+	return db.answer(answer{match: match, columns: columns, rows: values})
+}
+
+// Affected answers the statements containing match with n affected rows
+func (db *DB) Affected(match string, n int64) *DB {
+	return db.answer(answer{match: match, affected: n})
+}
+
+// Error fails the statements containing match with err
+func (db *DB) Error(match string, err error) *DB {
+	return db.answer(answer{match: match, err: err})
+}
+
+func (db *DB) answer(a answer) *DB {
+	db.mu.Lock()
+	db.answers = append(db.answers, a)
+	db.mu.Unlock()
+	return db
+}
+
+// Statements answers the statements run, in order
+func (db *DB) Statements() []Statement {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return append([]Statement(nil), db.statements...)
+}
+
+// Find answers the statements containing match
+func (db *DB) Find(match string) []Statement {
+	var found []Statement
+	for _, statement := range db.Statements() {
+		if strings.Contains(statement.SQL, match) {
+			found = append(found, statement)
+		}
+	}
+	return found
+}
+
+func (db *DB) run(query string, args []driver.Value) answer {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	statement := Statement{SQL: query, Args: make([]interface{}, len(args))}
+	for i, arg := range args {
+		statement.Args[i] = arg
+	}
+	db.statements = append(db.statements, statement)
+	for _, a := range db.answers {
+		if strings.Contains(query, a.match) {
+			return a
+		}
+	}
+	return answer{affected: 1}
+}
+
+type fakeDriver struct{}
+
+func (fakeDriver) Parse(driverName string, dsn string) (*dialects.URI, error) {
+	return &dialects.URI{DBType: schemas.MYSQL, DBName: "dbtest"}, nil
+}
+
+func (fakeDriver) Open(dsn string) (driver.Conn, error) {
+	db, ok := dbs.Load(dsn)
+	if !ok {
+		return nil, driver.ErrBadConn
+	}
+	return &conn{db: db.(*DB)}, nil
+}
+
+type conn struct {
+	db *DB
+}
+
+func (c *conn) Prepare(query string) (driver.Stmt, error) {
+	return &stmt{db: c.db, query: query}, nil
+}
+
+func (c *conn) Close() error {
+	return nil
+}
+
+func (c *conn) Begin() (driver.Tx, error) {
+	return tx{}, nil
+}
+
+func (c *conn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	return tx{}, nil
+}
+
+type tx struct{}
+
+func (tx) Commit() error {
+	return nil
+}
+
+func (tx) Rollback() error {
+	return nil
+}
+
+type stmt struct {
+	db    *DB
+	query string
+}
+
+func (s *stmt) Close() error {
+	return nil
+}
+
+func (s *stmt) NumInput() int {
+	return -1
+}
+
+func (s *stmt) Exec(args []driver.Value) (driver.Result, error) {
+	a := s.db.run(s.query, args)
+	if a.err != nil {
+		return nil, a.err
+	}
+	return result(a.affected), nil
+}
+
+func (s *stmt) Query(args []driver.Value) (driver.Rows, error) {
+	a := s.db.run(s.query, args)
+	if a.err != nil {
+		return nil, a.err
+	}
+	return &rows{columns: a.columns, values: a.rows}, nil
+}
+
+type result int64
+
+func (r result) LastInsertId() (int64, error) {
+	return 0, nil
+}
+
+func (r result) RowsAffected() (int64, error) {
+	return int64(r), nil
+}
+
+type rows struct {
+	columns []string
+	values  [][]driver.Value
+	i       int
+}
+
+func (r *rows) Columns() []string {
+	return r.columns
+}
+
+func (r *rows) Close() error {
+	return nil
+}
+
+func (r *rows) Next(dest []driver.Value) error {
+	if r.i >= len(r.values) {
+		return io.EOF
+	}
+	copy(dest, r.values[r.i])
+	r.i++
+	return nil
+}
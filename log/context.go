@@ -0,0 +1,43 @@
+package log
+
+import (
+	"context"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const (
+	// RequestIdKey is the key of the request id in gin contexts, and of its log field
+	RequestIdKey = "requestId"
+	// RequestIdHeader carries the request id in and out of services
+	RequestIdHeader = "X-Request-ID"
+)
+
+type requestIdKey struct{}
+
+// WithRequestId stores the request id in a plain context
+func WithRequestId(ctx context.Context, requestId string) context.Context {
+	return context.WithValue(ctx, requestIdKey{}, requestId)
+}
+
+// RequestIdFrom reads the request id from a gin or plain context, "" if absent
+func RequestIdFrom(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	if c, ok := ctx.(*gin.Context); ok {
+		return c.GetString(RequestIdKey)
+	}
+	id, _ := ctx.Value(requestIdKey{}).(string)
+	return id
+}
+
+// Ctx answers Logger with the request id of ctx added to its entries
+func Ctx(ctx context.Context) logger {
+	requestId := RequestIdFrom(ctx)
+	if requestId == "" || Logger.Logger == nil {
+		return Logger
+	}
+	return logger{Logger: Logger.With(zap.String(RequestIdKey, requestId))}
+}
@@ -0,0 +1,156 @@
+// Package metrics collects metrics and exposes them in the Prometheus text format.
+// Metrics are registered to the Default registry, served by Handler on /metrics.
+package metrics
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	TypeCounter   = "counter"
+	TypeGauge     = "gauge"
+	TypeHistogram = "histogram"
+)
+
+type Label struct {
+	Name  string
+	Value string
+}
+
+// Sample is a value of a family, Suffix is added to the name of the family, like
+// _bucket, _sum and _count for histograms
+type Sample struct {
+	Suffix string
+	Labels []Label
+	Value  float64
+}
+
+type Family struct {
+	Name    string
+	Help    string
+	Type    string
+	Samples []Sample
+}
+
+// Collector answers the families of metrics it collects, when they are scraped
+type Collector interface {
+	Collect() []Family
+}
+
+// CollectorFunc collects metrics computed on scrape, like the stats of pools
+type CollectorFunc func() []Family
+
+func (fn CollectorFunc) Collect() []Family {
+	return fn()
+}
+
+type Registry struct {
+	mu         sync.RWMutex
+	collectors []Collector
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+var Default = NewRegistry()
+
+func (registry *Registry) Register(collectors ...Collector) {
+	registry.mu.Lock()
+	registry.collectors = append(registry.collectors, collectors...)
+	registry.mu.Unlock()
+}
+
+// Gather answers the families of the registered collectors sorted by name. Families
+// of the same name, e.g. of the pools of several databases, are merged.
+func (registry *Registry) Gather() []Family {
+	registry.mu.RLock()
+	collectors := registry.collectors
+	registry.mu.RUnlock()
+
+	var families []Family
+	index := map[string]int{}
+	for _, collector := range collectors {
+		for _, family := range collector.Collect() {
+			if i, ok := index[family.Name]; ok {
+				families[i].Samples = append(families[i].Samples, family.Samples...)
+				continue
+			}
+			index[family.Name] = len(families)
+			families = append(families, family)
+		}
+	}
+	sort.SliceStable(families, func(i, j int) bool { return families[i].Name < families[j].Name })
+	return families
+}
+
+// WriteText writes the registered metrics in the Prometheus text format
+func (registry *Registry) WriteText(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for _, family := range registry.Gather() {
+		if len(family.Samples) == 0 {
+			continue
+		}
+		if family.Help != "" {
+			bw.WriteString("# HELP " + family.Name + " " + helpEscaper.Replace(family.Help) + "\n")
+		}
+		bw.WriteString("# TYPE " + family.Name + " " + family.Type + "\n")
+		for _, sample := range family.Samples {
+			bw.WriteString(family.Name + sample.Suffix)
+			if len(sample.Labels) > 0 {
+				bw.WriteByte('{')
+				for i, label := range sample.Labels {
+					if i > 0 {
+						bw.WriteByte(',')
+					}
+					bw.WriteString(label.Name + `="` + labelEscaper.Replace(label.Value) + `"`)
+				}
+				bw.WriteByte('}')
+			}
+			bw.WriteString(" " + formatValue(sample.Value) + "\n")
+		}
+	}
+	return bw.Flush()
+}
+
+// Handler serves the registered metrics
+func (registry *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_ = registry.WriteText(w)
+	})
+}
+
+// Register registers collectors to the Default registry
+func Register(collectors ...Collector) {
+	Default.Register(collectors...)
+}
+
+// Handler serves the metrics of the Default registry
+func Handler() http.Handler {
+	return Default.Handler()
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func formatValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
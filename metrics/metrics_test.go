@@ -0,0 +1,63 @@
+package metrics
+
+import (
+	"bytes"
+	"math"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteText(t *testing.T) {
+	registry := NewRegistry()
+	requests := NewCounter("requests_total", "Requests.\nAll of them.", "route", "status")
+	inFlight := NewGauge("in_flight", "")
+	latency := NewHistogram("latency_seconds", "Latency.", []float64{0.1, 1}, "route")
+	registry.Register(requests, inFlight, latency, CollectorFunc(func() []Family {
+		return []Family{{Name: "pool_idle", Type: TypeGauge, Samples: []Sample{{Labels: []Label{{Name: "db", Value: "a"}}, Value: 1}}}}
+	}), CollectorFunc(func() []Family {
+		return []Family{{Name: "pool_idle", Type: TypeGauge, Samples: []Sample{{Labels: []Label{{Name: "db", Value: "b"}}, Value: 2}}}}
+	}))
+
+	requests.Inc("/posts/:id", "200")
+	requests.Add(2, "/posts/:id", "200")
+	requests.Inc(`/a"b`, "500")
+	inFlight.Set(3)
+	inFlight.Add(-1)
+	latency.Observe(0.05, "/posts")
+	latency.ObserveDuration(500*time.Millisecond, "/posts")
+	latency.Observe(3, "/posts")
+
+	buf := &bytes.Buffer{}
+	assert.NoError(t, registry.WriteText(buf))
+	assert.Equal(t, `# TYPE in_flight gauge
+in_flight 2
+# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{route="/posts",le="0.1"} 1
+latency_seconds_bucket{route="/posts",le="1"} 2
+latency_seconds_bucket{route="/posts",le="+Inf"} 3
+latency_seconds_sum{route="/posts"} 3.55
+latency_seconds_count{route="/posts"} 3
+# TYPE pool_idle gauge
+pool_idle{db="a"} 1
+pool_idle{db="b"} 2
+# HELP requests_total Requests.\nAll of them.
+# TYPE requests_total counter
+requests_total{route="/a\"b",status="500"} 1
+requests_total{route="/posts/:id",status="200"} 3
+`, buf.String())
+
+	w := httptest.NewRecorder()
+	registry.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Contains(t, w.Header().Get("Content-Type"), "version=0.0.4")
+	assert.Equal(t, buf.String(), w.Body.String())
+}
+
+func TestMisuse(t *testing.T) {
+	assert.Panics(t, func() { NewCounter("c", "", "a").Inc() })
+	assert.Panics(t, func() { NewCounter("c", "").Add(-1) })
+	assert.Equal(t, "+Inf", formatValue(math.Inf(1)))
+}
@@ -0,0 +1,41 @@
+package metrics
+
+import (
+	"github.com/gomodule/redigo/redis"
+	"xorm.io/xorm"
+)
+
+// DB collects the connection pool stats of the engine of the db.<name> config
+func DB(name string, engine *xorm.Engine) Collector {
+	return CollectorFunc(func() []Family {
+		stats := engine.DB().Stats()
+		labels := []Label{{Name: "db", Value: name}}
+		gauge := func(metric string, help string, value float64) Family {
+			return Family{Name: metric, Help: help, Type: TypeGauge, Samples: []Sample{{Labels: labels, Value: value}}}
+		}
+		return []Family{
+			gauge("db_max_open_connections", "Maximum number of open connections to the database.", float64(stats.MaxOpenConnections)),
+			gauge("db_open_connections", "Number of open connections to the database.", float64(stats.OpenConnections)),
+			gauge("db_in_use_connections", "Number of connections in use.", float64(stats.InUse)),
+			gauge("db_idle_connections", "Number of idle connections.", float64(stats.Idle)),
+			{Name: "db_wait_count_total", Help: "Number of connections waited for.", Type: TypeCounter,
+				Samples: []Sample{{Labels: labels, Value: float64(stats.WaitCount)}}},
+			{Name: "db_wait_duration_seconds_total", Help: "Time blocked waiting for connections.", Type: TypeCounter,
+				Samples: []Sample{{Labels: labels, Value: stats.WaitDuration.Seconds()}}},
+		}
+	})
+}
+
+// Redis collects the stats of the pool of the redis.<name> config
+func Redis(name string, pool *redis.Pool) Collector {
+	return CollectorFunc(func() []Family {
+		stats := pool.Stats()
+		labels := []Label{{Name: "redis", Value: name}}
+		return []Family{
+			{Name: "redis_active_connections", Help: "Number of connections in the pool, idle or in use.", Type: TypeGauge,
+				Samples: []Sample{{Labels: labels, Value: float64(stats.ActiveCount)}}},
+			{Name: "redis_idle_connections", Help: "Number of idle connections in the pool.", Type: TypeGauge,
+				Samples: []Sample{{Labels: labels, Value: float64(stats.IdleCount)}}},
+		}
+	})
+}
@@ -0,0 +1,186 @@
+package metrics
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultBuckets are the upper bounds, in seconds, of latency histograms
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// vec keeps a value per combination of label values
+type vec struct {
+	name   string
+	help   string
+	labels []string
+	mu     sync.Mutex
+	values map[string]*entry
+}
+
+type entry struct {
+	labels  []Label
+	value   float64
+	buckets []uint64
+	count   uint64
+}
+
+func newVec(name string, help string, labels []string) vec {
+	return vec{name: name, help: help, labels: labels, values: map[string]*entry{}}
+}
+
+// entry answers the entry of values, to be called with the lock held
+func (v *vec) entry(values []string) *entry {
+	if len(values) != len(v.labels) {
+		panic("metric " + v.name + " expects labels " + strings.Join(v.labels, ","))
+	}
+	key := strings.Join(values, "\xff")
+	e, ok := v.values[key]
+	if !ok {
+		e = &entry{labels: make([]Label, len(values))}
+		for i, value := range values {
+			e.labels[i] = Label{Name: v.labels[i], Value: value}
+		}
+		v.values[key] = e
+	}
+	return e
+}
+
+// sorted answers the entries ordered by their label values, to be called with the
+// lock held
+func (v *vec) sorted() []*entry {
+	keys := make([]string, 0, len(v.values))
+	for key := range v.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	entries := make([]*entry, len(keys))
+	for i, key := range keys {
+		entries[i] = v.values[key]
+	}
+	return entries
+}
+
+func (v *vec) collect(typ string) []Family {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	family := Family{Name: v.name, Help: v.help, Type: typ}
+	for _, e := range v.sorted() {
+		family.Samples = append(family.Samples, Sample{Labels: e.labels, Value: e.value})
+	}
+	return []Family{family}
+}
+
+// Counter counts events, by label values
+type Counter struct {
+	vec
+}
+
+func NewCounter(name string, help string, labels ...string) *Counter {
+	return &Counter{vec: newVec(name, help, labels)}
+}
+
+func (counter *Counter) Inc(labelValues ...string) {
+	counter.Add(1, labelValues...)
+}
+
+// Add adds delta, which must not be negative
+func (counter *Counter) Add(delta float64, labelValues ...string) {
+	if delta < 0 {
+		panic("counter " + counter.name + " cannot decrease")
+	}
+	counter.mu.Lock()
+	counter.entry(labelValues).value += delta
+	counter.mu.Unlock()
+}
+
+func (counter *Counter) Collect() []Family {
+	return counter.collect(TypeCounter)
+}
+
+// Gauge holds values going up and down, by label values
+type Gauge struct {
+	vec
+}
+
+func NewGauge(name string, help string, labels ...string) *Gauge {
+	return &Gauge{vec: newVec(name, help, labels)}
+}
+
+func (gauge *Gauge) Set(value float64, labelValues ...string) {
+	gauge.mu.Lock()
+	gauge.entry(labelValues).value = value
+	gauge.mu.Unlock()
+}
+
+func (gauge *Gauge) Add(delta float64, labelValues ...string) {
+	gauge.mu.Lock()
+	gauge.entry(labelValues).value += delta
+	gauge.mu.Unlock()
+}
+
+func (gauge *Gauge) Collect() []Family {
+	return gauge.collect(TypeGauge)
+}
+
+// Histogram counts observations in buckets, by label values
+type Histogram struct {
+	vec
+	buckets []float64
+}
+
+// NewHistogram answers a histogram with buckets, sorted upper bounds, DefaultBuckets
+// when nil
+func NewHistogram(name string, help string, buckets []float64, labels ...string) *Histogram {
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+	return &Histogram{vec: newVec(name, help, labels), buckets: buckets}
+}
+
+func (histogram *Histogram) Observe(value float64, labelValues ...string) {
+	histogram.mu.Lock()
+	defer histogram.mu.Unlock()
+	e := histogram.entry(labelValues)
+	if e.buckets == nil {
+		e.buckets = make([]uint64, len(histogram.buckets))
+	}
+	for i, bound := range histogram.buckets {
+		if value <= bound {
+			e.buckets[i]++
+			break
+		}
+	}
+	e.value += value
+	e.count++
+}
+
+// ObserveDuration observes d in seconds
+func (histogram *Histogram) ObserveDuration(d time.Duration, labelValues ...string) {
+	histogram.Observe(d.Seconds(), labelValues...)
+}
+
+func (histogram *Histogram) Collect() []Family {
+	histogram.mu.Lock()
+	defer histogram.mu.Unlock()
+	family := Family{Name: histogram.name, Help: histogram.help, Type: TypeHistogram}
+	for _, e := range histogram.sorted() {
+		var cumulative uint64
+		for i, bound := range histogram.buckets {
+			cumulative += e.buckets[i]
+			family.Samples = append(family.Samples, Sample{Suffix: "_bucket", Labels: withLe(e.labels, formatValue(bound)), Value: float64(cumulative)})
+		}
+		family.Samples = append(family.Samples,
+			Sample{Suffix: "_bucket", Labels: withLe(e.labels, formatValue(math.Inf(1))), Value: float64(e.count)},
+			Sample{Suffix: "_sum", Labels: e.labels, Value: e.value},
+			Sample{Suffix: "_count", Labels: e.labels, Value: float64(e.count)},
+		)
+	}
+	return []Family{family}
+}
+
+func withLe(labels []Label, le string) []Label {
+	return append(append(make([]Label, 0, len(labels)+1), labels...), Label{Name: "le", Value: le})
+}
@@ -5,10 +5,13 @@ import (
 	"reflect"
 	"time"
 
+	"github.com/sdjnlh/communal/db"
 	"github.com/sdjnlh/communal/errors"
 	"github.com/sdjnlh/communal/log"
+	"github.com/sdjnlh/communal/util"
 	"go.uber.org/zap"
 	"xorm.io/xorm"
+	"xorm.io/xorm/names"
 )
 
 type DBListener interface {
@@ -33,6 +36,13 @@ type Module struct {
 	DbOn   bool
 	DbName string
 	Db     *xorm.Engine
+
+	// Domain creates the domains of the module when it is served over rpc
+	Domain Domain
+
+	Relations    map[string]*Relation
+	StatColumns  []string
+	HistoryTable string
 }
 
 func NewModule(name string, tableName string, routePrefix string) *Module {
@@ -44,6 +54,16 @@ func NewModule(name string, tableName string, routePrefix string) *Module {
 	}
 }
 
+// GetModule gives access to the module embedded in module wrappers
+func (module *Module) GetModule() *Module {
+	return module
+}
+
+func (module *Module) SetDomain(domain Domain) *Module {
+	module.Domain = domain
+	return module
+}
+
 func (module *Module) SetDB(db *xorm.Engine) {
 	module.Db = db
 }
@@ -60,6 +80,13 @@ func (module *Module) DbEnabled() bool {
 	return module.DbOn
 }
 
+func (module *Module) columnMapper() names.Mapper {
+	if module.Db == nil {
+		return nil
+	}
+	return module.Db.GetColumnMapper()
+}
+
 func (module *Module) GetName() string {
 	return module.Name
 }
@@ -97,13 +124,35 @@ func (module *Module) Get(ctx context.Context, i interface{}, receiver *Result,
 		funcs[0](ss)
 	}
 	if _, err = ss.ID(id).Get(receiver.Data); err != nil {
-		log.Logger.Error("", zap.Error(err))
+		log.Ctx(ctx).Error("", zap.Error(err))
+		return err
+	}
+	if err = module.Expand(ctx, receiver.Data, ExpandFrom(ctx)...); err != nil {
 		return err
 	}
 	receiver.Success()
 	return
 }
 
+// Load reads the row of id from the table of the module into bean, skipping soft
+// deleted rows when the table has a dtd column
+func (module *Module) Load(ctx context.Context, id int64, bean interface{}) (bool, error) {
+	return module.load(module.Db.Context(ctx).Table(module.TableName).ID(id), bean)
+}
+
+func (module *Module) load(ss *xorm.Session, bean interface{}) (bool, error) {
+	if softDeletable(module.Db, bean) {
+		ss.Where(db.UndeletedCause)
+	}
+	return ss.Get(bean)
+}
+
+// softDeletable tells whether the table of bean has a dtd column
+func softDeletable(engine *xorm.Engine, bean interface{}) bool {
+	table, err := engine.TableInfo(bean)
+	return err == nil && table.GetColumn("dtd") != nil
+}
+
 func (module *Module) Create(ctx context.Context, domain interface{}, receiver *Result) (err error) {
 	_, err = module.Db.Insert(domain)
 	if err == nil {
@@ -115,7 +164,7 @@ func (module *Module) Create(ctx context.Context, domain interface{}, receiver *
 
 func (module *Module) List(ctx context.Context, filter Filter, result *FilterResult) (err error) {
 
-	log.Logger.Debug("filter list", zap.Any("filter", filter))
+	log.Ctx(ctx).Debug("filter list", zap.Any("filter", filter))
 
 	session := module.Db.Table(module.TableName).Desc("id")
 	filter.Apply(session)
@@ -123,6 +172,9 @@ func (module *Module) List(ctx context.Context, filter Filter, result *FilterRes
 	if err != nil {
 		return err
 	}
+	if err = module.Expand(ctx, result.Data, ExpandFrom(ctx)...); err != nil {
+		return err
+	}
 
 	result.Ok = true
 	result.Page = filter.GetPage()
@@ -217,20 +269,53 @@ func (module *Module) ListCondition(ctx context.Context, filter IFilter, result
 	return sqlSession
 }
 
-func (module *Module) Update(ctx context.Context, idm IdInf, result *Result) (err error) {
-	log.Logger.Debug("update ", zap.Any(module.Name, idm))
+// Update writes the non zero fields of idm, or exactly the given columns
+// (zero values included) when cols is not empty.
+func (module *Module) Update(ctx context.Context, idm IdInf, result *Result, cols ...string) (err error) {
+	log.Ctx(ctx).Debug("update ", zap.Any(module.Name, idm), zap.Strings("cols", cols))
 	if idm.GetId() <= 0 {
 		result.Failure(errors.InvalidParams())
 		return errors.InvalidParams()
 	}
-	if _, err = module.Db.ID(idm.GetId()).Update(idm); err != nil {
-		log.Logger.Error("fail to update item", zap.Error(err))
+	err = module.Track(ctx, HistoryUpdate, idm.GetId(), func(ss *xorm.Session) error {
+		return module.Write(ss, idm, cols...)
+	})
+	if err != nil {
+		log.Ctx(ctx).Error("fail to update item", zap.Error(err))
 		return err
 	}
 	result.Success()
 	return nil
 }
 
+// Write updates idm in ss as Update does, setting its Lut field, when it has one, to
+// the current time. Lut is kept to the second, as stored by TIMESTAMP columns.
+func (module *Module) Write(ss *xorm.Session, idm IdInf, cols ...string) error {
+	if touch(idm) && len(cols) > 0 && !util.StringArrayContains(cols, "lut") {
+		cols = append(cols, "lut")
+	}
+	ss.Table(module.TableName).ID(idm.GetId())
+	if len(cols) > 0 {
+		ss.Cols(cols...).MustCols(cols...)
+	}
+	_, err := ss.Update(idm)
+	return err
+}
+
+// touch sets the Lut field of domain to now, telling whether it has one
+func touch(domain interface{}) bool {
+	v := reflect.Indirect(reflect.ValueOf(domain))
+	if v.Kind() != reflect.Struct {
+		return false
+	}
+	field := v.FieldByName("Lut")
+	if !field.IsValid() || !field.CanSet() || field.Type() != reflect.TypeOf(time.Time{}) {
+		return false
+	}
+	field.Set(reflect.ValueOf(time.Now().Truncate(time.Second)))
+	return true
+}
+
 // Deprecated: Use Dtd instead.
 func (module *Module) Delete(ctx context.Context, id *int64, result *Result) (err error) {
 	return module.delete(ctx, *id, result, "status", 0)
@@ -246,8 +331,12 @@ func (module *Module) delete(ctx context.Context, id int64, result *Result, key
 		result.Failure(errors.InvalidParams())
 		return
 	}
-	if _, err = module.Db.Exec("update   `"+module.TableName+"`  set "+key+"=? ,lut=? where id = ?", value, time.Now(), id); err != nil {
-		log.Logger.Error("", zap.Error(err))
+	err = module.Track(ctx, HistoryDelete, id, func(ss *xorm.Session) error {
+		_, err := ss.Exec("update   `"+module.TableName+"`  set "+key+"=? ,lut=? where id = ?", value, time.Now(), id)
+		return err
+	})
+	if err != nil {
+		log.Ctx(ctx).Error("", zap.Error(err))
 		result.Failure(errors.InvalidParams())
 		return
 	}
@@ -0,0 +1,39 @@
+package communal
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sdjnlh/communal/internal/dbtest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestModule_Load(t *testing.T) {
+	type post struct {
+		DBase `xorm:"extends"`
+		Title string
+	}
+	type tag struct {
+		ID   `xorm:"extends"`
+		Name string
+	}
+
+	engine, db := dbtest.Open()
+	db.Rows("FROM `blog_post`", []string{"id", "title", "dtd"}, []interface{}{int64(3), "a", false})
+	module := NewModule("post", "blog_post", "/posts")
+	module.SetDB(engine)
+
+	p := &post{}
+	has, err := module.Load(context.Background(), 3, p)
+	assert.NoError(t, err)
+	assert.True(t, has)
+	assert.Equal(t, "a", p.Title)
+	assert.Contains(t, db.Statements()[0].SQL, "FROM `blog_post` WHERE (dtd=false) AND `id`=?")
+
+	tags := NewModule("tag", "blog_tag", "/tags")
+	tags.SetDB(engine)
+	has, err = tags.Load(context.Background(), 4, &tag{})
+	assert.NoError(t, err)
+	assert.False(t, has)
+	assert.NotContains(t, db.Statements()[1].SQL, "dtd")
+}
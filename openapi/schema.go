@@ -0,0 +1,191 @@
+package openapi
+
+import (
+	"encoding"
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sdjnlh/communal/util"
+)
+
+var (
+	timeType           = reflect.TypeOf(time.Time{})
+	jsonMarshalerType  = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType  = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	emptyInterfaceType = reflect.TypeOf((*interface{})(nil)).Elem()
+)
+
+// Schemas reflects struct types into the component schemas of a document
+type Schemas struct {
+	doc   *Document
+	names map[reflect.Type]string
+}
+
+func NewSchemas(doc *Document) *Schemas {
+	return &Schemas{doc: doc, names: map[reflect.Type]string{}}
+}
+
+// Of returns the schema of t, named structs are added to the components and referenced
+func (schemas *Schemas) Of(t reflect.Type) *Schema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == timeType || t.ConvertibleTo(timeType):
+		return &Schema{Type: "string", Format: "date-time"}
+	case t == emptyInterfaceType:
+		return &Schema{}
+	case t.Kind() != reflect.Struct && (t.Implements(jsonMarshalerType) || reflect.PtrTo(t).Implements(jsonMarshalerType)):
+		// custom encodings keep the shape of their kind at best
+		if t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+			return &Schema{Type: "array", Items: &Schema{}}
+		}
+	case t.Implements(textMarshalerType) || reflect.PtrTo(t).Implements(textMarshalerType):
+		return &Schema{Type: "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int64, reflect.Uint, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32:
+		return &Schema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: schemas.Of(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: schemas.Of(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return schemas.object(t)
+		}
+		return Ref(schemas.register(t))
+	}
+	return &Schema{}
+}
+
+func (schemas *Schemas) register(t reflect.Type) string {
+	if name, ok := schemas.names[t]; ok {
+		return name
+	}
+
+	name := t.Name()
+	for i := 2; schemas.doc.Components.Schemas[name] != nil; i++ {
+		name = t.Name() + strconv.Itoa(i)
+	}
+	schemas.names[t] = name
+	// placeholder first, so recursive types terminate
+	schemas.doc.Components.Schemas[name] = &Schema{Type: "object"}
+	schemas.doc.Components.Schemas[name] = schemas.object(t)
+	return name
+}
+
+// Put adds a schema under name unless it exists, e.g. for hand written schemas
+func (schemas *Schemas) Put(name string, schema *Schema) *Schema {
+	if schemas.doc.Components.Schemas[name] == nil {
+		schemas.doc.Components.Schemas[name] = schema
+	}
+	return Ref(name)
+}
+
+func (schemas *Schemas) object(t reflect.Type) *Schema {
+	schema := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	for _, field := range util.StructFields(t, nil) {
+		if field.Json == "" {
+			continue
+		}
+
+		prop := schemas.Of(field.Type)
+		if jsonString(field.Tag) && prop.Type == "integer" {
+			prop = &Schema{Type: "string", Format: prop.Format}
+		}
+		if applyRules(prop, field.Tag.Get("valid")) {
+			schema.Required = append(schema.Required, field.Json)
+		}
+		schema.Properties[field.Json] = prop
+	}
+	return schema
+}
+
+func jsonString(tag reflect.StructTag) bool {
+	parts := strings.Split(tag.Get("json"), ",")
+	for _, opt := range parts[1:] {
+		if opt == "string" {
+			return true
+		}
+	}
+	return false
+}
+
+// applyRules translates the default rule set of a valid tag to constraints of
+// the schema, true is returned for required fields.
+func applyRules(schema *Schema, tag string) (required bool) {
+	for _, nameRules := range strings.Split(tag, "+") {
+		if strings.Contains(nameRules, "~") || strings.TrimSpace(nameRules) == "" {
+			continue
+		}
+		for _, r := range strings.Split(nameRules, ",") {
+			r = strings.TrimSpace(r)
+			switch {
+			case r == "required":
+				required = true
+			case r == "email":
+				schema.Format = "email"
+			case r == "url":
+				schema.Format = "uri"
+			case r == "int":
+				schema.Pattern = `^[-+]?\d+$`
+			case r == "numeric":
+				schema.Pattern = `^\d+$`
+			case strings.HasPrefix(r, "range(") && strings.HasSuffix(r, ")"):
+				params := strings.Split(r[len("range("):len(r)-1], "|")
+				if len(params) == 2 {
+					if min, err := strconv.ParseFloat(params[0], 64); err == nil {
+						schema.Minimum = &min
+					}
+					if max, err := strconv.ParseFloat(params[1], 64); err == nil {
+						schema.Maximum = &max
+					}
+				}
+			}
+		}
+	}
+	return required
+}
+
+// QueryParameters reflects the form tagged fields of a struct as query parameters
+func (schemas *Schemas) QueryParameters(t reflect.Type) []*Parameter {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+
+	var params []*Parameter
+	for _, field := range util.StructFields(t, nil) {
+		name := strings.Split(field.Tag.Get("form"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+		schema := schemas.Of(field.Type)
+		if schema.Ref != "" {
+			continue
+		}
+		params = append(params, &Parameter{Name: name, In: "query", Schema: schema})
+	}
+	return params
+}
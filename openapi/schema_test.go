@@ -0,0 +1,62 @@
+package openapi
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type base struct {
+	Id int64 `json:"id,string"`
+}
+
+type tag struct {
+	Name string `json:"name"`
+}
+
+type article struct {
+	base   `xorm:"extends"`
+	Title  string            `json:"title" valid:"required"`
+	Email  string            `json:"email" valid:"email+update~required"`
+	Rate   int               `json:"rate" valid:"range(1|5)"`
+	Tags   []*tag            `json:"tags"`
+	Props  map[string]string `json:"props"`
+	Crt    time.Time         `json:"crt"`
+	Secret string            `json:"-"`
+	Parent *article          `json:"parent,omitempty"`
+}
+
+func TestSchemas_Of(t *testing.T) {
+	doc := NewDocument(Info{Title: "test", Version: "1"})
+	schemas := NewSchemas(doc)
+
+	assert.Equal(t, Ref("article"), schemas.Of(reflect.TypeOf(&article{})))
+	schema := doc.Components.Schemas["article"]
+	assert.Equal(t, []string{"title"}, schema.Required)
+	assert.Equal(t, &Schema{Type: "string", Format: "int64"}, schema.Properties["id"])
+	assert.Equal(t, "email", schema.Properties["email"].Format)
+	assert.Equal(t, 1.0, *schema.Properties["rate"].Minimum)
+	assert.Equal(t, 5.0, *schema.Properties["rate"].Maximum)
+	assert.Equal(t, Ref("tag"), schema.Properties["tags"].Items)
+	assert.Equal(t, "string", schema.Properties["props"].AdditionalProperties.Type)
+	assert.Equal(t, "date-time", schema.Properties["crt"].Format)
+	assert.Equal(t, Ref("article"), schema.Properties["parent"])
+	assert.NotContains(t, schema.Properties, "Secret")
+	assert.Contains(t, doc.Components.Schemas, "tag")
+}
+
+func TestSchemas_QueryParameters(t *testing.T) {
+	type filter struct {
+		Keyword string `form:"k"`
+		P       int    `form:"p"`
+		Ignored string
+	}
+
+	params := NewSchemas(NewDocument(Info{})).QueryParameters(reflect.TypeOf(&filter{}))
+	assert.Len(t, params, 2)
+	assert.Equal(t, "k", params[0].Name)
+	assert.Equal(t, "query", params[0].In)
+	assert.Equal(t, "integer", params[1].Schema.Type)
+}
@@ -0,0 +1,205 @@
+package communal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"reflect"
+	"sort"
+
+	"github.com/sdjnlh/communal/errors"
+	"github.com/sdjnlh/communal/util"
+	"github.com/sdjnlh/communal/validator"
+	"xorm.io/xorm"
+)
+
+// MergePatch applies a JSON merge patch (RFC 7386) to the target document.
+func MergePatch(target []byte, patch []byte) ([]byte, error) {
+	var t, p interface{}
+	if len(target) > 0 {
+		if err := json.Unmarshal(target, &t); err != nil {
+			return nil, err
+		}
+	}
+	if err := json.Unmarshal(patch, &p); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(mergePatch(t, p))
+}
+
+func mergePatch(target interface{}, patch interface{}) interface{} {
+	pm, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	tm, ok := target.(map[string]interface{})
+	if !ok {
+		tm = map[string]interface{}{}
+	}
+
+	for key, value := range pm {
+		if value == nil {
+			delete(tm, key)
+		} else {
+			tm[key] = mergePatch(tm[key], value)
+		}
+	}
+	return tm
+}
+
+// PatchKeys returns the top level member names of a merge patch document,
+// the patch must be a json object.
+func PatchKeys(patch []byte) ([]string, error) {
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(patch, &members); err != nil || members == nil {
+		return nil, errors.InvalidParams().AddError(errors.InvalidField("body", errors.FIELD_BAD_FORMAT, "merge patch must be a json object"))
+	}
+
+	keys := make([]string, 0, len(members))
+	for key := range members {
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// ServerColumns are set by the server, never written from requests or imports
+var ServerColumns = []string{"id", "crt", "lut", "status", "dtd"}
+
+// Columns maps json keys of the domain to table columns and struct field names,
+// unknown keys and the read only ServerColumns are reported as invalid params.
+func (module *Module) Columns(domain interface{}, jsonKeys ...string) (columns []string, fields []string, err error) {
+	var mapper = module.columnMapper()
+	structFields := util.StructFields(reflect.TypeOf(domain), mapper)
+
+	verr := errors.InvalidParams()
+	for _, key := range jsonKeys {
+		field, ok := util.FieldByJson(structFields, key)
+		if !ok || field.Column == "" {
+			verr.AddError(errors.InvalidField(key, "unknown", "unknown field"))
+			continue
+		}
+		if util.StringArrayContains(ServerColumns, field.Column) {
+			verr.AddError(errors.InvalidField(key, "readonly", "field can not be updated"))
+			continue
+		}
+		columns = append(columns, field.Column)
+		fields = append(fields, field.Name)
+	}
+
+	if verr.HasError() {
+		return nil, nil, verr
+	}
+	return
+}
+
+// PatchChecks are run by Module.Patch: Loaded on the current domain before the patch is
+// merged into it, Merged on the patched domain before it is written. They may change
+// the domains, and fail the patch with their errors.
+type PatchChecks struct {
+	Loaded func(current IdInf) error
+	Merged func(patched IdInf) error
+}
+
+// Patch applies the JSON merge patch (RFC 7386) to the domain of id, writing exactly
+// the columns present in the patch and those changed by checks. The domains are made
+// by create, the current one is locked from its load until the patched one is written.
+func (module *Module) Patch(ctx context.Context, id int64, patch []byte, create func() (IdInf, error), checks PatchChecks) (IdInf, error) {
+	keys, err := PatchKeys(patch)
+	if err != nil {
+		return nil, err
+	}
+	current, err := create()
+	if err != nil {
+		return nil, err
+	}
+
+	var patched IdInf
+	var cols []string
+	err = module.TrackIf(ctx, HistoryUpdate, id, current, func() error {
+		if checks.Loaded != nil {
+			if err := checks.Loaded(current); err != nil {
+				return err
+			}
+		}
+		loaded, err := json.Marshal(current)
+		if err != nil {
+			return err
+		}
+		if patched, err = create(); err != nil {
+			return err
+		}
+		if err = MergeDomain(current, patch, patched); err != nil {
+			return err
+		}
+		patched.SetId(id)
+
+		var fields []string
+		if cols, fields, err = module.Columns(patched, keys...); err != nil {
+			return err
+		}
+		if err = validator.ValidateFields(patched, "", fields...); err != nil {
+			return err
+		}
+		if checks.Merged != nil {
+			if err = checks.Merged(patched); err != nil {
+				return err
+			}
+		}
+		cols, err = module.changedColumns(loaded, patched, cols)
+		return err
+	}, func(ss *xorm.Session) error {
+		return module.Write(ss, patched, cols...)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return patched, nil
+}
+
+// MergeDomain decodes into the json of current merged with the patch
+func MergeDomain(current interface{}, patch []byte, into interface{}) error {
+	doc, err := json.Marshal(current)
+	if err != nil {
+		return err
+	}
+	if doc, err = MergePatch(doc, patch); err != nil {
+		return errors.InvalidParams()
+	}
+	if err = json.Unmarshal(doc, into); err != nil {
+		return &errors.SimpleBizError{Code: errors.Common_InvalidParams, Msg: err.Error()}
+	}
+	return nil
+}
+
+// changedColumns adds to cols the columns of the fields of domain which differ from doc,
+// the json of the domain loaded, as checks may change fields the patch has not
+func (module *Module) changedColumns(doc []byte, domain interface{}, cols []string) ([]string, error) {
+	changed, err := json.Marshal(domain)
+	if err != nil {
+		return nil, err
+	}
+	var before, after map[string]json.RawMessage
+	if err = json.Unmarshal(doc, &before); err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(changed, &after); err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(after))
+	for key, value := range after {
+		if !bytes.Equal(before[key], value) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		// fields which are no writable columns are left to the checks
+		if col, _, err := module.Columns(domain, key); err == nil && !util.StringArrayContains(cols, col[0]) {
+			cols = append(cols, col[0])
+		}
+	}
+	return cols, nil
+}
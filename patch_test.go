@@ -0,0 +1,108 @@
+package communal
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sdjnlh/communal/errors"
+	"github.com/sdjnlh/communal/internal/dbtest"
+	"github.com/sdjnlh/communal/log"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestMergePatch(t *testing.T) {
+	cases := []struct {
+		target string
+		patch  string
+		want   string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`{"e":null}`, `{"a":1}`, `{"a":1,"e":null}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	}
+
+	for _, cs := range cases {
+		merged, err := MergePatch([]byte(cs.target), []byte(cs.patch))
+		assert.Nil(t, err)
+		assert.JSONEq(t, cs.want, string(merged), cs.target+" + "+cs.patch)
+	}
+}
+
+type patchDomain struct {
+	Base    `xorm:"extends"`
+	Title   string `json:"title"`
+	Visible bool   `json:"visible"`
+	Secret  string `json:"-"`
+	Extra   string `xorm:"-" json:"extra"`
+}
+
+func TestModule_Columns(t *testing.T) {
+	module := NewModule("article", "article", "/articles")
+
+	cols, fields, err := module.Columns(&patchDomain{}, "title", "visible")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"title", "visible"}, cols)
+	assert.Equal(t, []string{"Title", "Visible"}, fields)
+
+	_, _, err = module.Columns(&patchDomain{}, "id", "extra", "nope")
+	assert.NotNil(t, err)
+	for _, key := range ServerColumns {
+		_, _, err = module.Columns(&patchDomain{}, key)
+		assert.NotNil(t, err, key)
+	}
+
+	_, err = PatchKeys([]byte(`[1]`))
+	assert.NotNil(t, err)
+}
+
+type patchArticle struct {
+	DBase `xorm:"extends"`
+	Title string `json:"title" valid:"required"`
+	Body  string `json:"body"`
+	Views int64  `json:"views"`
+}
+
+func TestModule_Patch(t *testing.T) {
+	log.Logger.Logger = zap.NewNop()
+	engine, db := dbtest.Open()
+	db.Rows("FROM `article`", []string{"id", "title", "body", "views"}, []interface{}{int64(3), "go", "text", int64(9)})
+	module := NewModule("article", "article", "/articles")
+	module.SetDB(engine)
+	create := func() (IdInf, error) { return &patchArticle{}, nil }
+
+	var loaded string
+	patched, err := module.Patch(context.Background(), 3, []byte(`{"title":"rust"}`), create, PatchChecks{
+		Loaded: func(current IdInf) error {
+			loaded = current.(*patchArticle).Title
+			return nil
+		},
+		Merged: func(patched IdInf) error {
+			patched.(*patchArticle).Body = "rewritten"
+			return nil
+		},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "go", loaded)
+	assert.Equal(t, "rust", patched.(*patchArticle).Title)
+	assert.Equal(t, int64(9), patched.(*patchArticle).Views)
+
+	updates := db.Find("UPDATE `article`")
+	assert.Len(t, updates, 1)
+	assert.Contains(t, updates[0].SQL, "`title` = ?")
+	assert.Contains(t, updates[0].SQL, "`body` = ?", "columns changed by checks are written")
+	assert.NotContains(t, updates[0].SQL, "`views`")
+
+	_, err = module.Patch(context.Background(), 3, []byte(`{"title":"c"}`), create, PatchChecks{
+		Merged: func(patched IdInf) error { return errors.Forbidden() },
+	})
+	assert.True(t, errors.HasCode(err, errors.Common_Forbidden))
+	assert.Len(t, db.Find("UPDATE `article`"), 1)
+}
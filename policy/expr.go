@@ -0,0 +1,412 @@
+package policy
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Expr compiles a policy from an expression comparing the fields of the entity with
+// the claims of the user, e.g.
+//
+//	entity.uid == user.uid || user.role == "admin"
+//	entity.orgId == user.orgId && entity.status in [1, 2]
+//	user.group in entity.groups
+//
+// Paths start with entity or user and read fields like Field does. Operators are ==,
+// !=, <, <=, >, >=, in, &&, || and !, literals are numbers, 'strings' or "strings",
+// lists of literals or paths, true, false and null. Values are compared like Equal
+// does. Missing fields and claims are nil, comparing them answers unknown, but with
+// null, and unknown stays unknown through !, && and || unless decided by the other
+// operand, so that a missing value never allows. The policy allows when the
+// expression is exactly true.
+func Expr(name string, expr string) (Policy, error) {
+	tokens, err := lex(expr)
+	if err != nil {
+		return nil, fmt.Errorf("policy %s: %v", name, err)
+	}
+	p := &parser{tokens: tokens}
+	root, err := p.or()
+	if err == nil && p.peek().kind != tokenEnd {
+		err = p.errorf("unexpected %q", p.peek().text)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("policy %s: %v", name, err)
+	}
+	return New(name, func(subject Subject, entity interface{}) bool {
+		return root(&env{subject: subject, entity: entity}) == true
+	}), nil
+}
+
+// MustExpr is Expr, panicking on invalid expressions, for policies declared in code
+func MustExpr(name string, expr string) Policy {
+	p, err := Expr(name, expr)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+type env struct {
+	subject Subject
+	entity  interface{}
+}
+
+type node func(e *env) interface{}
+
+type tokenKind int8
+
+const (
+	tokenEnd tokenKind = iota
+	tokenIdent
+	tokenNumber
+	tokenString
+	tokenOp
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+var operators = []string{"==", "!=", "<=", ">=", "&&", "||", "<", ">", "!", "(", ")", "[", "]", ",", "."}
+
+func lex(src string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(src); {
+		ch := src[i]
+		switch {
+		case ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r':
+			i++
+		case isLetter(ch):
+			j := i + 1
+			for j < len(src) && (isLetter(src[j]) || isDigit(src[j])) {
+				j++
+			}
+			tokens = append(tokens, token{kind: tokenIdent, text: src[i:j], pos: i})
+			i = j
+		case isDigit(ch) || (ch == '-' && i+1 < len(src) && isDigit(src[i+1])):
+			j := i + 1
+			for j < len(src) && (isDigit(src[j]) || src[j] == '.') {
+				j++
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: src[i:j], pos: i})
+			i = j
+		case ch == '"' || ch == '\'':
+			sb := strings.Builder{}
+			j := i + 1
+			for ; j < len(src) && src[j] != ch; j++ {
+				if src[j] == '\\' && j+1 < len(src) {
+					j++
+				}
+				sb.WriteByte(src[j])
+			}
+			if j >= len(src) {
+				return nil, fmt.Errorf("unterminated string at %d", i)
+			}
+			tokens = append(tokens, token{kind: tokenString, text: sb.String(), pos: i})
+			i = j + 1
+		default:
+			op := ""
+			for _, o := range operators {
+				if strings.HasPrefix(src[i:], o) {
+					op = o
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("unexpected %q at %d", ch, i)
+			}
+			tokens = append(tokens, token{kind: tokenOp, text: op, pos: i})
+			i += len(op)
+		}
+	}
+	return append(tokens, token{kind: tokenEnd, pos: len(src)}), nil
+}
+
+func isLetter(ch byte) bool {
+	return ch == '_' || (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z')
+}
+
+func isDigit(ch byte) bool {
+	return ch >= '0' && ch <= '9'
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEnd {
+		p.pos++
+	}
+	return t
+}
+
+// accept consumes the operator op when it is next
+func (p *parser) accept(op string) bool {
+	if t := p.peek(); (t.kind == tokenOp || t.kind == tokenIdent) && t.text == op {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf(format+" at %d", append(args, p.peek().pos)...)
+}
+
+func (p *parser) or() (node, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("||") {
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(e *env) interface{} {
+			a, aKnown := truth(l(e))
+			if aKnown && a {
+				return true
+			}
+			b, bKnown := truth(right(e))
+			if bKnown && b {
+				return true
+			}
+			if aKnown && bKnown {
+				return false
+			}
+			return nil
+		}
+	}
+	return left, nil
+}
+
+func (p *parser) and() (node, error) {
+	left, err := p.not()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("&&") {
+		right, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(e *env) interface{} {
+			a, aKnown := truth(l(e))
+			if aKnown && !a {
+				return false
+			}
+			b, bKnown := truth(right(e))
+			if bKnown && !b {
+				return false
+			}
+			if aKnown && bKnown {
+				return true
+			}
+			return nil
+		}
+	}
+	return left, nil
+}
+
+func (p *parser) not() (node, error) {
+	if p.accept("!") {
+		operand, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		return func(e *env) interface{} {
+			if value, known := truth(operand(e)); known {
+				return !value
+			}
+			return nil
+		}, nil
+	}
+	return p.comparison()
+}
+
+func (p *parser) comparison() (node, error) {
+	left, err := p.operand()
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range []string{"==", "!=", "<=", ">=", "<", ">", "in"} {
+		if !p.accept(op) {
+			continue
+		}
+		right, err := p.operand()
+		if err != nil {
+			return nil, err
+		}
+		return compareNode(op, left, right), nil
+	}
+	return left, nil
+}
+
+// compareNode answers unknown, nil, when a value is nil, but compared with the null
+// literal by == or !=
+func compareNode(op string, left node, right node) node {
+	return func(e *env) interface{} {
+		a, b := left(e), right(e)
+		_, aNull := a.(null)
+		_, bNull := b.(null)
+		if aNull || bNull {
+			matched := (aNull || isNil(a)) && (bNull || isNil(b))
+			switch op {
+			case "==":
+				return matched
+			case "!=":
+				return !matched
+			}
+			return nil
+		}
+		if isNil(a) || isNil(b) {
+			return nil
+		}
+
+		switch op {
+		case "==":
+			return Equal(a, b)
+		case "!=":
+			return !Equal(a, b)
+		case "in":
+			return In(a, b)
+		}
+		order, ok := compare(a, b)
+		if !ok {
+			return false
+		}
+		switch op {
+		case "<":
+			return order < 0
+		case "<=":
+			return order <= 0
+		case ">":
+			return order > 0
+		}
+		return order >= 0
+	}
+}
+
+func (p *parser) operand() (node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenNumber:
+		if i, err := strconv.ParseInt(t.text, 10, 64); err == nil {
+			return constant(i), nil
+		}
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q at %d", t.text, t.pos)
+		}
+		return constant(f), nil
+	case tokenString:
+		return constant(t.text), nil
+	case tokenIdent:
+		switch t.text {
+		case "true":
+			return constant(true), nil
+		case "false":
+			return constant(false), nil
+		case "null":
+			return constant(null{}), nil
+		case "entity", "user":
+			return p.path(t.text)
+		}
+		return nil, fmt.Errorf("unknown %q at %d, paths start with entity or user", t.text, t.pos)
+	case tokenOp:
+		switch t.text {
+		case "(":
+			inner, err := p.or()
+			if err != nil {
+				return nil, err
+			}
+			if !p.accept(")") {
+				return nil, p.errorf("missing )")
+			}
+			return inner, nil
+		case "[":
+			return p.list()
+		}
+	}
+	if t.kind == tokenEnd {
+		return nil, fmt.Errorf("unexpected end at %d", t.pos)
+	}
+	return nil, fmt.Errorf("unexpected %q at %d", t.text, t.pos)
+}
+
+func (p *parser) path(root string) (node, error) {
+	var fields []string
+	for p.accept(".") {
+		t := p.next()
+		if t.kind != tokenIdent {
+			return nil, fmt.Errorf("field expected at %d", t.pos)
+		}
+		fields = append(fields, t.text)
+	}
+	if len(fields) == 0 {
+		return nil, p.errorf("field of %s expected", root)
+	}
+	path := strings.Join(fields, ".")
+	if root == "user" {
+		return func(e *env) interface{} {
+			value, _ := Field(map[string]interface{}(e.subject), path)
+			return value
+		}, nil
+	}
+	return func(e *env) interface{} {
+		value, _ := Field(e.entity, path)
+		return value
+	}, nil
+}
+
+func (p *parser) list() (node, error) {
+	var items []node
+	if !p.accept("]") {
+		for {
+			item, err := p.operand()
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+			if p.accept("]") {
+				break
+			}
+			if !p.accept(",") {
+				return nil, p.errorf("missing ]")
+			}
+		}
+	}
+	return func(e *env) interface{} {
+		values := make([]interface{}, len(items))
+		for i, item := range items {
+			values[i] = item(e)
+		}
+		return values
+	}, nil
+}
+
+// null is the value of the null literal, equal to nil values, which Equal never is
+type null struct{}
+
+// truth reads a condition, known when it is a boolean
+func truth(value interface{}) (b bool, known bool) {
+	b, known = value.(bool)
+	return
+}
+
+func constant(value interface{}) node {
+	return func(e *env) interface{} { return value }
+}
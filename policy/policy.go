@@ -0,0 +1,168 @@
+// Package policy authorizes users on the entities they access, comparing the fields of
+// entities, like the owner uid, org id or status, with the claims of users. Policies are
+// Go functions or expressions, see Expr.
+package policy
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/sdjnlh/communal"
+)
+
+// the claims of users read by the policies of the package
+const (
+	UidKey   = communal.UserIdKey
+	OrgIdKey = communal.UserOrgIdKey
+	RoleKey  = "role"
+	GroupKey = "group"
+)
+
+// Subject holds the claims of the user a policy is checked for
+type Subject map[string]interface{}
+
+type Policy interface {
+	// Name of the policy, logged when it denies
+	Name() string
+	Allow(subject Subject, entity interface{}) bool
+}
+
+type funcPolicy struct {
+	name  string
+	allow func(subject Subject, entity interface{}) bool
+}
+
+func (p *funcPolicy) Name() string {
+	return p.name
+}
+
+func (p *funcPolicy) Allow(subject Subject, entity interface{}) bool {
+	return p.allow(subject, entity)
+}
+
+// New answers a policy allowing what allow does
+func New(name string, allow func(subject Subject, entity interface{}) bool) Policy {
+	return &funcPolicy{name: name, allow: allow}
+}
+
+// Owner allows users whose uid is the field of the entity. Users whose uid is 0 or
+// less are anonymous, they own nothing.
+func Owner(field string) Policy {
+	return New("owner", func(subject Subject, entity interface{}) bool {
+		uid, isNumber := numberOf(subject[UidKey])
+		if !isNumber || uid.float() <= 0 {
+			return false
+		}
+		owner, ok := Field(entity, field)
+		return ok && Equal(owner, subject[UidKey])
+	})
+}
+
+// SameOrg allows users whose org id is the field of the entity
+func SameOrg(field string) Policy {
+	return New("sameOrg", func(subject Subject, entity interface{}) bool {
+		org, ok := Field(entity, field)
+		return ok && subject[OrgIdKey] != nil && Equal(org, subject[OrgIdKey])
+	})
+}
+
+// Role allows users having one of roles, their role claim being a role, a comma
+// separated string or a list of roles
+func Role(roles ...string) Policy {
+	return New("role", func(subject Subject, entity interface{}) bool {
+		for _, role := range roles {
+			if In(role, subject[RoleKey]) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// AnyOf allows what one of policies allows
+func AnyOf(name string, policies ...Policy) Policy {
+	return New(name, func(subject Subject, entity interface{}) bool {
+		for _, p := range policies {
+			if p.Allow(subject, entity) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// AllOf allows what all of policies allow
+func AllOf(name string, policies ...Policy) Policy {
+	return New(name, func(subject Subject, entity interface{}) bool {
+		for _, p := range policies {
+			if !p.Allow(subject, entity) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// Field answers the value at path, a dot separated list of fields, of value. Fields
+// of structs are matched by their name, case insensitively, or their json name,
+// looking into embedded structs. Maps are read by key.
+func Field(value interface{}, path string) (interface{}, bool) {
+	v := reflect.ValueOf(value)
+	for _, name := range strings.Split(path, ".") {
+		var ok bool
+		if v, ok = field(v, name); !ok {
+			return nil, false
+		}
+	}
+	if !v.IsValid() {
+		return nil, true
+	}
+	if !v.CanInterface() {
+		return nil, false
+	}
+	return v.Interface(), true
+}
+
+func field(v reflect.Value, name string) (reflect.Value, bool) {
+	v = indirect(v)
+	switch v.Kind() {
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return reflect.Value{}, false
+		}
+		value := v.MapIndex(reflect.ValueOf(name).Convert(v.Type().Key()))
+		if !value.IsValid() {
+			return reflect.Value{}, false
+		}
+		return value, true
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.PkgPath != "" && !f.Anonymous {
+				continue
+			}
+			if f.Anonymous {
+				if value, ok := field(v.Field(i), name); ok {
+					return value, true
+				}
+				continue
+			}
+			jsonName := strings.Split(f.Tag.Get("json"), ",")[0]
+			if strings.EqualFold(f.Name, name) || jsonName == name {
+				return v.Field(i), true
+			}
+		}
+	}
+	return reflect.Value{}, false
+}
+
+func indirect(v reflect.Value) reflect.Value {
+	for v.IsValid() && (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) {
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+		v = v.Elem()
+	}
+	return v
+}
@@ -0,0 +1,115 @@
+package policy
+
+import (
+	"testing"
+
+	"github.com/sdjnlh/communal"
+	"github.com/stretchr/testify/assert"
+)
+
+type article struct {
+	communal.ID `xorm:"extends"`
+	Uid         int64    `json:"uid,string"`
+	OrgId       int64    `json:"org,string"`
+	Status      int      `json:"status"`
+	Groups      []string `json:"groups"`
+}
+
+func TestField(t *testing.T) {
+	a := &article{ID: communal.ID{Id: 7}, OrgId: 3}
+	value, ok := Field(a, "id")
+	assert.True(t, ok)
+	assert.Equal(t, int64(7), value)
+	value, ok = Field(a, "org")
+	assert.True(t, ok)
+	assert.Equal(t, int64(3), value)
+	_, ok = Field(a, "missing")
+	assert.False(t, ok)
+	value, ok = Field(map[string]interface{}{"author": map[string]interface{}{"uid": "5"}}, "author.uid")
+	assert.True(t, ok)
+	assert.Equal(t, "5", value)
+}
+
+func TestEqual(t *testing.T) {
+	assert.True(t, Equal(int64(1234567890123456789), "1234567890123456789"))
+	assert.True(t, Equal(float64(3), 3))
+	assert.True(t, Equal("a", "a"))
+	assert.False(t, Equal("07", "7"))
+	assert.False(t, Equal(nil, 0))
+	assert.False(t, Equal(nil, nil))
+	assert.False(t, Equal(nil, (*int)(nil)))
+
+	assert.True(t, In("news", []string{"sport", "news"}))
+	assert.True(t, In("news", "sport, news"))
+	assert.False(t, In("new", "sport,news"))
+	assert.False(t, In(nil, []interface{}{nil}))
+}
+
+func TestPolicies(t *testing.T) {
+	a := &article{Uid: 5, OrgId: 3, Status: 1}
+	owner := Subject{UidKey: int64(5)}
+	member := Subject{UidKey: int64(6), OrgIdKey: float64(3), RoleKey: []interface{}{"member"}}
+	admin := Subject{UidKey: int64(8), RoleKey: "admin"}
+
+	assert.True(t, Owner("uid").Allow(owner, a))
+	assert.False(t, Owner("uid").Allow(member, a))
+	assert.False(t, Owner("uid").Allow(Subject{}, &article{}))
+	assert.False(t, Owner("uid").Allow(Subject{UidKey: int64(0)}, &article{}), "anonymous users own nothing")
+	assert.False(t, Owner("uid").Allow(Subject{UidKey: "-1"}, &article{Uid: -1}))
+	assert.True(t, Owner("uid").Allow(Subject{UidKey: "5"}, a))
+	assert.True(t, SameOrg("orgId").Allow(member, a))
+	assert.False(t, SameOrg("orgId").Allow(owner, a))
+	assert.True(t, Role("member").Allow(member, a))
+	assert.False(t, Role("min").Allow(admin, a))
+	assert.True(t, Role("editor").Allow(Subject{RoleKey: "author,editor"}, a))
+	assert.False(t, Owner("missing").Allow(Subject{}, map[string]interface{}{"missing": nil}))
+
+	editable := AnyOf("editable", Owner("uid"), Role("admin"))
+	assert.True(t, editable.Allow(owner, a))
+	assert.True(t, editable.Allow(admin, a))
+	assert.False(t, editable.Allow(member, a))
+	assert.False(t, AllOf("both", Owner("uid"), SameOrg("orgId")).Allow(owner, a))
+}
+
+func TestExpr(t *testing.T) {
+	a := &article{Uid: 5, OrgId: 3, Status: 1, Groups: []string{"news"}}
+	cases := []struct {
+		expr    string
+		subject Subject
+		allowed bool
+	}{
+		{`entity.uid == user.uid`, Subject{"uid": int64(5)}, true},
+		{`entity.uid == user.uid`, Subject{"uid": int64(6)}, false},
+		{`entity.uid == user.uid || user.role == "admin"`, Subject{"uid": int64(6), "role": "admin"}, true},
+		{`entity.orgId == user.orgId && entity.status in [1, 2]`, Subject{"orgId": "3"}, true},
+		{`entity.orgId == user.orgId && !(entity.status in [1, 2])`, Subject{"orgId": "3"}, false},
+		{`user.group in entity.groups`, Subject{"group": "news"}, true},
+		{`user.group in entity.groups`, Subject{}, false},
+		{`entity.status >= 1 && entity.status < 2`, Subject{}, true},
+		{`user.orgId != null`, Subject{}, false},
+		{`entity.missing == null`, Subject{}, true},
+		{`entity.missing == user.uid`, Subject{}, false},
+		{`entity.missing != user.uid`, Subject{}, false},
+		{`entity.uid != user.uid`, Subject{"uid": int64(6)}, true},
+		{`null == null`, Subject{}, true},
+		{`!(entity.orgId == user.orgId)`, Subject{}, false},
+		{`!(entity.orgId == user.orgId)`, Subject{"orgId": "4"}, true},
+		{`!(entity.missing > 1) || entity.uid == user.uid`, Subject{"uid": int64(6)}, false},
+		{`!(entity.missing > 1) || entity.uid == user.uid`, Subject{"uid": int64(5)}, true},
+		{`!(entity.missing > 1 && entity.status == 2)`, Subject{}, true},
+		{`!(user.group in entity.groups)`, Subject{}, false},
+		{`entity.status > 'a'`, Subject{}, false},
+	}
+	for _, c := range cases {
+		p, err := Expr("test", c.expr)
+		if assert.NoError(t, err, c.expr) {
+			assert.Equal(t, c.allowed, p.Allow(c.subject, a), c.expr)
+		}
+	}
+
+	for _, expr := range []string{``, `entity`, `uid == 1`, `entity.uid ==`, `(entity.uid == 1`, `entity.uid == "1`, `[1, 2`, `entity.uid == 1 1`, `entity.uid # 1`} {
+		_, err := Expr("invalid", expr)
+		assert.Error(t, err, expr)
+	}
+	assert.Panics(t, func() { MustExpr("invalid", "entity.") })
+}
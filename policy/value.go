@@ -0,0 +1,133 @@
+package policy
+
+import (
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// number is an integer, exactly, or a float
+type number struct {
+	i       int64
+	f       float64
+	isFloat bool
+}
+
+func (n number) float() float64 {
+	if n.isFloat {
+		return n.f
+	}
+	return float64(n.i)
+}
+
+// numberOf reads numbers, from strings too, as ids are sent as strings in JSON
+func numberOf(value interface{}) (number, bool) {
+	v := indirect(reflect.ValueOf(value))
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return number{i: v.Int()}, true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return number{i: int64(v.Uint())}, true
+	case reflect.Float32, reflect.Float64:
+		f := v.Float()
+		if f == math.Trunc(f) && math.Abs(f) < 1<<63 {
+			return number{i: int64(f)}, true
+		}
+		return number{f: f, isFloat: true}, true
+	case reflect.String:
+		s := strings.TrimSpace(v.String())
+		if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return number{i: i}, true
+		}
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return number{f: f, isFloat: true}, true
+		}
+	}
+	return number{}, false
+}
+
+func isNil(value interface{}) bool {
+	return !indirect(reflect.ValueOf(value)).IsValid()
+}
+
+func isString(value interface{}) bool {
+	return indirect(reflect.ValueOf(value)).Kind() == reflect.String
+}
+
+// Equal compares values loosely: numbers by value whatever their type, strings holding
+// numbers with numbers, pointers by the values they point to. Nil values, like missing
+// fields or claims, equal nothing, not even nil, so that policies deny when they lack.
+func Equal(a interface{}, b interface{}) bool {
+	if isNil(a) || isNil(b) {
+		return false
+	}
+	if isString(a) && isString(b) {
+		return indirect(reflect.ValueOf(a)).String() == indirect(reflect.ValueOf(b)).String()
+	}
+	if na, ok := numberOf(a); ok {
+		if nb, ok := numberOf(b); ok {
+			return compareNumbers(na, nb) == 0
+		}
+	}
+	return reflect.DeepEqual(indirect(reflect.ValueOf(a)).Interface(), indirect(reflect.ValueOf(b)).Interface())
+}
+
+// In tells whether value is an element of list, a key of map, or an item of a comma
+// separated string, like the rights kept in sessions
+func In(value interface{}, list interface{}) bool {
+	v := indirect(reflect.ValueOf(list))
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if Equal(value, v.Index(i).Interface()) {
+				return true
+			}
+		}
+	case reflect.Map:
+		for _, key := range v.MapKeys() {
+			if Equal(value, key.Interface()) {
+				return true
+			}
+		}
+	case reflect.String:
+		for _, item := range strings.Split(v.String(), ",") {
+			if Equal(value, strings.TrimSpace(item)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// compare orders numbers or strings, ok is false for other values
+func compare(a interface{}, b interface{}) (order int, ok bool) {
+	if isString(a) && isString(b) {
+		return strings.Compare(indirect(reflect.ValueOf(a)).String(), indirect(reflect.ValueOf(b)).String()), true
+	}
+	na, okA := numberOf(a)
+	nb, okB := numberOf(b)
+	if !okA || !okB {
+		return 0, false
+	}
+	return compareNumbers(na, nb), true
+}
+
+func compareNumbers(a number, b number) int {
+	if !a.isFloat && !b.isFloat {
+		switch {
+		case a.i < b.i:
+			return -1
+		case a.i > b.i:
+			return 1
+		}
+		return 0
+	}
+	switch fa, fb := a.float(), b.float(); {
+	case fa < fb:
+		return -1
+	case fa > fb:
+		return 1
+	}
+	return 0
+}
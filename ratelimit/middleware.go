@@ -0,0 +1,116 @@
+package ratelimit
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sdjnlh/communal"
+	"github.com/sdjnlh/communal/errors"
+	"github.com/sdjnlh/communal/log"
+	"github.com/sdjnlh/communal/util"
+	"go.uber.org/zap"
+)
+
+// KeyFunc extracts the key requests are limited by, requests with an empty key
+// are not limited.
+type KeyFunc func(c *gin.Context) string
+
+// proxiesKey keeps the trusted proxies of the handler limiting a request in its context
+const proxiesKey = "communal.ratelimit.proxies"
+
+// ByIP limits requests per client ip, the peer address unless it is one of the
+// trusted proxies of the handler
+func ByIP(c *gin.Context) string {
+	var proxies []*net.IPNet
+	if value, ok := c.Get(proxiesKey); ok {
+		proxies, _ = value.([]*net.IPNet)
+	}
+	return "ip:" + util.ClientIp(c.Request, proxies)
+}
+
+// ByUid limits requests per user, and per ip before login
+func ByUid(c *gin.Context) string {
+	if uid := c.GetInt64(communal.UserIdKey); uid > 0 {
+		return "uid:" + strconv.FormatInt(uid, 10)
+	}
+	return ByIP(c)
+}
+
+// Rule limits the requests of a route or endpoint, Name scopes the keys
+type Rule struct {
+	Name  string
+	Limit Limit
+	Key   KeyFunc
+}
+
+// Options of a handler
+type Options struct {
+	// Proxies whose X-Forwarded-For header ByIP reads the client ip from, see
+	// util.ParseProxies
+	Proxies []*net.IPNet
+	// Fail answers limited requests with errors.TooManyRequests, as a bare 429 when nil
+	Fail func(c *gin.Context, err error)
+}
+
+// Handler limits requests by the rule answered for them, nil for no limit. Allowed
+// requests get RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset headers,
+// limited ones are failed with Retry-After. Requests are let through when the limiter
+// fails.
+func Handler(limiter Limiter, rule func(c *gin.Context) *Rule, options Options) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		r := rule(c)
+		if r == nil || r.Limit.Rate <= 0 || r.Limit.Per <= 0 {
+			c.Next()
+			return
+		}
+		keyFunc := r.Key
+		if keyFunc == nil {
+			keyFunc = ByIP
+		}
+		c.Set(proxiesKey, options.Proxies)
+		key := keyFunc(c)
+		if key == "" {
+			c.Next()
+			return
+		}
+
+		result, err := limiter.Allow(c, r.Name+":"+key, r.Limit)
+		if err != nil {
+			log.Ctx(c).Warn("fail to limit rate", zap.String("rule", r.Name), zap.Error(err))
+			c.Next()
+			return
+		}
+
+		header := c.Writer.Header()
+		header.Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+		header.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		header.Set("RateLimit-Reset", seconds(result.Reset))
+		if !result.Allowed {
+			header.Set("Retry-After", seconds(result.RetryAfter))
+			if options.Fail != nil {
+				options.Fail(c, errors.TooManyRequests())
+				c.Abort()
+			} else {
+				c.AbortWithStatusJSON(http.StatusTooManyRequests, errors.TooManyRequests())
+			}
+			return
+		}
+		c.Next()
+	}
+}
+
+// Static limits all requests with the same limit
+func Static(limiter Limiter, name string, limit Limit, key KeyFunc, options Options) gin.HandlerFunc {
+	rule := &Rule{Name: name, Limit: limit, Key: key}
+	return Handler(limiter, func(c *gin.Context) *Rule {
+		return rule
+	}, options)
+}
+
+func seconds(d time.Duration) string {
+	return strconv.FormatInt(int64(math.Ceil(d.Seconds())), 10)
+}
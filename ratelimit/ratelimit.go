@@ -0,0 +1,171 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	// TokenBucket refills Rate tokens every Per, up to Burst, each request taking one
+	TokenBucket = "token"
+	// SlidingWindow allows Rate requests within any window of Per
+	SlidingWindow = "window"
+)
+
+// Limit of requests, e.g. {Rate: 5, Per: time.Minute}
+type Limit struct {
+	Rate      int
+	Per       time.Duration
+	Burst     int
+	Algorithm string
+}
+
+func (limit Limit) capacity() int {
+	if limit.Algorithm != SlidingWindow && limit.Burst > 0 {
+		return limit.Burst
+	}
+	return limit.Rate
+}
+
+// tokens refilled per millisecond, Per is taken as at least a millisecond
+func (limit Limit) refill() float64 {
+	per := limit.Per.Milliseconds()
+	if per < 1 {
+		per = 1
+	}
+	return float64(limit.Rate) / float64(per)
+}
+
+// Result of a request, Reset is the time until the limit is fully available again
+// and RetryAfter the time until the next request is allowed, when it is not.
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
+
+// Limiter takes a request of key against limit
+type Limiter interface {
+	Allow(ctx context.Context, key string, limit Limit) (*Result, error)
+}
+
+func bucketResult(limit Limit, allowed bool, tokens float64) *Result {
+	capacity := limit.capacity()
+	result := &Result{
+		Allowed:   allowed,
+		Limit:     capacity,
+		Remaining: int(math.Floor(tokens)),
+		Reset:     time.Duration((float64(capacity)-tokens)/limit.refill()) * time.Millisecond,
+	}
+	if !allowed {
+		result.RetryAfter = time.Duration(math.Ceil((1-tokens)/limit.refill())) * time.Millisecond
+	}
+	return result
+}
+
+func windowResult(limit Limit, allowed bool, count int, reset time.Duration) *Result {
+	result := &Result{Allowed: allowed, Limit: limit.Rate, Remaining: limit.Rate - count, Reset: reset}
+	if !allowed {
+		result.RetryAfter = reset
+	}
+	return result
+}
+
+// sweepEvery is how often Memory drops the limits of idle keys
+const sweepEvery = time.Minute
+
+type bucket struct {
+	tokens float64
+	ts     time.Time
+	// idle is when the bucket is full again, and can be dropped
+	idle time.Time
+}
+
+type window struct {
+	hits []time.Time
+	// idle is when the last hit leaves the window, and the window can be dropped
+	idle time.Time
+}
+
+// Memory limits requests within the process, for tests and single instance services.
+// The limits of keys are dropped once they are fully available again.
+type Memory struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	windows map[string]*window
+	swept   time.Time
+	now     func() time.Time
+}
+
+func NewMemory() *Memory {
+	return &Memory{buckets: map[string]*bucket{}, windows: map[string]*window{}, now: time.Now}
+}
+
+func (memory *Memory) Allow(ctx context.Context, key string, limit Limit) (*Result, error) {
+	memory.mu.Lock()
+	defer memory.mu.Unlock()
+
+	now := memory.now()
+	memory.sweep(now)
+	if limit.Algorithm == SlidingWindow {
+		var hits []time.Time
+		if w, ok := memory.windows[key]; ok {
+			for _, hit := range w.hits {
+				if now.Sub(hit) < limit.Per {
+					hits = append(hits, hit)
+				}
+			}
+		}
+		allowed := len(hits) < limit.Rate
+		if allowed {
+			hits = append(hits, now)
+		}
+		var reset time.Duration
+		if len(hits) > 0 {
+			reset = hits[0].Add(limit.Per).Sub(now)
+			memory.windows[key] = &window{hits: hits, idle: hits[len(hits)-1].Add(limit.Per)}
+		} else {
+			delete(memory.windows, key)
+		}
+		return windowResult(limit, allowed, len(hits), reset), nil
+	}
+
+	capacity := float64(limit.capacity())
+	b, ok := memory.buckets[key]
+	if !ok {
+		b = &bucket{tokens: capacity, ts: now}
+		memory.buckets[key] = b
+	}
+	elapsed := float64(now.Sub(b.ts)) / float64(time.Millisecond)
+	b.tokens = math.Min(capacity, b.tokens+math.Max(0, elapsed)*limit.refill())
+	b.ts = now
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+	result := bucketResult(limit, allowed, b.tokens)
+	b.idle = now.Add(result.Reset)
+	return result, nil
+}
+
+// sweep drops the limits idle at now, at most once every sweepEvery
+func (memory *Memory) sweep(now time.Time) {
+	if now.Sub(memory.swept) < sweepEvery {
+		return
+	}
+	memory.swept = now
+	for key, b := range memory.buckets {
+		if !now.Before(b.idle) {
+			delete(memory.buckets, key)
+		}
+	}
+	for key, w := range memory.windows {
+		if !now.Before(w.idle) {
+			delete(memory.windows, key)
+		}
+	}
+}
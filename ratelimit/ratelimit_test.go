@@ -0,0 +1,152 @@
+package ratelimit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sdjnlh/communal/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemory_TokenBucket(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	memory := NewMemory()
+	memory.now = func() time.Time { return now }
+	limit := Limit{Rate: 1, Per: time.Second, Burst: 2}
+
+	for i := 0; i < 2; i++ {
+		result, err := memory.Allow(ctx, "k", limit)
+		assert.NoError(t, err)
+		assert.True(t, result.Allowed)
+		assert.Equal(t, 2, result.Limit)
+		assert.Equal(t, 1-i, result.Remaining)
+	}
+	result, _ := memory.Allow(ctx, "k", limit)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, time.Second, result.RetryAfter)
+	assert.Equal(t, 2*time.Second, result.Reset)
+
+	now = now.Add(500 * time.Millisecond)
+	result, _ = memory.Allow(ctx, "k", limit)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, 500*time.Millisecond, result.RetryAfter)
+
+	now = now.Add(500 * time.Millisecond)
+	result, _ = memory.Allow(ctx, "k", limit)
+	assert.True(t, result.Allowed)
+
+	result, _ = memory.Allow(ctx, "other", limit)
+	assert.True(t, result.Allowed, "keys are limited apart")
+}
+
+func TestMemory_SlidingWindow(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	memory := NewMemory()
+	memory.now = func() time.Time { return now }
+	limit := Limit{Rate: 2, Per: time.Minute, Algorithm: SlidingWindow}
+
+	result, _ := memory.Allow(ctx, "k", limit)
+	assert.True(t, result.Allowed)
+	now = now.Add(30 * time.Second)
+	result, _ = memory.Allow(ctx, "k", limit)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 0, result.Remaining)
+
+	result, _ = memory.Allow(ctx, "k", limit)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, 30*time.Second, result.RetryAfter)
+
+	now = now.Add(30 * time.Second)
+	result, _ = memory.Allow(ctx, "k", limit)
+	assert.True(t, result.Allowed, "the first request left the window")
+}
+
+func TestMemory_Sweep(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	memory := NewMemory()
+	memory.now = func() time.Time { return now }
+	bucketLimit := Limit{Rate: 1, Per: time.Minute}
+	windowLimit := Limit{Rate: 1, Per: 2 * time.Minute, Algorithm: SlidingWindow}
+
+	memory.Allow(ctx, "b", bucketLimit)
+	memory.Allow(ctx, "w", windowLimit)
+	assert.Len(t, memory.buckets, 1)
+	assert.Len(t, memory.windows, 1)
+
+	now = now.Add(sweepEvery)
+	memory.Allow(ctx, "other", bucketLimit)
+	assert.NotContains(t, memory.buckets, "b", "the bucket is full again")
+	assert.Contains(t, memory.windows, "w", "the window still holds a hit")
+
+	now = now.Add(sweepEvery)
+	memory.Allow(ctx, "other", bucketLimit)
+	assert.NotContains(t, memory.windows, "w")
+	result, _ := memory.Allow(ctx, "w", windowLimit)
+	assert.True(t, result.Allowed)
+}
+
+func TestLimit_Refill(t *testing.T) {
+	limit := Limit{Rate: 5, Per: time.Microsecond}
+	assert.Equal(t, float64(5), limit.refill(), "Per is taken as a millisecond")
+	result, err := NewMemory().Allow(context.Background(), "k", limit)
+	assert.NoError(t, err)
+	assert.True(t, result.Allowed)
+}
+
+func TestHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	limiter := NewMemory()
+	newRouter := func(options Options) *gin.Engine {
+		router := gin.New()
+		router.Use(Static(limiter, "login", Limit{Rate: 1, Per: time.Minute}, ByUid, options))
+		router.POST("/login", func(c *gin.Context) { c.Status(http.StatusOK) })
+		return router
+	}
+	router := newRouter(Options{})
+	proxies, err := util.ParseProxies([]string{"10.0.0.0/8"})
+	assert.NoError(t, err)
+	proxied := newRouter(Options{Proxies: proxies, Fail: func(c *gin.Context, err error) {
+		c.String(http.StatusTooManyRequests, "slow down")
+	}})
+
+	serve := func(ip string, forwarded ...string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/login", nil)
+		req.RemoteAddr = ip + ":1234"
+		if len(forwarded) > 0 {
+			req.Header.Set("X-Forwarded-For", forwarded[0])
+		}
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := serve("10.0.0.1")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "1", w.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "0", w.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "60", w.Header().Get("RateLimit-Reset"))
+
+	w = serve("10.0.0.1")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "60", w.Header().Get("Retry-After"))
+	assert.Contains(t, w.Body.String(), "c.TOO_MANY_REQUESTS")
+
+	assert.Equal(t, http.StatusOK, serve("10.0.0.2").Code)
+	assert.Equal(t, http.StatusTooManyRequests, serve("10.0.0.2", "6.6.6.6").Code, "X-Forwarded-For of untrusted peers is ignored")
+
+	// the proxies trusted by a handler are not trusted by the others
+	router = proxied
+	assert.Equal(t, http.StatusOK, serve("10.0.0.2", "6.6.6.6").Code)
+	w = serve("10.0.0.3", "6.6.6.6")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "slow down", w.Body.String())
+	router = newRouter(Options{})
+	assert.Equal(t, http.StatusTooManyRequests, serve("10.0.0.2", "8.8.8.8").Code)
+}
@@ -0,0 +1,101 @@
+package ratelimit
+
+import (
+	"context"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// tokenBucketScript refills the bucket by the elapsed time and takes a token,
+// answering whether it was taken and the tokens left.
+var tokenBucketScript = redis.NewScript(1, `
+local capacity = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1]) or capacity
+local ts = tonumber(state[2]) or now
+tokens = math.min(capacity, tokens + math.max(0, now - ts) * rate)
+local allowed = 0
+if tokens >= 1 then
+  tokens = tokens - 1
+  allowed = 1
+end
+redis.call('HMSET', KEYS[1], 'tokens', tostring(tokens), 'ts', now)
+redis.call('PEXPIRE', KEYS[1], math.ceil(capacity / rate))
+return {allowed, tostring(tokens)}
+`)
+
+// slidingWindowScript logs the requests of the window in a sorted set, answering
+// whether the request was logged, the requests in the window and the time until
+// the oldest one leaves it.
+var slidingWindowScript = redis.NewScript(1, `
+local limit = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now - window)
+local count = redis.call('ZCARD', KEYS[1])
+local allowed = 0
+if count < limit then
+  redis.call('ZADD', KEYS[1], now, ARGV[4])
+  count = count + 1
+  allowed = 1
+end
+redis.call('PEXPIRE', KEYS[1], window)
+local reset = 0
+local oldest = redis.call('ZRANGE', KEYS[1], 0, 0, 'WITHSCORES')
+if oldest[2] then
+  reset = tonumber(oldest[2]) + window - now
+end
+return {allowed, count, reset}
+`)
+
+// Redis limits requests of all instances of a service atomically with Lua scripts
+type Redis struct {
+	Pool   *redis.Pool
+	Prefix string
+
+	seq uint64
+	now func() time.Time
+}
+
+func NewRedis(pool *redis.Pool) *Redis {
+	// members of the window logs are unique across instances by the random start of seq
+	return &Redis{Pool: pool, Prefix: "ratelimit:", seq: uint64(time.Now().UnixNano()), now: time.Now}
+}
+
+func (limiter *Redis) Allow(ctx context.Context, key string, limit Limit) (*Result, error) {
+	conn, err := limiter.Pool.GetContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	now := limiter.now().UnixNano() / int64(time.Millisecond)
+	if limit.Algorithm == SlidingWindow {
+		member := strconv.FormatInt(now, 36) + "-" + strconv.FormatUint(atomic.AddUint64(&limiter.seq, 1), 36)
+		values, err := redis.Int64s(slidingWindowScript.Do(conn, limiter.Prefix+"w:"+key, limit.Rate, limit.Per.Milliseconds(), now, member))
+		if err != nil {
+			return nil, err
+		}
+		return windowResult(limit, values[0] == 1, int(values[1]), time.Duration(values[2])*time.Millisecond), nil
+	}
+
+	values, err := redis.Values(tokenBucketScript.Do(conn, limiter.Prefix+"b:"+key, limit.capacity(), strconv.FormatFloat(limit.refill(), 'f', -1, 64), now))
+	if err != nil {
+		return nil, err
+	}
+	var allowed int64
+	var tokens string
+	if _, err = redis.Scan(values, &allowed, &tokens); err != nil {
+		return nil, err
+	}
+	left, err := strconv.ParseFloat(tokens, 64)
+	if err != nil {
+		return nil, err
+	}
+	return bucketResult(limit, allowed == 1, left), nil
+}
@@ -0,0 +1,201 @@
+package rbac
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// Cache keeps the permissions of users, InvalidateAll drops the permissions of all
+// users, when the permissions of a role change. Get answers the stamp of the cache
+// when the permissions are not cached, Set keeps the permissions only if the user
+// has not been invalidated since, so that permissions read from the store while
+// they change are not cached.
+type Cache interface {
+	Get(ctx context.Context, uid int64) (permissions []string, stamp Stamp, ok bool, err error)
+	Set(ctx context.Context, uid int64, stamp Stamp, permissions []string, ttl time.Duration) error
+	Invalidate(ctx context.Context, uid int64) error
+	InvalidateAll(ctx context.Context) error
+}
+
+// Stamp counts the invalidations of all users and of a user
+type Stamp struct {
+	Generation int64
+	Version    int64
+}
+
+type cached struct {
+	permissions []string
+	expire      time.Time
+}
+
+// MemoryCache keeps permissions in the process, for single instance services and tests
+type MemoryCache struct {
+	mu         sync.Mutex
+	entries    map[int64]*cached
+	generation int64
+	versions   map[int64]int64
+	now        func() time.Time
+}
+
+func NewMemoryCache() *MemoryCache {
+	return &MemoryCache{entries: map[int64]*cached{}, versions: map[int64]int64{}, now: time.Now}
+}
+
+func (cache *MemoryCache) Get(ctx context.Context, uid int64) ([]string, Stamp, bool, error) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	stamp := Stamp{Generation: cache.generation, Version: cache.versions[uid]}
+	entry, ok := cache.entries[uid]
+	if !ok || !cache.now().Before(entry.expire) {
+		return nil, stamp, false, nil
+	}
+	return entry.permissions, stamp, true, nil
+}
+
+func (cache *MemoryCache) Set(ctx context.Context, uid int64, stamp Stamp, permissions []string, ttl time.Duration) error {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	if stamp.Generation != cache.generation || stamp.Version != cache.versions[uid] {
+		return nil
+	}
+	cache.entries[uid] = &cached{permissions: permissions, expire: cache.now().Add(ttl)}
+	return nil
+}
+
+func (cache *MemoryCache) Invalidate(ctx context.Context, uid int64) error {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	delete(cache.entries, uid)
+	cache.versions[uid]++
+	return nil
+}
+
+func (cache *MemoryCache) InvalidateAll(ctx context.Context) error {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	cache.entries = map[int64]*cached{}
+	cache.generation++
+	return nil
+}
+
+// versionTTL keeps the version of invalidated users far longer than a store read
+const versionTTL = 24 * time.Hour
+
+// setIfCurrent sets the permissions of a user when the generation and the version of
+// the user are the ones read before the store
+var setIfCurrent = redis.NewScript(3, `
+if tonumber(redis.call('GET', KEYS[1]) or '0') ~= tonumber(ARGV[1]) or tonumber(redis.call('GET', KEYS[2]) or '0') ~= tonumber(ARGV[2]) then
+	return 0
+end
+redis.call('SET', KEYS[3], ARGV[3], 'PX', ARGV[4])
+return 1
+`)
+
+// RedisCache shares the permissions between the instances of a service. The keys of
+// users carry a generation, bumped to invalidate all of them.
+type RedisCache struct {
+	Pool   *redis.Pool
+	Prefix string
+}
+
+func NewRedisCache(pool *redis.Pool) *RedisCache {
+	return &RedisCache{Pool: pool, Prefix: "rbac:"}
+}
+
+func (cache *RedisCache) key(generation int64, uid int64) string {
+	return cache.Prefix + strconv.FormatInt(generation, 10) + ":" + strconv.FormatInt(uid, 10)
+}
+
+func (cache *RedisCache) versionKey(uid int64) string {
+	return cache.Prefix + "version:" + strconv.FormatInt(uid, 10)
+}
+
+func (cache *RedisCache) stamp(conn redis.Conn, uid int64) (Stamp, error) {
+	values, err := redis.Values(conn.Do("MGET", cache.Prefix+"generation", cache.versionKey(uid)))
+	if err != nil {
+		return Stamp{}, err
+	}
+	var stamp Stamp
+	_, err = redis.Scan(values, &stamp.Generation, &stamp.Version)
+	return stamp, err
+}
+
+func (cache *RedisCache) Get(ctx context.Context, uid int64) ([]string, Stamp, bool, error) {
+	conn, err := cache.Pool.GetContext(ctx)
+	if err != nil {
+		return nil, Stamp{}, false, err
+	}
+	defer conn.Close()
+
+	stamp, err := cache.stamp(conn, uid)
+	if err != nil {
+		return nil, stamp, false, err
+	}
+	data, err := redis.Bytes(conn.Do("GET", cache.key(stamp.Generation, uid)))
+	if err == redis.ErrNil {
+		return nil, stamp, false, nil
+	}
+	if err != nil {
+		return nil, stamp, false, err
+	}
+	var permissions []string
+	if err = json.Unmarshal(data, &permissions); err != nil {
+		return nil, stamp, false, err
+	}
+	return permissions, stamp, true, nil
+}
+
+func (cache *RedisCache) Set(ctx context.Context, uid int64, stamp Stamp, permissions []string, ttl time.Duration) error {
+	data, err := json.Marshal(permissions)
+	if err != nil {
+		return err
+	}
+	conn, err := cache.Pool.GetContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = setIfCurrent.Do(conn, cache.Prefix+"generation", cache.versionKey(uid), cache.key(stamp.Generation, uid),
+		stamp.Generation, stamp.Version, data, ttl.Milliseconds())
+	return err
+}
+
+// Invalidate bumps the version of the user before dropping its permissions, so that
+// a Set racing with it either fails or is dropped
+func (cache *RedisCache) Invalidate(ctx context.Context, uid int64) error {
+	conn, err := cache.Pool.GetContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err = conn.Do("INCR", cache.versionKey(uid)); err != nil {
+		return err
+	}
+	if _, err = conn.Do("PEXPIRE", cache.versionKey(uid), versionTTL.Milliseconds()); err != nil {
+		return err
+	}
+	stamp, err := cache.stamp(conn, uid)
+	if err != nil {
+		return err
+	}
+	_, err = conn.Do("DEL", cache.key(stamp.Generation, uid))
+	return err
+}
+
+func (cache *RedisCache) InvalidateAll(ctx context.Context) error {
+	conn, err := cache.Pool.GetContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.Do("INCR", cache.Prefix+"generation")
+	return err
+}
@@ -0,0 +1,174 @@
+// Package rbac grants permissions to users through roles. Permissions are named
+// {module}:{rightKey} like the endpoints they guard, and are matched segment by
+// segment, * matching any segment: article:*, *:get or *.
+package rbac
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/sdjnlh/communal"
+)
+
+const DefaultTTL = 10 * time.Minute
+
+type Role struct {
+	communal.ID `xorm:"extends"`
+	Name        string `xorm:"VARCHAR(64) unique" json:"name" valid:"required"`
+	Description string `xorm:"VARCHAR(255)" json:"description"`
+}
+
+type RolePermission struct {
+	communal.ID `xorm:"extends"`
+	RoleId      int64  `xorm:"BIGINT(20) index" json:"roleId,string"`
+	Permission  string `xorm:"VARCHAR(128)" json:"permission"`
+}
+
+type UserRole struct {
+	communal.ID `xorm:"extends"`
+	Uid         int64 `xorm:"BIGINT(20) index" json:"uid,string"`
+	RoleId      int64 `xorm:"BIGINT(20) index" json:"roleId,string"`
+}
+
+// Store keeps the roles, their permissions and the roles of the users
+type Store interface {
+	AddRole(ctx context.Context, role *Role) error
+	// RemoveRole deletes the role, its permissions and its assignments
+	RemoveRole(ctx context.Context, roleId int64) error
+	// Permissions answers the permissions of the roles of the user
+	Permissions(ctx context.Context, uid int64) ([]string, error)
+	Grant(ctx context.Context, roleId int64, permissions ...string) error
+	Revoke(ctx context.Context, roleId int64, permissions ...string) error
+	Assign(ctx context.Context, uid int64, roleIds ...int64) error
+	Unassign(ctx context.Context, uid int64, roleIds ...int64) error
+}
+
+// Rbac answers whether users have permissions, caching the permissions of users for
+// TTL, DefaultTTL when not set. Changes made through it invalidate the cache.
+type Rbac struct {
+	Store Store
+	Cache Cache
+	TTL   time.Duration
+}
+
+func New(store Store, cache Cache) *Rbac {
+	return &Rbac{Store: store, Cache: cache}
+}
+
+func (r *Rbac) ttl() time.Duration {
+	if r.TTL > 0 {
+		return r.TTL
+	}
+	return DefaultTTL
+}
+
+// Permissions answers the permissions granted to the user
+func (r *Rbac) Permissions(ctx context.Context, uid int64) ([]string, error) {
+	if r.Cache == nil {
+		return r.Store.Permissions(ctx, uid)
+	}
+	// the stamp is read before the store, permissions changed in between are not cached
+	permissions, stamp, ok, cacheErr := r.Cache.Get(ctx, uid)
+	if cacheErr == nil && ok {
+		return permissions, nil
+	}
+	permissions, err := r.Store.Permissions(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+	if cacheErr == nil {
+		_ = r.Cache.Set(ctx, uid, stamp, permissions, r.ttl())
+	}
+	return permissions, nil
+}
+
+// Can tells whether the user is granted permission
+func (r *Rbac) Can(ctx context.Context, uid int64, permission string) (bool, error) {
+	permissions, err := r.Permissions(ctx, uid)
+	if err != nil {
+		return false, err
+	}
+	return Any(permissions, permission), nil
+}
+
+func (r *Rbac) AddRole(ctx context.Context, role *Role) error {
+	return r.Store.AddRole(ctx, role)
+}
+
+func (r *Rbac) RemoveRole(ctx context.Context, roleId int64) error {
+	if err := r.Store.RemoveRole(ctx, roleId); err != nil {
+		return err
+	}
+	return r.invalidateAll(ctx)
+}
+
+func (r *Rbac) Grant(ctx context.Context, roleId int64, permissions ...string) error {
+	if err := r.Store.Grant(ctx, roleId, permissions...); err != nil {
+		return err
+	}
+	return r.invalidateAll(ctx)
+}
+
+func (r *Rbac) Revoke(ctx context.Context, roleId int64, permissions ...string) error {
+	if err := r.Store.Revoke(ctx, roleId, permissions...); err != nil {
+		return err
+	}
+	return r.invalidateAll(ctx)
+}
+
+func (r *Rbac) Assign(ctx context.Context, uid int64, roleIds ...int64) error {
+	if err := r.Store.Assign(ctx, uid, roleIds...); err != nil {
+		return err
+	}
+	return r.invalidate(ctx, uid)
+}
+
+func (r *Rbac) Unassign(ctx context.Context, uid int64, roleIds ...int64) error {
+	if err := r.Store.Unassign(ctx, uid, roleIds...); err != nil {
+		return err
+	}
+	return r.invalidate(ctx, uid)
+}
+
+func (r *Rbac) invalidate(ctx context.Context, uid int64) error {
+	if r.Cache == nil {
+		return nil
+	}
+	return r.Cache.Invalidate(ctx, uid)
+}
+
+func (r *Rbac) invalidateAll(ctx context.Context) error {
+	if r.Cache == nil {
+		return nil
+	}
+	return r.Cache.InvalidateAll(ctx)
+}
+
+// Match tells whether the granted pattern matches permission
+func Match(pattern string, permission string) bool {
+	if pattern == "*" || pattern == permission {
+		return true
+	}
+	patterns := strings.Split(pattern, ":")
+	segments := strings.Split(permission, ":")
+	if len(patterns) != len(segments) {
+		return false
+	}
+	for i, p := range patterns {
+		if p != "*" && p != segments[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Any tells whether one of the granted patterns matches permission
+func Any(patterns []string, permission string) bool {
+	for _, pattern := range patterns {
+		if Match(pattern, permission) {
+			return true
+		}
+	}
+	return false
+}
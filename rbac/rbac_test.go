@@ -0,0 +1,113 @@
+package rbac
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatch(t *testing.T) {
+	assert.True(t, Match("*", "article:get"))
+	assert.True(t, Match("article:get", "article:get"))
+	assert.True(t, Match("article:*", "article:get"))
+	assert.True(t, Match("*:get", "article:get"))
+	assert.False(t, Match("article:*", "comment:get"))
+	assert.False(t, Match("*:list", "article:get"))
+	assert.False(t, Match("article", "article:get"))
+	assert.False(t, Match("", "article:get"))
+}
+
+type countingStore struct {
+	*MemoryStore
+	reads int
+}
+
+func (store *countingStore) Permissions(ctx context.Context, uid int64) ([]string, error) {
+	store.reads++
+	return store.MemoryStore.Permissions(ctx, uid)
+}
+
+func TestRbac(t *testing.T) {
+	ctx := context.Background()
+	store := &countingStore{MemoryStore: NewMemoryStore()}
+	r := New(store, NewMemoryCache())
+
+	editor := &Role{Name: "editor"}
+	reader := &Role{Name: "reader"}
+	assert.NoError(t, r.AddRole(ctx, editor))
+	assert.NoError(t, r.AddRole(ctx, reader))
+	assert.NotZero(t, editor.Id)
+	assert.NoError(t, r.Grant(ctx, editor.Id, "article:*"))
+	assert.NoError(t, r.Grant(ctx, reader.Id, "*:get", "*:list"))
+	assert.NoError(t, r.Assign(ctx, 1, reader.Id))
+
+	can := func(uid int64, permission string) bool {
+		granted, err := r.Can(ctx, uid, permission)
+		assert.NoError(t, err)
+		return granted
+	}
+	assert.True(t, can(1, "article:get"))
+	assert.True(t, can(1, "comment:list"))
+	assert.False(t, can(1, "article:update"))
+	assert.Equal(t, 1, store.reads)
+	assert.False(t, can(2, "article:get"))
+
+	// assigning invalidates the grants of the user
+	assert.NoError(t, r.Assign(ctx, 1, editor.Id))
+	assert.True(t, can(1, "article:update"))
+	assert.Equal(t, 3, store.reads)
+
+	// granting invalidates the grants of all users
+	assert.NoError(t, r.Revoke(ctx, reader.Id, "*:list"))
+	assert.False(t, can(1, "comment:list"))
+	assert.NoError(t, r.Unassign(ctx, 1, editor.Id))
+	assert.False(t, can(1, "article:update"))
+	assert.True(t, can(1, "article:get"))
+
+	// removing a role invalidates the grants of all users
+	assert.NoError(t, r.RemoveRole(ctx, reader.Id))
+	assert.False(t, can(1, "article:get"))
+}
+
+func TestMemoryCacheExpiry(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	cache := NewMemoryCache()
+	cache.now = func() time.Time { return now }
+
+	assert.NoError(t, cache.Set(ctx, 1, Stamp{}, []string{"article:get"}, time.Minute))
+	permissions, _, ok, err := cache.Get(ctx, 1)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, []string{"article:get"}, permissions)
+
+	now = now.Add(time.Minute)
+	_, _, ok, _ = cache.Get(ctx, 1)
+	assert.False(t, ok)
+}
+
+func TestMemoryCacheStamp(t *testing.T) {
+	ctx := context.Background()
+	cache := NewMemoryCache()
+
+	// permissions read from the store while the user is invalidated are not cached
+	_, stamp, ok, _ := cache.Get(ctx, 1)
+	assert.False(t, ok)
+	assert.NoError(t, cache.Invalidate(ctx, 1))
+	assert.NoError(t, cache.Set(ctx, 1, stamp, []string{"article:get"}, time.Minute))
+	_, _, ok, _ = cache.Get(ctx, 1)
+	assert.False(t, ok)
+
+	_, stamp, _, _ = cache.Get(ctx, 1)
+	assert.NoError(t, cache.InvalidateAll(ctx))
+	assert.NoError(t, cache.Set(ctx, 1, stamp, []string{"article:get"}, time.Minute))
+	_, _, ok, _ = cache.Get(ctx, 1)
+	assert.False(t, ok)
+
+	_, stamp, _, _ = cache.Get(ctx, 1)
+	assert.NoError(t, cache.Set(ctx, 1, stamp, []string{"article:get"}, time.Minute))
+	_, _, ok, _ = cache.Get(ctx, 1)
+	assert.True(t, ok)
+}
@@ -0,0 +1,280 @@
+package rbac
+
+import (
+	"context"
+	"sync"
+
+	"github.com/sdjnlh/communal"
+	"github.com/sdjnlh/communal/id"
+)
+
+// DbStore keeps roles in the tables of its modules, which are registered to the app
+// with app.Register(store.Modules()...). Roles are changed through Rbac, which
+// invalidates the cached permissions, changes made otherwise, e.g. by endpoints of the
+// modules, are seen once the cache expires. Permissions of removed roles are ignored.
+type DbStore struct {
+	Roles           *communal.Module
+	RolePermissions *communal.Module
+	UserRoles       *communal.Module
+}
+
+func NewDbStore() *DbStore {
+	return &DbStore{
+		Roles:           communal.NewModule("role", "rbac_role", "/roles"),
+		RolePermissions: communal.NewModule("rolePermission", "rbac_role_permission", "/role-permissions"),
+		UserRoles:       communal.NewModule("userRole", "rbac_user_role", "/user-roles"),
+	}
+}
+
+func (store *DbStore) Modules() []communal.IModule {
+	return []communal.IModule{store.Roles, store.RolePermissions, store.UserRoles}
+}
+
+// Sync creates or updates the tables of the store
+func (store *DbStore) Sync() error {
+	if err := store.Roles.Db.Table(store.Roles.TableName).Sync2(&Role{}); err != nil {
+		return err
+	}
+	if err := store.RolePermissions.Db.Table(store.RolePermissions.TableName).Sync2(&RolePermission{}); err != nil {
+		return err
+	}
+	return store.UserRoles.Db.Table(store.UserRoles.TableName).Sync2(&UserRole{})
+}
+
+func (store *DbStore) AddRole(ctx context.Context, role *Role) error {
+	if role.Id == 0 {
+		role.Id, _ = id.Next()
+	}
+	_, err := store.Roles.Db.Context(ctx).Table(store.Roles.TableName).Insert(role)
+	return err
+}
+
+// RemoveRole deletes the role, its permissions and its assignments
+func (store *DbStore) RemoveRole(ctx context.Context, roleId int64) error {
+	if _, err := store.Roles.Db.Context(ctx).Table(store.Roles.TableName).ID(roleId).Delete(&Role{}); err != nil {
+		return err
+	}
+	if _, err := store.RolePermissions.Db.Context(ctx).Table(store.RolePermissions.TableName).Delete(&RolePermission{RoleId: roleId}); err != nil {
+		return err
+	}
+	_, err := store.UserRoles.Db.Context(ctx).Table(store.UserRoles.TableName).Delete(&UserRole{RoleId: roleId})
+	return err
+}
+
+func (store *DbStore) Permissions(ctx context.Context, uid int64) ([]string, error) {
+	var userRoles []*UserRole
+	if err := store.UserRoles.Db.Context(ctx).Table(store.UserRoles.TableName).Find(&userRoles, &UserRole{Uid: uid}); err != nil {
+		return nil, err
+	}
+	if len(userRoles) == 0 {
+		return []string{}, nil
+	}
+	roleIds := make([]int64, len(userRoles))
+	for i, userRole := range userRoles {
+		roleIds[i] = userRole.RoleId
+	}
+	// roles may have been removed without their permissions and users
+	var liveIds []int64
+	if err := store.Roles.Db.Context(ctx).Table(store.Roles.TableName).Cols("id").In("id", roleIds).Find(&liveIds); err != nil {
+		return nil, err
+	}
+	if len(liveIds) == 0 {
+		return []string{}, nil
+	}
+	roleIds = liveIds
+
+	db := store.RolePermissions.Db
+	var rolePermissions []*RolePermission
+	if err := db.Context(ctx).Table(store.RolePermissions.TableName).
+		In(db.GetColumnMapper().Obj2Table("RoleId"), roleIds).Find(&rolePermissions); err != nil {
+		return nil, err
+	}
+	permissions := make([]string, 0, len(rolePermissions))
+	seen := map[string]bool{}
+	for _, rolePermission := range rolePermissions {
+		if !seen[rolePermission.Permission] {
+			seen[rolePermission.Permission] = true
+			permissions = append(permissions, rolePermission.Permission)
+		}
+	}
+	return permissions, nil
+}
+
+func (store *DbStore) Grant(ctx context.Context, roleId int64, permissions ...string) error {
+	session := store.RolePermissions.Db.Context(ctx)
+	for _, permission := range permissions {
+		rolePermission := &RolePermission{RoleId: roleId, Permission: permission}
+		exist, err := session.Table(store.RolePermissions.TableName).Exist(rolePermission)
+		if err != nil {
+			return err
+		}
+		if exist {
+			continue
+		}
+		rolePermission.Id, _ = id.Next()
+		if _, err = session.Table(store.RolePermissions.TableName).Insert(rolePermission); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (store *DbStore) Revoke(ctx context.Context, roleId int64, permissions ...string) error {
+	session := store.RolePermissions.Db.Context(ctx)
+	for _, permission := range permissions {
+		if _, err := session.Table(store.RolePermissions.TableName).Delete(&RolePermission{RoleId: roleId, Permission: permission}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (store *DbStore) Assign(ctx context.Context, uid int64, roleIds ...int64) error {
+	session := store.UserRoles.Db.Context(ctx)
+	for _, roleId := range roleIds {
+		userRole := &UserRole{Uid: uid, RoleId: roleId}
+		exist, err := session.Table(store.UserRoles.TableName).Exist(userRole)
+		if err != nil {
+			return err
+		}
+		if exist {
+			continue
+		}
+		userRole.Id, _ = id.Next()
+		if _, err = session.Table(store.UserRoles.TableName).Insert(userRole); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (store *DbStore) Unassign(ctx context.Context, uid int64, roleIds ...int64) error {
+	session := store.UserRoles.Db.Context(ctx)
+	for _, roleId := range roleIds {
+		if _, err := session.Table(store.UserRoles.TableName).Delete(&UserRole{Uid: uid, RoleId: roleId}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MemoryStore keeps roles in the process, for tests and roles fixed in code
+type MemoryStore struct {
+	mu          sync.RWMutex
+	roles       map[int64]*Role
+	permissions map[int64][]string
+	userRoles   map[int64][]int64
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{roles: map[int64]*Role{}, permissions: map[int64][]string{}, userRoles: map[int64][]int64{}}
+}
+
+func (store *MemoryStore) AddRole(ctx context.Context, role *Role) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if role.Id == 0 {
+		role.Id, _ = id.Next()
+	}
+	store.roles[role.Id] = role
+	return nil
+}
+
+func (store *MemoryStore) RemoveRole(ctx context.Context, roleId int64) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	delete(store.roles, roleId)
+	delete(store.permissions, roleId)
+	for uid, roleIds := range store.userRoles {
+		kept := []int64{}
+		for _, id := range roleIds {
+			if id != roleId {
+				kept = append(kept, id)
+			}
+		}
+		store.userRoles[uid] = kept
+	}
+	return nil
+}
+
+func (store *MemoryStore) Permissions(ctx context.Context, uid int64) ([]string, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	permissions := []string{}
+	seen := map[string]bool{}
+	for _, roleId := range store.userRoles[uid] {
+		for _, permission := range store.permissions[roleId] {
+			if !seen[permission] {
+				seen[permission] = true
+				permissions = append(permissions, permission)
+			}
+		}
+	}
+	return permissions, nil
+}
+
+func (store *MemoryStore) Grant(ctx context.Context, roleId int64, permissions ...string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	for _, permission := range permissions {
+		if !containsString(store.permissions[roleId], permission) {
+			store.permissions[roleId] = append(store.permissions[roleId], permission)
+		}
+	}
+	return nil
+}
+
+func (store *MemoryStore) Revoke(ctx context.Context, roleId int64, permissions ...string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	kept := []string{}
+	for _, permission := range store.permissions[roleId] {
+		if !containsString(permissions, permission) {
+			kept = append(kept, permission)
+		}
+	}
+	store.permissions[roleId] = kept
+	return nil
+}
+
+func (store *MemoryStore) Assign(ctx context.Context, uid int64, roleIds ...int64) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	for _, roleId := range roleIds {
+		if !containsId(store.userRoles[uid], roleId) {
+			store.userRoles[uid] = append(store.userRoles[uid], roleId)
+		}
+	}
+	return nil
+}
+
+func (store *MemoryStore) Unassign(ctx context.Context, uid int64, roleIds ...int64) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	kept := []int64{}
+	for _, roleId := range store.userRoles[uid] {
+		if !containsId(roleIds, roleId) {
+			kept = append(kept, roleId)
+		}
+	}
+	store.userRoles[uid] = kept
+	return nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func containsId(ids []int64, target int64) bool {
+	for _, i := range ids {
+		if i == target {
+			return true
+		}
+	}
+	return false
+}
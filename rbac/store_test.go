@@ -0,0 +1,27 @@
+package rbac
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sdjnlh/communal/internal/dbtest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDbStore_Permissions(t *testing.T) {
+	engine, db := dbtest.Open()
+	store := NewDbStore()
+	for _, module := range store.Modules() {
+		module.SetDB(engine)
+	}
+	db.Rows("FROM `rbac_user_role`", []string{"id", "uid", "role_id"}, []interface{}{int64(1), int64(7), int64(10)}, []interface{}{int64(2), int64(7), int64(11)})
+	db.Rows("FROM `rbac_role`", []string{"id"}, []interface{}{int64(10)})
+	db.Rows("FROM `rbac_role_permission`", []string{"id", "role_id", "permission"}, []interface{}{int64(3), int64(10), "article:*"})
+
+	permissions, err := store.Permissions(context.Background(), 7)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"article:*"}, permissions)
+	if found := db.Find("FROM `rbac_role_permission`"); assert.Len(t, found, 1) {
+		assert.Equal(t, []interface{}{int64(10)}, found[0].Args, "permissions of removed roles are not read")
+	}
+}
@@ -0,0 +1,117 @@
+package registry
+
+import (
+	"context"
+	"math/rand"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Balancer picks one of the healthy instances of a service
+type Balancer interface {
+	Pick(service string, instances []*Instance) *Instance
+}
+
+type RoundRobin struct {
+	counters sync.Map
+}
+
+func (rr *RoundRobin) Pick(service string, instances []*Instance) *Instance {
+	if len(instances) == 0 {
+		return nil
+	}
+	counter, _ := rr.counters.LoadOrStore(service, new(uint64))
+	n := atomic.AddUint64(counter.(*uint64), 1)
+	return instances[(n-1)%uint64(len(instances))]
+}
+
+type Random struct{}
+
+func (Random) Pick(service string, instances []*Instance) *Instance {
+	if len(instances) == 0 {
+		return nil
+	}
+	return instances[rand.Intn(len(instances))]
+}
+
+// Resolver resolves a service to one healthy instance, the instances of a
+// service are cached for TTL. Services without healthy instances are not cached,
+// they are looked up again on the next call.
+type Resolver struct {
+	Registry Registry
+	Balancer Balancer
+	TTL      time.Duration
+
+	mu    sync.Mutex
+	cache map[string]cached
+}
+
+type cached struct {
+	instances []*Instance
+	expires   time.Time
+}
+
+func NewResolver(registry Registry, balancer Balancer, ttl time.Duration) *Resolver {
+	if balancer == nil {
+		balancer = &RoundRobin{}
+	}
+	return &Resolver{Registry: registry, Balancer: balancer, TTL: ttl, cache: map[string]cached{}}
+}
+
+func (resolver *Resolver) Resolve(ctx context.Context, service string) (*Instance, error) {
+	instances, err := resolver.healthy(ctx, service)
+	if err != nil {
+		return nil, err
+	}
+	instance := resolver.Balancer.Pick(service, instances)
+	if instance == nil {
+		return nil, ErrNoInstance
+	}
+	return instance, nil
+}
+
+// Url resolves the url of an instance of service, it fits rpc.HttpClient.SetResolver
+func (resolver *Resolver) Url(ctx context.Context, service string) (string, error) {
+	instance, err := resolver.Resolve(ctx, service)
+	if err != nil {
+		return "", err
+	}
+	return instance.Url(), nil
+}
+
+func (resolver *Resolver) healthy(ctx context.Context, service string) ([]*Instance, error) {
+	resolver.mu.Lock()
+	entry, ok := resolver.cache[service]
+	resolver.mu.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		return entry.instances, nil
+	}
+
+	instances, err := resolver.Registry.Instances(ctx, service)
+	if err != nil {
+		return nil, err
+	}
+	var healthy []*Instance
+	for _, instance := range instances {
+		if instance.Healthy {
+			healthy = append(healthy, instance)
+		}
+	}
+
+	resolver.mu.Lock()
+	if resolver.TTL > 0 && len(healthy) > 0 {
+		resolver.cache[service] = cached{instances: healthy, expires: time.Now().Add(resolver.TTL)}
+	} else {
+		delete(resolver.cache, service)
+	}
+	resolver.mu.Unlock()
+	return healthy, nil
+}
+
+func sortInstances(instances []*Instance) {
+	sort.Slice(instances, func(i, j int) bool {
+		return instances[i].Id < instances[j].Id
+	})
+}
@@ -0,0 +1,105 @@
+package registry
+
+import (
+	"fmt"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	TypeConsul = "consul"
+	TypeStatic = "static"
+	TypeMemory = "memory"
+)
+
+// Config of a registry, e.g.
+//
+//	registry:
+//	  type: static
+//	  services:
+//	    article:
+//	      - id: article-1
+//	        address: 127.0.0.1:8081
+//
+// or
+//
+//	registry:
+//	  type: consul
+//	  consul:
+//	    address: http://127.0.0.1:8500
+type Config struct {
+	Type     string
+	Consul   ConsulConfig
+	Services map[string][]StaticInstance
+}
+
+// StaticInstance is healthy unless Down is set
+type StaticInstance struct {
+	Id      string
+	Address string
+	Down    bool
+	Meta    map[string]string
+}
+
+func FromConfig(cfg *viper.Viper) (Registry, error) {
+	conf := Config{}
+	if err := cfg.Unmarshal(&conf); err != nil {
+		return nil, err
+	}
+	return New(conf)
+}
+
+// FromFile reads a static registry from a config file of any format viper supports
+func FromFile(path string) (Registry, error) {
+	cfg := viper.New()
+	cfg.SetConfigFile(path)
+	if err := cfg.ReadInConfig(); err != nil {
+		return nil, err
+	}
+	if cfg.IsSet("registry") {
+		cfg = cfg.Sub("registry")
+	}
+	if !cfg.IsSet("type") {
+		cfg.Set("type", TypeStatic)
+	}
+	return FromConfig(cfg)
+}
+
+func New(conf Config) (Registry, error) {
+	switch conf.Type {
+	case TypeConsul:
+		return NewConsul(conf.Consul), nil
+	case TypeStatic, TypeMemory, "":
+		return NewStatic(conf.Services), nil
+	}
+	return nil, fmt.Errorf("unknown registry type %s", conf.Type)
+}
+
+// NewStatic is an in memory registry holding the given instances
+func NewStatic(services map[string][]StaticInstance) *Memory {
+	memory := NewMemory()
+	for service, instances := range services {
+		for i, si := range instances {
+			id := si.Id
+			if id == "" {
+				id = fmt.Sprintf("%s-%d", service, i+1)
+			}
+			memory.instances[service] = addInstance(memory.instances[service], &Instance{
+				Id:      id,
+				Service: service,
+				Address: si.Address,
+				Healthy: !si.Down,
+				Meta:    si.Meta,
+			})
+		}
+	}
+	return memory
+}
+
+func addInstance(instances map[string]*Instance, instance *Instance) map[string]*Instance {
+	if instances == nil {
+		instances = map[string]*Instance{}
+	}
+	instances[instance.Id] = instance
+	return instances
+}
@@ -0,0 +1,169 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type ConsulConfig struct {
+	Address string
+	Token   string
+	// CheckInterval of the tcp check registered with an instance, 10s by default
+	CheckInterval time.Duration
+	// DeregisterAfter removes instances critical for that long, 1m by default
+	DeregisterAfter time.Duration
+}
+
+// Consul is a registry backed by the HTTP API of a consul agent
+type Consul struct {
+	config ConsulConfig
+	client *http.Client
+}
+
+func NewConsul(config ConsulConfig) *Consul {
+	if config.Address == "" {
+		config.Address = "http://127.0.0.1:8500"
+	}
+	if !strings.Contains(config.Address, "://") {
+		config.Address = "http://" + config.Address
+	}
+	if config.CheckInterval <= 0 {
+		config.CheckInterval = 10 * time.Second
+	}
+	if config.DeregisterAfter <= 0 {
+		config.DeregisterAfter = time.Minute
+	}
+	return &Consul{config: config, client: &http.Client{Timeout: 5 * time.Second}}
+}
+
+type consulCheck struct {
+	TCP                            string `json:",omitempty"`
+	Interval                       string `json:",omitempty"`
+	DeregisterCriticalServiceAfter string `json:",omitempty"`
+	Status                         string `json:",omitempty"`
+}
+
+type consulService struct {
+	ID      string
+	Name    string `json:",omitempty"`
+	Service string `json:",omitempty"`
+	Address string
+	Port    int
+	Meta    map[string]string `json:",omitempty"`
+	Check   *consulCheck      `json:",omitempty"`
+}
+
+type consulEntry struct {
+	Service consulService
+	Checks  []consulCheck
+}
+
+func (consul *Consul) Register(ctx context.Context, instance *Instance) error {
+	host, port, err := splitAddress(instance.Address)
+	if err != nil {
+		return err
+	}
+
+	return consul.do(ctx, http.MethodPut, "/v1/agent/service/register", &consulService{
+		ID:      instance.Id,
+		Name:    instance.Service,
+		Address: host,
+		Port:    port,
+		Meta:    instance.Meta,
+		Check: &consulCheck{
+			TCP:                            net.JoinHostPort(host, strconv.Itoa(port)),
+			Interval:                       consul.config.CheckInterval.String(),
+			DeregisterCriticalServiceAfter: consul.config.DeregisterAfter.String(),
+		},
+	}, nil)
+}
+
+func (consul *Consul) Deregister(ctx context.Context, instance *Instance) error {
+	return consul.do(ctx, http.MethodPut, "/v1/agent/service/deregister/"+url.PathEscape(instance.Id), nil, nil)
+}
+
+// Instances reads the health of a service, an instance is healthy when all its checks pass
+func (consul *Consul) Instances(ctx context.Context, service string) ([]*Instance, error) {
+	var entries []consulEntry
+	if err := consul.do(ctx, http.MethodGet, "/v1/health/service/"+url.PathEscape(service), nil, &entries); err != nil {
+		return nil, err
+	}
+
+	instances := make([]*Instance, 0, len(entries))
+	for _, entry := range entries {
+		healthy := true
+		for _, check := range entry.Checks {
+			healthy = healthy && check.Status == "passing"
+		}
+		instances = append(instances, &Instance{
+			Id:      entry.Service.ID,
+			Service: entry.Service.Service,
+			Address: net.JoinHostPort(entry.Service.Address, strconv.Itoa(entry.Service.Port)),
+			Healthy: healthy,
+			Meta:    entry.Service.Meta,
+		})
+	}
+	sortInstances(instances)
+	return instances, nil
+}
+
+func (consul *Consul) do(ctx context.Context, method string, path string, body interface{}, reply interface{}) error {
+	var reader *bytes.Reader
+	if body != nil {
+		bts, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(bts)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+
+	req, err := http.NewRequest(method, consul.config.Address+path, reader)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	if consul.config.Token != "" {
+		req.Header.Set("X-Consul-Token", consul.config.Token)
+	}
+
+	resp, err := consul.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("consul %s %s: %s %s", method, path, resp.Status, strings.TrimSpace(string(data)))
+	}
+	if reply != nil {
+		return json.Unmarshal(data, reply)
+	}
+	return nil
+}
+
+func splitAddress(address string) (string, int, error) {
+	if idx := strings.Index(address, "://"); idx >= 0 {
+		address = address[idx+3:]
+	}
+	host, port, err := net.SplitHostPort(strings.TrimSuffix(address, "/"))
+	if err != nil {
+		return "", 0, err
+	}
+	p, err := strconv.Atoi(port)
+	return host, p, err
+}
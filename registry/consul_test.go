@@ -0,0 +1,89 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeConsul implements the agent and health endpoints used by Consul
+type fakeConsul struct {
+	mu       sync.Mutex
+	services map[string]consulService
+	token    string
+}
+
+func (fake *fakeConsul) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("X-Consul-Token") != fake.token {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	switch {
+	case r.Method == http.MethodPut && r.URL.Path == "/v1/agent/service/register":
+		var service consulService
+		_ = json.NewDecoder(r.Body).Decode(&service)
+		fake.services[service.ID] = service
+	case r.Method == http.MethodPut && strings.HasPrefix(r.URL.Path, "/v1/agent/service/deregister/"):
+		delete(fake.services, strings.TrimPrefix(r.URL.Path, "/v1/agent/service/deregister/"))
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/v1/health/service/"):
+		name := strings.TrimPrefix(r.URL.Path, "/v1/health/service/")
+		entries := []consulEntry{}
+		for _, service := range fake.services {
+			if service.Name != name {
+				continue
+			}
+			status := "passing"
+			if service.Meta["down"] == "true" {
+				status = "critical"
+			}
+			entries = append(entries, consulEntry{
+				Service: consulService{ID: service.ID, Service: service.Name, Address: service.Address, Port: service.Port, Meta: service.Meta},
+				Checks:  []consulCheck{{Status: "passing"}, {Status: status}},
+			})
+		}
+		_ = json.NewEncoder(w).Encode(entries)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestConsul(t *testing.T) {
+	fake := &fakeConsul{services: map[string]consulService{}, token: "secret"}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	ctx := context.Background()
+	consul := NewConsul(ConsulConfig{Address: server.URL, Token: "secret"})
+	a1 := &Instance{Id: "article-1", Service: "article", Address: "10.0.0.1:8081"}
+	a2 := &Instance{Id: "article-2", Service: "article", Address: "10.0.0.2:8081", Meta: map[string]string{"down": "true"}}
+	assert.NoError(t, consul.Register(ctx, a1))
+	assert.NoError(t, consul.Register(ctx, a2))
+	assert.Equal(t, "10.0.0.1:8081", fake.services["article-1"].Check.TCP)
+
+	instances, err := consul.Instances(ctx, "article")
+	assert.NoError(t, err)
+	assert.Len(t, instances, 2)
+	assert.Equal(t, "10.0.0.1:8081", instances[0].Address)
+	assert.True(t, instances[0].Healthy)
+	assert.False(t, instances[1].Healthy)
+
+	url, err := NewResolver(consul, nil, 0).Url(ctx, "article")
+	assert.NoError(t, err)
+	assert.Equal(t, "http://10.0.0.1:8081", url)
+
+	assert.NoError(t, consul.Deregister(ctx, a1))
+	instances, err = consul.Instances(ctx, "article")
+	assert.NoError(t, err)
+	assert.Len(t, instances, 1)
+
+	assert.Error(t, NewConsul(ConsulConfig{Address: server.URL}).Register(ctx, a1))
+}
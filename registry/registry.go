@@ -0,0 +1,111 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+)
+
+var ErrNoInstance = errors.New("no healthy instance")
+
+// Instance is one running instance of a service, Address is host:port or an url
+type Instance struct {
+	Id      string            `json:"id"`
+	Service string            `json:"service"`
+	Address string            `json:"address"`
+	Healthy bool              `json:"healthy"`
+	Meta    map[string]string `json:"meta,omitempty"`
+}
+
+// Url of the instance, http is assumed when Address has no scheme
+func (instance *Instance) Url() string {
+	if strings.Contains(instance.Address, "://") {
+		return instance.Address
+	}
+	return "http://" + instance.Address
+}
+
+// Registry registers instances on start, deregisters them on stop and resolves
+// a service name to its instances, healthy or not.
+type Registry interface {
+	Register(ctx context.Context, instance *Instance) error
+	Deregister(ctx context.Context, instance *Instance) error
+	Instances(ctx context.Context, service string) ([]*Instance, error)
+}
+
+var (
+	mu              sync.RWMutex
+	defaultRegistry Registry
+)
+
+func SetDefault(registry Registry) {
+	mu.Lock()
+	defaultRegistry = registry
+	mu.Unlock()
+}
+
+// Default registry of the process, nil when discovery is not configured
+func Default() Registry {
+	mu.RLock()
+	defer mu.RUnlock()
+	return defaultRegistry
+}
+
+// Memory keeps instances in memory, it backs the static registry and tests
+type Memory struct {
+	mu        sync.RWMutex
+	instances map[string]map[string]*Instance
+}
+
+func NewMemory(instances ...*Instance) *Memory {
+	memory := &Memory{instances: map[string]map[string]*Instance{}}
+	for _, instance := range instances {
+		_ = memory.Register(context.Background(), instance)
+	}
+	return memory
+}
+
+func (memory *Memory) Register(ctx context.Context, instance *Instance) error {
+	if instance.Service == "" || instance.Id == "" {
+		return errors.New("service and id needed to register an instance")
+	}
+
+	memory.mu.Lock()
+	defer memory.mu.Unlock()
+	if memory.instances[instance.Service] == nil {
+		memory.instances[instance.Service] = map[string]*Instance{}
+	}
+	copied := *instance
+	memory.instances[instance.Service][instance.Id] = &copied
+	return nil
+}
+
+func (memory *Memory) Deregister(ctx context.Context, instance *Instance) error {
+	memory.mu.Lock()
+	defer memory.mu.Unlock()
+	delete(memory.instances[instance.Service], instance.Id)
+	return nil
+}
+
+func (memory *Memory) Instances(ctx context.Context, service string) ([]*Instance, error) {
+	memory.mu.RLock()
+	defer memory.mu.RUnlock()
+
+	var instances []*Instance
+	for _, instance := range memory.instances[service] {
+		copied := *instance
+		instances = append(instances, &copied)
+	}
+	sortInstances(instances)
+	return instances, nil
+}
+
+// SetHealthy marks an instance, e.g. to simulate failures in tests
+func (memory *Memory) SetHealthy(service string, id string, healthy bool) {
+	memory.mu.Lock()
+	defer memory.mu.Unlock()
+	if instance := memory.instances[service][id]; instance != nil {
+		instance.Healthy = healthy
+	}
+}
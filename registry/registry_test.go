@@ -0,0 +1,92 @@
+package registry
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolver(t *testing.T) {
+	ctx := context.Background()
+	memory := NewMemory(
+		&Instance{Id: "a-1", Service: "a", Address: "10.0.0.1:80", Healthy: true},
+		&Instance{Id: "a-2", Service: "a", Address: "10.0.0.2:80", Healthy: true},
+		&Instance{Id: "a-3", Service: "a", Address: "10.0.0.3:80"},
+	)
+	resolver := NewResolver(memory, nil, 0)
+
+	var ids []string
+	for i := 0; i < 4; i++ {
+		instance, err := resolver.Resolve(ctx, "a")
+		assert.NoError(t, err)
+		ids = append(ids, instance.Id)
+	}
+	assert.Equal(t, []string{"a-1", "a-2", "a-1", "a-2"}, ids)
+
+	memory.SetHealthy("a", "a-1", false)
+	url, err := resolver.Url(ctx, "a")
+	assert.NoError(t, err)
+	assert.Equal(t, "http://10.0.0.2:80", url)
+
+	assert.NoError(t, memory.Deregister(ctx, &Instance{Id: "a-2", Service: "a"}))
+	_, err = resolver.Resolve(ctx, "a")
+	assert.Equal(t, ErrNoInstance, err)
+	_, err = resolver.Resolve(ctx, "b")
+	assert.Equal(t, ErrNoInstance, err)
+}
+
+func TestResolver_TTL(t *testing.T) {
+	ctx := context.Background()
+	memory := NewMemory(&Instance{Id: "a-1", Service: "a", Address: "10.0.0.1:80", Healthy: true})
+	resolver := NewResolver(memory, Random{}, time.Hour)
+
+	_, err := resolver.Resolve(ctx, "a")
+	assert.NoError(t, err)
+	memory.SetHealthy("a", "a-1", false)
+	_, err = resolver.Resolve(ctx, "a")
+	assert.NoError(t, err, "cached instances are used within ttl")
+}
+
+func TestResolver_NoHealthyInstance(t *testing.T) {
+	ctx := context.Background()
+	memory := NewMemory(&Instance{Id: "a-1", Service: "a", Address: "10.0.0.1:80"})
+	resolver := NewResolver(memory, nil, time.Hour)
+
+	_, err := resolver.Resolve(ctx, "a")
+	assert.Equal(t, ErrNoInstance, err)
+	memory.SetHealthy("a", "a-1", true)
+	_, err = resolver.Resolve(ctx, "a")
+	assert.NoError(t, err, "empty instance lists are not cached")
+}
+
+func TestFromConfig(t *testing.T) {
+	cfg := viper.New()
+	cfg.SetConfigType("yaml")
+	assert.NoError(t, cfg.ReadConfig(strings.NewReader(`
+type: static
+services:
+  article:
+    - address: 127.0.0.1:8081
+    - id: backup
+      address: 127.0.0.1:8082
+      down: true
+`)))
+
+	reg, err := FromConfig(cfg)
+	assert.NoError(t, err)
+	instances, err := reg.Instances(context.Background(), "article")
+	assert.NoError(t, err)
+	assert.Len(t, instances, 2)
+	assert.Equal(t, "article-1", instances[0].Id)
+	assert.True(t, instances[0].Healthy)
+	assert.Equal(t, "backup", instances[1].Id)
+	assert.False(t, instances[1].Healthy)
+
+	cfg.Set("type", "zookeeper")
+	_, err = FromConfig(cfg)
+	assert.Error(t, err)
+}
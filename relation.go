@@ -0,0 +1,346 @@
+package communal
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+
+	"github.com/sdjnlh/communal/db"
+	"github.com/sdjnlh/communal/errors"
+	"github.com/sdjnlh/communal/log"
+	"github.com/sdjnlh/communal/util"
+	"go.uber.org/zap"
+)
+
+type RelationKind int8
+
+const (
+	RelationBelongsTo RelationKind = iota
+	RelationHasMany
+	RelationManyToMany
+)
+
+// Relation declares rows of another module to be attached to the domains of a module.
+// Name is the json key of the domain field receiving the related rows, the field
+// is usually tagged with xorm:"-".
+type Relation struct {
+	Name   string
+	Kind   RelationKind
+	Target *Module
+	// column of the owner table for belongs-to, of the target table for has-many
+	ForeignKey string
+	// join table and its columns referencing the owner and the target for many-to-many
+	JoinTable     string
+	JoinKey       string
+	JoinTargetKey string
+}
+
+type expandKey struct{}
+
+// WithExpand asks Module.Get and Module.List to load the named relations.
+func WithExpand(ctx context.Context, names ...string) context.Context {
+	return context.WithValue(ctx, expandKey{}, names)
+}
+
+func ExpandFrom(ctx context.Context) []string {
+	if ctx == nil {
+		return nil
+	}
+	names, _ := ctx.Value(expandKey{}).([]string)
+	return names
+}
+
+func (module *Module) addRelation(relation *Relation) *Module {
+	if module.Relations == nil {
+		module.Relations = map[string]*Relation{}
+	}
+	module.Relations[relation.Name] = relation
+	return module
+}
+
+// BelongsTo declares that foreignKey of this module's table references the id of target.
+func (module *Module) BelongsTo(name string, target *Module, foreignKey string) *Module {
+	return module.addRelation(&Relation{Name: name, Kind: RelationBelongsTo, Target: target, ForeignKey: foreignKey})
+}
+
+// HasMany declares that foreignKey of the target table references the id of this module.
+func (module *Module) HasMany(name string, target *Module, foreignKey string) *Module {
+	return module.addRelation(&Relation{Name: name, Kind: RelationHasMany, Target: target, ForeignKey: foreignKey})
+}
+
+// ManyToMany declares rows of target linked through joinTable, joinKey referencing this
+// module and joinTargetKey referencing target.
+func (module *Module) ManyToMany(name string, target *Module, joinTable string, joinKey string, joinTargetKey string) *Module {
+	return module.addRelation(&Relation{
+		Name:          name,
+		Kind:          RelationManyToMany,
+		Target:        target,
+		JoinTable:     joinTable,
+		JoinKey:       joinKey,
+		JoinTargetKey: joinTargetKey,
+	})
+}
+
+// Expand loads the named relations into data, which is a domain pointer or a pointer to
+// a slice of domains. Every relation costs one IN query, two for many-to-many.
+func (module *Module) Expand(ctx context.Context, data interface{}, names ...string) error {
+	if len(names) == 0 || data == nil {
+		return nil
+	}
+
+	for _, name := range names {
+		if module.Relations[name] == nil {
+			return errors.InvalidParams().AddError(errors.InvalidField("expand", "unknown", "unknown relation "+name))
+		}
+	}
+
+	owners := structValues(reflect.ValueOf(data))
+	if len(owners) == 0 {
+		return nil
+	}
+
+	fields := util.StructFields(owners[0].Type(), module.columnMapper())
+	for _, name := range names {
+		relation := module.Relations[name]
+		field, ok := util.FieldByJson(fields, name)
+		if !ok {
+			return errors.ServerErrorWithMsg("no field for relation " + name + " in domain of module " + module.Name)
+		}
+
+		var err error
+		switch relation.Kind {
+		case RelationBelongsTo:
+			err = module.loadBelongsTo(relation, owners, fields, field)
+		case RelationHasMany:
+			err = module.loadHasMany(relation, owners, field)
+		case RelationManyToMany:
+			err = module.loadManyToMany(relation, owners, field)
+		}
+		if err != nil {
+			log.Ctx(ctx).Error("fail to expand relation", zap.String("module", module.Name), zap.String("relation", name), zap.Error(err))
+			return err
+		}
+	}
+	return nil
+}
+
+func (module *Module) loadBelongsTo(relation *Relation, owners []reflect.Value, fields []util.StructField, field util.StructField) error {
+	fk, ok := util.FieldByColumn(fields, relation.ForeignKey)
+	if !ok {
+		return errors.ServerErrorWithMsg("no field mapped to column " + relation.ForeignKey + " in domain of module " + module.Name)
+	}
+
+	var ids []interface{}
+	for _, owner := range owners {
+		if id, ok := intValue(owner.FieldByIndex(fk.Index)); ok && id != 0 {
+			ids = append(ids, id)
+		}
+	}
+
+	related, err := relation.find(module, elemType(field.Type), "id", ids)
+	if err != nil {
+		return err
+	}
+	byId := map[int64]reflect.Value{}
+	for _, rv := range related {
+		byId[idOf(rv)] = rv
+	}
+
+	for _, owner := range owners {
+		id, _ := intValue(owner.FieldByIndex(fk.Index))
+		if rv, ok := byId[id]; ok {
+			assign(owner.FieldByIndex(field.Index), rv)
+		}
+	}
+	return nil
+}
+
+func (module *Module) loadHasMany(relation *Relation, owners []reflect.Value, field util.StructField) error {
+	ids := ownerIds(owners)
+	related, err := relation.find(module, elemType(field.Type), relation.ForeignKey, ids)
+	if err != nil || len(related) == 0 {
+		return err
+	}
+
+	fk, ok := util.FieldByColumn(util.StructFields(related[0].Type(), relation.Target.columnMapper()), relation.ForeignKey)
+	if !ok {
+		return errors.ServerErrorWithMsg("no field mapped to column " + relation.ForeignKey + " in domain of module " + relation.Target.Name)
+	}
+	children := map[int64][]reflect.Value{}
+	for _, rv := range related {
+		id, _ := intValue(rv.Elem().FieldByIndex(fk.Index))
+		children[id] = append(children[id], rv)
+	}
+
+	for _, owner := range owners {
+		for _, child := range children[idOf(owner.Addr())] {
+			appendTo(owner.FieldByIndex(field.Index), child)
+		}
+	}
+	return nil
+}
+
+func (module *Module) loadManyToMany(relation *Relation, owners []reflect.Value, field util.StructField) error {
+	ids := ownerIds(owners)
+	if len(ids) == 0 {
+		return nil
+	}
+
+	links, err := module.Db.Table(relation.JoinTable).Cols(relation.JoinKey, relation.JoinTargetKey).In(relation.JoinKey, ids...).QueryString()
+	if err != nil {
+		return err
+	}
+
+	var targetIds []interface{}
+	seen := map[int64]bool{}
+	linked := map[int64][]int64{}
+	for _, link := range links {
+		ownerId, err1 := strconv.ParseInt(link[relation.JoinKey], 10, 64)
+		targetId, err2 := strconv.ParseInt(link[relation.JoinTargetKey], 10, 64)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		linked[ownerId] = append(linked[ownerId], targetId)
+		if !seen[targetId] {
+			seen[targetId] = true
+			targetIds = append(targetIds, targetId)
+		}
+	}
+
+	related, err := relation.find(module, elemType(field.Type), "id", targetIds)
+	if err != nil {
+		return err
+	}
+	byId := map[int64]reflect.Value{}
+	for _, rv := range related {
+		byId[idOf(rv)] = rv
+	}
+
+	for _, owner := range owners {
+		for _, targetId := range linked[idOf(owner.Addr())] {
+			if rv, ok := byId[targetId]; ok {
+				appendTo(owner.FieldByIndex(field.Index), rv)
+			}
+		}
+	}
+	return nil
+}
+
+// find loads rows of the target module whose column is one of values, as pointers to
+// typ, skipping soft deleted rows
+func (relation *Relation) find(owner *Module, typ reflect.Type, column string, values []interface{}) ([]reflect.Value, error) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+
+	engine := relation.Target.Db
+	if engine == nil {
+		engine = owner.Db
+	}
+	ss := engine.Table(relation.Target.TableName).In(column, values...)
+	if softDeletable(engine, reflect.New(typ).Interface()) {
+		ss.Where(db.UndeletedCause)
+	}
+	slice := reflect.New(reflect.SliceOf(reflect.PtrTo(typ)))
+	if err := ss.Find(slice.Interface()); err != nil {
+		return nil, err
+	}
+
+	rows := make([]reflect.Value, slice.Elem().Len())
+	for i := range rows {
+		rows[i] = slice.Elem().Index(i)
+	}
+	return rows, nil
+}
+
+// structValues returns addressable struct values held by a domain pointer or slice pointer
+func structValues(v reflect.Value) []reflect.Value {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		if v.Kind() == reflect.Ptr && v.Elem().Kind() == reflect.Struct {
+			return []reflect.Value{v.Elem()}
+		}
+		v = v.Elem()
+	}
+
+	if v.Kind() != reflect.Slice {
+		return nil
+	}
+	values := make([]reflect.Value, 0, v.Len())
+	for i := 0; i < v.Len(); i++ {
+		item := v.Index(i)
+		for item.Kind() == reflect.Ptr || item.Kind() == reflect.Interface {
+			if item.IsNil() {
+				break
+			}
+			item = item.Elem()
+		}
+		if item.Kind() == reflect.Struct && item.CanAddr() {
+			values = append(values, item)
+		}
+	}
+	return values
+}
+
+func ownerIds(owners []reflect.Value) []interface{} {
+	var ids []interface{}
+	for _, owner := range owners {
+		if id := idOf(owner.Addr()); id != 0 {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+func idOf(ptr reflect.Value) int64 {
+	if idm, ok := ptr.Interface().(IdInf); ok {
+		return idm.GetId()
+	}
+	if field, ok := util.FieldByColumn(util.StructFields(ptr.Type(), nil), "id"); ok {
+		id, _ := intValue(ptr.Elem().FieldByIndex(field.Index))
+		return id
+	}
+	return 0
+}
+
+func intValue(v reflect.Value) (int64, bool) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int(), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(v.Uint()), true
+	case reflect.Ptr:
+		if !v.IsNil() {
+			return intValue(v.Elem())
+		}
+	}
+	return 0, false
+}
+
+// elemType is the struct type of a relation field: T, *T, []T or []*T
+func elemType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	return t
+}
+
+// assign sets a *T row to a field of type T or *T
+func assign(field reflect.Value, row reflect.Value) {
+	if field.Kind() == reflect.Ptr {
+		field.Set(row)
+	} else {
+		field.Set(row.Elem())
+	}
+}
+
+// appendTo appends a *T row to a field of type []T or []*T
+func appendTo(field reflect.Value, row reflect.Value) {
+	if field.Type().Elem().Kind() == reflect.Ptr {
+		field.Set(reflect.Append(field, row))
+	} else {
+		field.Set(reflect.Append(field, row.Elem()))
+	}
+}
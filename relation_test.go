@@ -0,0 +1,108 @@
+package communal
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sdjnlh/communal/internal/dbtest"
+	"github.com/sdjnlh/communal/log"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+type relAuthor struct {
+	DBase `xorm:"extends"`
+	Name  string `json:"name"`
+}
+
+type relComment struct {
+	DBase  `xorm:"extends"`
+	PostId int64  `json:"postId"`
+	Body   string `json:"body"`
+}
+
+type relTag struct {
+	ID   `xorm:"extends"`
+	Name string `json:"name"`
+}
+
+type relPost struct {
+	DBase    `xorm:"extends"`
+	AuthorId int64        `json:"authorId"`
+	Author   *relAuthor   `json:"author" xorm:"-"`
+	Comments []relComment `json:"comments" xorm:"-"`
+	Tags     []*relTag    `json:"tags" xorm:"-"`
+}
+
+func relationModules() (*Module, *dbtest.DB) {
+	engine, db := dbtest.Open()
+	authors := NewModule("author", "rel_author", "/authors")
+	comments := NewModule("comment", "rel_comment", "/comments")
+	tags := NewModule("tag", "rel_tag", "/tags")
+	posts := NewModule("post", "rel_post", "/posts").
+		BelongsTo("author", authors, "author_id").
+		HasMany("comments", comments, "post_id").
+		ManyToMany("tags", tags, "rel_post_tag", "post_id", "tag_id")
+	for _, module := range []*Module{authors, comments, tags, posts} {
+		module.SetDB(engine)
+	}
+	return posts, db
+}
+
+func TestModule_ExpandBelongsTo(t *testing.T) {
+	posts, db := relationModules()
+	db.Rows("FROM `rel_author`", []string{"id", "name"}, []interface{}{int64(10), "ann"})
+
+	list := []relPost{{DBase: DBase{ID: ID{Id: 1}}, AuthorId: 10}, {DBase: DBase{ID: ID{Id: 2}}, AuthorId: 11}}
+	assert.NoError(t, posts.Expand(context.Background(), &list, "author"))
+	assert.Equal(t, "ann", list[0].Author.Name)
+	assert.Nil(t, list[1].Author)
+
+	statements := db.Find("FROM `rel_author`")
+	assert.Len(t, statements, 1)
+	assert.Contains(t, statements[0].SQL, "(dtd=false)")
+	assert.Equal(t, []interface{}{int64(10), int64(11)}, statements[0].Args)
+}
+
+func TestModule_ExpandHasMany(t *testing.T) {
+	posts, db := relationModules()
+	db.Rows("FROM `rel_comment`", []string{"id", "post_id", "body"},
+		[]interface{}{int64(20), int64(1), "a"}, []interface{}{int64(21), int64(1), "b"})
+
+	post := &relPost{DBase: DBase{ID: ID{Id: 1}}}
+	assert.NoError(t, posts.Expand(context.Background(), post, "comments"))
+	assert.Len(t, post.Comments, 2)
+	assert.Equal(t, "b", post.Comments[1].Body)
+	assert.Contains(t, db.Find("FROM `rel_comment`")[0].SQL, "(dtd=false)")
+}
+
+func TestModule_ExpandManyToMany(t *testing.T) {
+	posts, db := relationModules()
+	db.Rows("FROM `rel_post_tag`", []string{"post_id", "tag_id"},
+		[]interface{}{int64(1), int64(30)}, []interface{}{int64(2), int64(30)}, []interface{}{int64(2), int64(31)})
+	db.Rows("FROM `rel_tag`", []string{"id", "name"}, []interface{}{int64(30), "go"}, []interface{}{int64(31), "sql"})
+
+	list := []*relPost{{DBase: DBase{ID: ID{Id: 1}}}, {DBase: DBase{ID: ID{Id: 2}}}}
+	assert.NoError(t, posts.Expand(context.Background(), &list, "tags"))
+	assert.Len(t, list[0].Tags, 1)
+	assert.Len(t, list[1].Tags, 2)
+	assert.Equal(t, "sql", list[1].Tags[1].Name)
+	// tags have no dtd column
+	assert.NotContains(t, db.Find("FROM `rel_tag`")[0].SQL, "dtd")
+}
+
+func TestModule_ExpandErrors(t *testing.T) {
+	log.Logger.Logger = zap.NewNop()
+	posts, _ := relationModules()
+	post := &relPost{DBase: DBase{ID: ID{Id: 1}}}
+
+	assert.Error(t, posts.Expand(context.Background(), post, "editor"))
+
+	posts.BelongsTo("editor", posts.Relations["author"].Target, "editor_id")
+	type editedPost struct {
+		relPost `xorm:"extends"`
+		Editor  *relAuthor `json:"editor" xorm:"-"`
+	}
+	assert.Error(t, posts.Expand(context.Background(), &editedPost{}, "editor"))
+	assert.Error(t, posts.Expand(context.Background(), &struct{ DBase }{}, "author"))
+}
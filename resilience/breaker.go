@@ -0,0 +1,133 @@
+package resilience
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/sdjnlh/communal/log"
+	"go.uber.org/zap"
+)
+
+type State int
+
+const (
+	StateClosed State = iota
+	StateOpen
+	StateHalfOpen
+)
+
+var ErrOpen = errors.New("circuit breaker is open")
+
+func (state State) String() string {
+	switch state {
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	}
+	return "closed"
+}
+
+func (state State) MarshalText() ([]byte, error) {
+	return []byte(state.String()), nil
+}
+
+// BreakerConfig opens the breaker after Failures consecutive failures, after
+// OpenTimeout up to Probes calls are let through half-open and the breaker closes
+// when all of them succeed. A zero Failures disables the breaker.
+type BreakerConfig struct {
+	Failures    int
+	OpenTimeout time.Duration
+	Probes      int
+}
+
+type Breaker struct {
+	name   string
+	config BreakerConfig
+
+	mu       sync.Mutex
+	state    State
+	failures int
+	probing  int
+	passed   int
+	openedAt time.Time
+	now      func() time.Time
+}
+
+func NewBreaker(name string, config BreakerConfig) *Breaker {
+	if config.OpenTimeout <= 0 {
+		config.OpenTimeout = 30 * time.Second
+	}
+	if config.Probes <= 0 {
+		config.Probes = 1
+	}
+	return &Breaker{name: name, config: config, now: time.Now}
+}
+
+// Allow reserves a call, ErrOpen is returned while the breaker is open or all
+// half-open probes are taken.
+func (breaker *Breaker) Allow() error {
+	if breaker.config.Failures <= 0 {
+		return nil
+	}
+
+	breaker.mu.Lock()
+	defer breaker.mu.Unlock()
+	if breaker.state == StateOpen && breaker.now().Sub(breaker.openedAt) >= breaker.config.OpenTimeout {
+		breaker.transit(StateHalfOpen)
+	}
+
+	switch breaker.state {
+	case StateOpen:
+		return ErrOpen
+	case StateHalfOpen:
+		if breaker.probing+breaker.passed >= breaker.config.Probes {
+			return ErrOpen
+		}
+		breaker.probing++
+	}
+	return nil
+}
+
+// Done reports the outcome of an allowed call
+func (breaker *Breaker) Done(success bool) {
+	if breaker.config.Failures <= 0 {
+		return
+	}
+
+	breaker.mu.Lock()
+	defer breaker.mu.Unlock()
+	switch breaker.state {
+	case StateClosed:
+		if success {
+			breaker.failures = 0
+		} else if breaker.failures++; breaker.failures >= breaker.config.Failures {
+			breaker.transit(StateOpen)
+		}
+	case StateHalfOpen:
+		breaker.probing--
+		if !success {
+			breaker.transit(StateOpen)
+		} else if breaker.passed++; breaker.passed >= breaker.config.Probes {
+			breaker.transit(StateClosed)
+		}
+	}
+}
+
+func (breaker *Breaker) State() State {
+	breaker.mu.Lock()
+	defer breaker.mu.Unlock()
+	return breaker.state
+}
+
+func (breaker *Breaker) transit(state State) {
+	log.Logger.Warn("circuit breaker "+state.String(), zap.String("target", breaker.name), zap.String("from", breaker.state.String()), zap.Int("failures", breaker.failures))
+	breaker.state = state
+	breaker.failures = 0
+	breaker.probing = 0
+	breaker.passed = 0
+	if state == StateOpen {
+		breaker.openedAt = breaker.now()
+	}
+}
@@ -0,0 +1,45 @@
+package resilience
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+)
+
+// TargetState is the state of the calls to a target
+type TargetState struct {
+	Target   string `json:"target"`
+	Breaker  State  `json:"breaker"`
+	InFlight int    `json:"inFlight"`
+}
+
+// Snapshot of the targets called so far, sorted by name
+func (executor *Executor) Snapshot() []TargetState {
+	executor.mu.Lock()
+	defer executor.mu.Unlock()
+
+	states := make([]TargetState, 0, len(executor.targets))
+	for name, t := range executor.targets {
+		states = append(states, TargetState{Target: name, Breaker: t.breaker.State(), InFlight: len(t.bulkhead)})
+	}
+	sort.Slice(states, func(i, j int) bool {
+		return states[i].Target < states[j].Target
+	})
+	return states
+}
+
+// HealthHandler answers the snapshot of the default executor, with status 503
+// while a breaker is open.
+func HealthHandler(w http.ResponseWriter, r *http.Request) {
+	states := Default().Snapshot()
+	status := http.StatusOK
+	for _, state := range states {
+		if state.Breaker == StateOpen {
+			status = http.StatusServiceUnavailable
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"ok": status == http.StatusOK, "targets": states})
+}
@@ -0,0 +1,239 @@
+package resilience
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+var ErrBulkheadFull = errors.New("too many concurrent calls")
+
+// Retry makes up to Attempts attempts, waiting Backoff*Multiplier^n between them, at most
+// MaxBackoff. Jitter is the fraction of a wait randomly taken off, 0 to 1.
+type Retry struct {
+	Attempts   int
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	Multiplier float64
+	Jitter     float64
+}
+
+// Policy of the calls to a target, Timeout limits each attempt and MaxConcurrent the
+// calls in flight, zero values disable them.
+type Policy struct {
+	Retry         Retry
+	Breaker       BreakerConfig
+	Timeout       time.Duration
+	MaxConcurrent int
+}
+
+// Config of an executor, Targets override Default by target name, e.g.
+//
+//	resilience:
+//	  default:
+//	    breaker: {failures: 5, openTimeout: 30s}
+//	  targets:
+//	    rpc.article:
+//	      retry: {attempts: 3, backoff: 100ms, jitter: 0.5}
+//	      timeout: 2s
+//	      maxConcurrent: 50
+type Config struct {
+	Default Policy
+	Targets map[string]Policy
+}
+
+var DefaultPolicy = Policy{
+	Retry:   Retry{Attempts: 1},
+	Breaker: BreakerConfig{Failures: 5, OpenTimeout: 30 * time.Second},
+}
+
+type permanent struct {
+	err error
+}
+
+func (p *permanent) Error() string {
+	return p.err.Error()
+}
+
+func (p *permanent) Unwrap() error {
+	return p.err
+}
+
+// Permanent marks an error as an answer of the target, e.g. a business error: it is
+// neither retried nor counted as a failure by the breaker.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanent{err: err}
+}
+
+type target struct {
+	policy   Policy
+	breaker  *Breaker
+	bulkhead chan struct{}
+}
+
+// Executor runs calls to named targets under their policies
+type Executor struct {
+	mu      sync.Mutex
+	config  Config
+	targets map[string]*target
+}
+
+func NewExecutor(config Config) *Executor {
+	if config.Default == (Policy{}) {
+		config.Default = DefaultPolicy
+	}
+	return &Executor{config: config, targets: map[string]*target{}}
+}
+
+var (
+	mu              sync.RWMutex
+	defaultExecutor = NewExecutor(Config{})
+)
+
+func Default() *Executor {
+	mu.RLock()
+	defer mu.RUnlock()
+	return defaultExecutor
+}
+
+// Configure adds config to the default executor, see Executor.Configure. The apps of
+// a process configure their targets in turn, none replacing the others.
+func Configure(config Config) {
+	Default().Configure(config)
+}
+
+// Configure sets the policies of the targets of config, and the default policy when
+// set. The targets whose policy changes start over, the others keep their state.
+func (executor *Executor) Configure(config Config) *Executor {
+	executor.mu.Lock()
+	defer executor.mu.Unlock()
+
+	if executor.config.Targets == nil {
+		executor.config.Targets = map[string]Policy{}
+	}
+	for name, policy := range config.Targets {
+		executor.config.Targets[name] = policy
+		delete(executor.targets, name)
+	}
+	if config.Default != (Policy{}) {
+		executor.config.Default = config.Default
+		for name := range executor.targets {
+			if _, ok := executor.config.Targets[name]; !ok {
+				delete(executor.targets, name)
+			}
+		}
+	}
+	return executor
+}
+
+type onceKey struct{}
+
+// Once makes the calls run with ctx be attempted once, whatever the retry policy of
+// their target, e.g. calls which are not idempotent
+func Once(ctx context.Context) context.Context {
+	return context.WithValue(ctx, onceKey{}, true)
+}
+
+func (executor *Executor) target(name string) *target {
+	executor.mu.Lock()
+	defer executor.mu.Unlock()
+
+	t := executor.targets[name]
+	if t == nil {
+		policy, ok := executor.config.Targets[name]
+		if !ok {
+			policy = executor.config.Default
+		}
+		t = &target{policy: policy, breaker: NewBreaker(name, policy.Breaker)}
+		if policy.MaxConcurrent > 0 {
+			t.bulkhead = make(chan struct{}, policy.MaxConcurrent)
+		}
+		executor.targets[name] = t
+	}
+	return t
+}
+
+// Do runs call against target with retries, breaker, bulkhead and timeout of its policy
+func (executor *Executor) Do(ctx context.Context, name string, call func(ctx context.Context) error) error {
+	t := executor.target(name)
+	if t.bulkhead != nil {
+		select {
+		case t.bulkhead <- struct{}{}:
+			defer func() { <-t.bulkhead }()
+		default:
+			return ErrBulkheadFull
+		}
+	}
+
+	attempts := t.policy.Retry.Attempts
+	if once, _ := ctx.Value(onceKey{}).(bool); attempts < 1 || once {
+		attempts = 1
+	}
+	var err error
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			if err := sleep(ctx, t.policy.Retry.delay(attempt)); err != nil {
+				return err
+			}
+		}
+
+		if err = t.breaker.Allow(); err != nil {
+			return err
+		}
+		err = try(ctx, t.policy.Timeout, call)
+		var p *permanent
+		if errors.As(err, &p) {
+			t.breaker.Done(true)
+			return p.err
+		}
+		t.breaker.Done(err == nil)
+		if err == nil || ctx.Err() != nil {
+			return err
+		}
+	}
+	return err
+}
+
+func try(ctx context.Context, timeout time.Duration, call func(ctx context.Context) error) error {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	return call(ctx)
+}
+
+func (retry Retry) delay(attempt int) time.Duration {
+	multiplier := retry.Multiplier
+	if multiplier < 1 {
+		multiplier = 2
+	}
+	delay := float64(retry.Backoff) * math.Pow(multiplier, float64(attempt-1))
+	if retry.MaxBackoff > 0 && delay > float64(retry.MaxBackoff) {
+		delay = float64(retry.MaxBackoff)
+	}
+	if retry.Jitter > 0 {
+		delay -= delay * math.Min(retry.Jitter, 1) * rand.Float64()
+	}
+	return time.Duration(delay)
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,123 @@
+package resilience
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sdjnlh/communal/log"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+var errFail = errors.New("fail")
+
+func TestExecutor_Retry(t *testing.T) {
+	executor := NewExecutor(Config{Default: Policy{Retry: Retry{Attempts: 3, Backoff: time.Millisecond, Jitter: 0.5}}})
+
+	calls := 0
+	err := executor.Do(context.Background(), "a", func(ctx context.Context) error {
+		if calls++; calls < 3 {
+			return errFail
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, calls)
+
+	calls = 0
+	err = executor.Do(context.Background(), "a", func(ctx context.Context) error {
+		calls++
+		return Permanent(errFail)
+	})
+	assert.Equal(t, errFail, err)
+	assert.Equal(t, 1, calls)
+}
+
+func TestRetry_Delay(t *testing.T) {
+	retry := Retry{Backoff: 10 * time.Millisecond, MaxBackoff: 30 * time.Millisecond}
+	assert.Equal(t, 10*time.Millisecond, retry.delay(1))
+	assert.Equal(t, 20*time.Millisecond, retry.delay(2))
+	assert.Equal(t, 30*time.Millisecond, retry.delay(3))
+
+	retry.Jitter = 1
+	for i := 0; i < 10; i++ {
+		assert.True(t, retry.delay(1) <= 10*time.Millisecond)
+	}
+}
+
+func TestBreaker(t *testing.T) {
+	log.Logger.Logger = zap.NewNop()
+	now := time.Now()
+	breaker := NewBreaker("b", BreakerConfig{Failures: 2, OpenTimeout: time.Second, Probes: 1})
+	breaker.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		assert.NoError(t, breaker.Allow())
+		breaker.Done(false)
+	}
+	assert.Equal(t, StateOpen, breaker.State())
+	assert.Equal(t, ErrOpen, breaker.Allow())
+
+	now = now.Add(time.Second)
+	assert.NoError(t, breaker.Allow())
+	assert.Equal(t, StateHalfOpen, breaker.State())
+	assert.Equal(t, ErrOpen, breaker.Allow(), "only one probe is let through")
+	breaker.Done(false)
+	assert.Equal(t, StateOpen, breaker.State())
+
+	now = now.Add(time.Second)
+	assert.NoError(t, breaker.Allow())
+	breaker.Done(true)
+	assert.Equal(t, StateClosed, breaker.State())
+}
+
+func TestExecutor_BulkheadAndTimeout(t *testing.T) {
+	log.Logger.Logger = zap.NewNop()
+	executor := NewExecutor(Config{Default: Policy{MaxConcurrent: 1, Timeout: 20 * time.Millisecond, Breaker: BreakerConfig{Failures: 1}}})
+
+	started := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := executor.Do(context.Background(), "c", func(ctx context.Context) error {
+			close(started)
+			<-ctx.Done()
+			return ctx.Err()
+		})
+		assert.Equal(t, context.DeadlineExceeded, err)
+	}()
+	<-started
+	assert.Equal(t, ErrBulkheadFull, executor.Do(context.Background(), "c", func(ctx context.Context) error { return nil }))
+	wg.Wait()
+
+	assert.Equal(t, []TargetState{{Target: "c", Breaker: StateOpen}}, executor.Snapshot())
+	assert.Equal(t, ErrOpen, executor.Do(context.Background(), "c", func(ctx context.Context) error { return nil }))
+
+	Configure(Config{Default: Policy{Breaker: BreakerConfig{Failures: 1}}})
+	_ = Default().Do(context.Background(), "d", func(ctx context.Context) error { return errFail })
+	w := httptest.NewRecorder()
+	HealthHandler(w, httptest.NewRequest(http.MethodGet, "/health", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Contains(t, w.Body.String(), `"breaker":"open"`)
+}
+
+func TestExecutor_Configure(t *testing.T) {
+	executor := NewExecutor(Config{Targets: map[string]Policy{"a": {Retry: Retry{Attempts: 2}}}})
+	executor.Configure(Config{Targets: map[string]Policy{"b": {Retry: Retry{Attempts: 3}}}})
+
+	count := func(ctx context.Context, target string) int {
+		n := 0
+		_ = executor.Do(ctx, target, func(ctx context.Context) error { n++; return errFail })
+		return n
+	}
+	assert.Equal(t, 2, count(context.Background(), "a"), "targets of earlier configs are kept")
+	assert.Equal(t, 3, count(context.Background(), "b"))
+	assert.Equal(t, 1, count(context.Background(), "c"))
+	assert.Equal(t, 1, count(Once(context.Background()), "b"))
+}
@@ -0,0 +1,25 @@
+package rpc
+
+import (
+	"encoding/json"
+
+	"github.com/sdjnlh/communal"
+)
+
+// PatchArgs are the args of the Patch method, Patch is a JSON merge patch
+type PatchArgs struct {
+	Id    int64           `json:"id,string"`
+	Patch json.RawMessage `json:"patch"`
+}
+
+// StatsArgs are the args of the Stats method
+type StatsArgs struct {
+	Filter interface{}          `json:"filter"`
+	Query  *communal.StatsQuery `json:"query"`
+}
+
+// HistoryArgs are the args of the History method
+type HistoryArgs struct {
+	Id   int64          `json:"id,string"`
+	Page *communal.Page `json:"page"`
+}
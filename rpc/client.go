@@ -0,0 +1,266 @@
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sdjnlh/communal"
+	"github.com/sdjnlh/communal/errors"
+	"github.com/sdjnlh/communal/log"
+	"github.com/sdjnlh/communal/resilience"
+	"go.uber.org/zap"
+)
+
+const (
+	DefaultTimeout = 5 * time.Second
+
+	HeaderUid   = "X-Uid"
+	HeaderOrgId = "X-Org-Id"
+)
+
+// Config of the http client, e.g.
+//
+//	rpc:
+//	  timeout: 5s
+//	  secret: shared-with-the-services
+//	  services:
+//	    article:
+//	      url: http://127.0.0.1:8081/rpc
+//	      timeout: 2s
+type Config struct {
+	Timeout time.Duration
+	// Secret signs the calls, see Server.SetSecret
+	Secret   string
+	Services map[string]ServiceConfig
+}
+
+type ServiceConfig struct {
+	Url     string
+	Timeout time.Duration
+}
+
+// HttpClient calls services with JSON over HTTP: args are posted to
+// {url}/{service}/{method}, with the url configured or resolved, and the reply
+// is read from a 200 response body. Any other status carries a SimpleBizError,
+// which is returned as the error.
+type HttpClient struct {
+	mu         sync.RWMutex
+	timeout    time.Duration
+	secret     string
+	services   map[string]ServiceConfig
+	idempotent map[string]bool
+	resolve    func(ctx context.Context, service string) (string, error)
+	exec       *resilience.Executor
+	client     *http.Client
+}
+
+func NewHttpClient(config Config) *HttpClient {
+	client := &HttpClient{
+		timeout:    DefaultTimeout,
+		services:   map[string]ServiceConfig{},
+		idempotent: map[string]bool{"Get": true, "List": true, "Stats": true, "History": true},
+		client:     &http.Client{},
+	}
+	client.Configure(config)
+	return client
+}
+
+func (client *HttpClient) Configure(config Config) *HttpClient {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	if config.Timeout > 0 {
+		client.timeout = config.Timeout
+	}
+	if config.Secret != "" {
+		client.secret = config.Secret
+	}
+	for name, service := range config.Services {
+		client.services[name] = service
+	}
+	return client
+}
+
+// SetExecutor replaces the default resilience executor for this client
+func (client *HttpClient) SetExecutor(executor *resilience.Executor) *HttpClient {
+	client.mu.Lock()
+	client.exec = executor
+	client.mu.Unlock()
+	return client
+}
+
+func (client *HttpClient) executor() *resilience.Executor {
+	client.mu.RLock()
+	defer client.mu.RUnlock()
+	if client.exec != nil {
+		return client.exec
+	}
+	return resilience.Default()
+}
+
+// SetIdempotent adds methods to the ones retried, Get, List, Stats and History by default
+func (client *HttpClient) SetIdempotent(methods ...string) *HttpClient {
+	client.mu.Lock()
+	for _, method := range methods {
+		client.idempotent[method] = true
+	}
+	client.mu.Unlock()
+	return client
+}
+
+func (client *HttpClient) retryable(ctx context.Context, method string) bool {
+	if retry, _ := ctx.Value(retryKey{}).(bool); retry {
+		return true
+	}
+	client.mu.RLock()
+	defer client.mu.RUnlock()
+	return client.idempotent[method]
+}
+
+type retryKey struct{}
+
+// WithRetry makes the calls with ctx retried whatever their method, for callers
+// knowing them to be idempotent
+func WithRetry(ctx context.Context) context.Context {
+	return context.WithValue(ctx, retryKey{}, true)
+}
+
+func (client *HttpClient) SetService(name string, service ServiceConfig) *HttpClient {
+	client.mu.Lock()
+	client.services[name] = service
+	client.mu.Unlock()
+	return client
+}
+
+// SetResolver looks up the url of services configured without one, e.g. with
+// registry.Resolver.Url
+func (client *HttpClient) SetResolver(resolve func(ctx context.Context, service string) (string, error)) *HttpClient {
+	client.mu.Lock()
+	client.resolve = resolve
+	client.mu.Unlock()
+	return client
+}
+
+func (client *HttpClient) url(ctx context.Context, service string, sc ServiceConfig) (string, error) {
+	if sc.Url != "" {
+		return sc.Url, nil
+	}
+
+	client.mu.RLock()
+	resolve := client.resolve
+	client.mu.RUnlock()
+	if resolve == nil {
+		return "", resilience.Permanent(errors.RPCFailedWithMsg("no rpc service configured: " + service))
+	}
+	url, err := resolve(ctx, service)
+	if err != nil {
+		return "", errors.WrapWithMsg(err, errors.Common_RPCError, "fail to resolve rpc service "+service)
+	}
+	return url, nil
+}
+
+func (client *HttpClient) service(name string) (ServiceConfig, time.Duration, string) {
+	client.mu.RLock()
+	defer client.mu.RUnlock()
+
+	service := client.services[name]
+	timeout := client.timeout
+	if service.Timeout > 0 {
+		timeout = service.Timeout
+	}
+	return service, timeout, client.secret
+}
+
+// Call posts args to the service under the resilience policy of target "rpc.{service}",
+// business errors answered by the service are neither retried nor count as failures.
+// Only idempotent methods are retried, see SetIdempotent and WithRetry.
+func (client *HttpClient) Call(ctx context.Context, service string, method string, args interface{}, reply interface{}) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if !client.retryable(ctx, method) {
+		ctx = resilience.Once(ctx)
+	}
+	body, err := json.Marshal(args)
+	if err != nil {
+		return errors.Wrap(err, errors.Common_RPCError)
+	}
+
+	err = client.executor().Do(ctx, "rpc."+service, func(ctx context.Context) error {
+		return client.post(ctx, service, method, body, reply)
+	})
+	if _, ok := err.(errors.BizError); err != nil && !ok {
+		return errors.WrapWithMsg(err, errors.Common_RPCError, service+"."+method)
+	}
+	return err
+}
+
+func (client *HttpClient) post(ctx context.Context, service string, method string, body []byte, reply interface{}) error {
+	sc, timeout, secret := client.service(service)
+	base, err := client.url(ctx, service, sc)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	url := strings.TrimSuffix(base, "/") + "/" + service + "/" + method
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return resilience.Permanent(errors.Wrap(err, errors.Common_RPCError))
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	if uid := communal.UidFrom(ctx); uid > 0 {
+		req.Header.Set(HeaderUid, strconv.FormatInt(uid, 10))
+	}
+	if orgId := communal.OrgIdFrom(ctx); orgId > 0 {
+		req.Header.Set(HeaderOrgId, strconv.FormatInt(orgId, 10))
+	}
+	if secret != "" {
+		req.Header.Set(HeaderSignature, sign(secret, time.Now().Unix(), service, method,
+			req.Header.Get(HeaderUid), req.Header.Get(HeaderOrgId), body))
+	}
+	if requestId := communal.RequestIdFrom(ctx); requestId != "" {
+		req.Header.Set(log.RequestIdHeader, requestId)
+	}
+
+	resp, err := client.client.Do(req)
+	if err != nil {
+		log.Ctx(ctx).Error("fail to call rpc", zap.String("service", service), zap.String("method", method), zap.Error(err))
+		if ctx.Err() == context.DeadlineExceeded {
+			return errors.RPCFailedWithMsg("rpc call timeout: " + service + "." + method)
+		}
+		return errors.Wrap(err, errors.Common_RPCError)
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return errors.Wrap(err, errors.Common_RPCError)
+	}
+	if resp.StatusCode != http.StatusOK {
+		be := &errors.SimpleBizError{}
+		if json.Unmarshal(data, be) != nil || be.Code == "" {
+			return errors.RPCFailedWithMsg(resp.Status)
+		}
+		if be.Code == errors.Common_RPCError || be.Code == errors.Common_ServerError {
+			return be
+		}
+		return resilience.Permanent(be)
+	}
+
+	if reply != nil && len(data) > 0 {
+		if err = json.Unmarshal(data, reply); err != nil {
+			return resilience.Permanent(errors.Wrap(err, errors.Common_RPCError))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sdjnlh/communal"
+	"github.com/sdjnlh/communal/errors"
+	"github.com/sdjnlh/communal/log"
+	"github.com/sdjnlh/communal/resilience"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+type article struct {
+	Id    int64  `json:"id,string"`
+	Title string `json:"title"`
+}
+
+func TestHttpClient_Call(t *testing.T) {
+	log.Logger.Logger = zap.NewNop()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/rpc/article/Get":
+			var id int64
+			_ = json.NewDecoder(r.Body).Decode(&id)
+			_ = json.NewEncoder(w).Encode(&communal.Result{Ok: true, Data: &article{Id: id, Title: r.Header.Get(HeaderUid) + "/" + r.Header.Get(log.RequestIdHeader)}})
+		case "/rpc/article/Update":
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(errors.InvalidParams().AddError(errors.InvalidField("title", "empty", "")))
+		case "/rpc/article/Slow":
+			time.Sleep(200 * time.Millisecond)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client := NewHttpClient(Config{Services: map[string]ServiceConfig{
+		"article": {Url: server.URL + "/rpc/", Timeout: 50 * time.Millisecond},
+	}})
+	ctx := log.WithRequestId(communal.WithUser(context.Background(), 42, 1), "r1")
+
+	result := &communal.Result{Error: &errors.SimpleBizError{}, Data: &article{}}
+	assert.NoError(t, client.Call(ctx, "article", "Get", int64(7), result))
+	assert.True(t, result.Ok)
+	assert.Equal(t, &article{Id: 7, Title: "42/r1"}, result.Data)
+
+	err := client.Call(ctx, "article", "Update", &article{}, result)
+	be, ok := err.(errors.BizError)
+	assert.True(t, ok)
+	assert.Equal(t, errors.Common_InvalidParams, be.GetCode())
+	assert.Len(t, *be.GetErrors(), 1)
+
+	err = client.Call(ctx, "article", "Slow", nil, result)
+	assert.Equal(t, errors.Common_RPCError, err.(errors.BizError).GetCode())
+
+	err = client.Call(ctx, "article", "Missing", nil, result)
+	assert.Equal(t, errors.Common_RPCError, err.(errors.BizError).GetCode())
+
+	err = client.Call(ctx, "unknown", "Get", nil, result)
+	assert.Equal(t, errors.Common_RPCError, err.(errors.BizError).GetCode())
+
+	client = NewHttpClient(Config{}).SetResolver(func(ctx context.Context, service string) (string, error) {
+		return server.URL + "/rpc", nil
+	})
+	assert.NoError(t, client.Call(ctx, "article", "Get", int64(8), result))
+	assert.Equal(t, int64(8), result.Data.(*article).Id)
+}
+
+func TestHttpClient_Retry(t *testing.T) {
+	log.Logger.Logger = zap.NewNop()
+	calls := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls[r.URL.Path]++
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	client := NewHttpClient(Config{Services: map[string]ServiceConfig{"article": {Url: server.URL}}}).
+		SetExecutor(resilience.NewExecutor(resilience.Config{Default: resilience.Policy{Retry: resilience.Retry{Attempts: 3}}})).
+		SetIdempotent("Search")
+	ctx := context.Background()
+	for _, method := range []string{"Get", "Search", "Create", "Update"} {
+		assert.Error(t, client.Call(ctx, "article", method, nil, nil))
+	}
+	assert.Error(t, client.Call(WithRetry(ctx), "article", "Rename", nil, nil))
+
+	assert.Equal(t, map[string]int{"/article/Get": 3, "/article/Search": 3, "/article/Create": 1, "/article/Update": 1, "/article/Rename": 3}, calls)
+}
@@ -0,0 +1,302 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sdjnlh/communal"
+	"github.com/sdjnlh/communal/errors"
+	"github.com/sdjnlh/communal/log"
+	"github.com/sdjnlh/communal/resilience"
+	"go.uber.org/zap"
+)
+
+// Method is a published rpc method, Args creates the value the request is decoded into
+// and the reply of Call is encoded as the response.
+type Method struct {
+	Args func() interface{}
+	Call func(ctx context.Context, args interface{}) (interface{}, error)
+}
+
+// Server is the http handler counterpart of HttpClient, serving POST /{service}/{method}.
+// The users of calls, sent in the X-Uid and X-Org-Id headers, are trusted only from
+// clients sharing the secret of the server: once SetSecret is called, calls must carry
+// a valid X-Rpc-Signature, without a secret calls are served without users.
+type Server struct {
+	mu       sync.RWMutex
+	secret   string
+	maxBody  int64
+	services map[string]map[string]Method
+}
+
+// DefaultMaxBody is the size limit of call bodies, unless set by SetMaxBody
+const DefaultMaxBody = 4 << 20
+
+var DefaultServer = NewServer()
+
+func NewServer() *Server {
+	return &Server{maxBody: DefaultMaxBody, services: map[string]map[string]Method{}}
+}
+
+// SetSecret makes the server accept only calls signed with secret, by clients whose
+// Config has the same Secret
+func (server *Server) SetSecret(secret string) *Server {
+	server.mu.Lock()
+	server.secret = secret
+	server.mu.Unlock()
+	return server
+}
+
+func (server *Server) getSecret() string {
+	server.mu.RLock()
+	defer server.mu.RUnlock()
+	return server.secret
+}
+
+// SetMaxBody limits the bodies of calls to size bytes, larger calls are refused
+func (server *Server) SetMaxBody(size int64) *Server {
+	server.mu.Lock()
+	server.maxBody = size
+	server.mu.Unlock()
+	return server
+}
+
+func (server *Server) getMaxBody() int64 {
+	server.mu.RLock()
+	defer server.mu.RUnlock()
+	return server.maxBody
+}
+
+// Handle publishes method of service on the default server
+func Handle(service string, name string, method Method) {
+	DefaultServer.Handle(service, name, method)
+}
+
+func (server *Server) Handle(service string, name string, method Method) *Server {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	if server.services[service] == nil {
+		server.services[service] = map[string]Method{}
+	}
+	server.services[service][name] = method
+	return server
+}
+
+func (server *Server) method(service string, name string) (Method, bool) {
+	server.mu.RLock()
+	defer server.mu.RUnlock()
+	method, ok := server.services[service][name]
+	return method, ok
+}
+
+// Serve publishes Get, Create, List, Update, Patch, Delete, Stats and, when tracked, History
+// of a module whose Domain is set, methods already published are kept, so custom methods
+// can replace the defaults.
+func (server *Server) Serve(module *communal.Module) *Server {
+	if module.Domain == nil {
+		panic("domain needed to serve module " + module.Name)
+	}
+
+	for name, method := range moduleMethods(module) {
+		if _, ok := server.method(module.Name, name); !ok {
+			server.Handle(module.Name, name, method)
+		}
+	}
+	return server
+}
+
+// ServeHTTP serves rpc calls, and GET /health with the state of the outbound calls
+func (server *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet && r.URL.Path == "/health" {
+		resilience.HealthHandler(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, errors.RPCFailedWithMsg("rpc calls should be posted"))
+		return
+	}
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) < 2 {
+		writeError(w, http.StatusNotFound, errors.RPCFailedWithMsg("no rpc method: "+r.URL.Path))
+		return
+	}
+	service, name := parts[len(parts)-2], parts[len(parts)-1]
+	method, ok := server.method(service, name)
+	if !ok {
+		writeError(w, http.StatusNotFound, errors.RPCFailedWithMsg("no rpc method: "+service+"."+name))
+		return
+	}
+
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, server.getMaxBody()))
+	if err != nil {
+		status := http.StatusBadRequest
+		// the error of http.MaxBytesReader has no type before go 1.19
+		if err.Error() == "http: request body too large" {
+			status = http.StatusRequestEntityTooLarge
+		}
+		writeError(w, status, &errors.SimpleBizError{Code: errors.Common_InvalidParams, Msg: err.Error()})
+		return
+	}
+	ctx := r.Context()
+	if secret := server.getSecret(); secret != "" {
+		if !verify(secret, r.Header.Get(HeaderSignature), service, name, r.Header.Get(HeaderUid), r.Header.Get(HeaderOrgId), body, time.Now()) {
+			writeError(w, http.StatusUnauthorized, errors.Unauthorized())
+			return
+		}
+		uid, _ := strconv.ParseInt(r.Header.Get(HeaderUid), 10, 64)
+		orgId, _ := strconv.ParseInt(r.Header.Get(HeaderOrgId), 10, 64)
+		ctx = communal.WithUser(ctx, uid, orgId)
+	}
+
+	var args interface{}
+	if method.Args != nil {
+		args = method.Args()
+		if err := json.Unmarshal(body, args); err != nil {
+			writeError(w, http.StatusBadRequest, &errors.SimpleBizError{Code: errors.Common_InvalidParams, Msg: err.Error()})
+			return
+		}
+	}
+
+	if requestId := r.Header.Get(log.RequestIdHeader); requestId != "" {
+		ctx = log.WithRequestId(ctx, requestId)
+	}
+	reply, err := method.Call(ctx, args)
+	if err != nil {
+		var be errors.BizError
+		if errors.As(err, &be) && be.GetCode() != "" {
+			if errors.Unwrap(be) != nil {
+				// the cause stays in the logs of the service
+				log.Ctx(ctx).Error("fail to serve rpc", zap.String("service", service), zap.String("method", name),
+					zap.Error(err), zap.String("stack", errors.StackOf(err)))
+			}
+			writeError(w, errors.StatusOf(be), errors.Public(be))
+			return
+		}
+		log.Ctx(ctx).Error("fail to serve rpc", zap.String("service", service), zap.String("method", name), zap.Error(err))
+		writeError(w, http.StatusInternalServerError, errors.ServerError())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(reply)
+}
+
+func writeError(w http.ResponseWriter, status int, be errors.BizError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(be)
+}
+
+func moduleMethods(module *communal.Module) map[string]Method {
+	domain := module.Domain
+	newResult := func(data interface{}) *communal.Result {
+		return &communal.Result{Error: &errors.SimpleBizError{}, Data: data}
+	}
+	reply := func(result *communal.Result, err error) (interface{}, error) {
+		if err != nil {
+			return nil, err
+		}
+		if result.Ok {
+			result.Error = nil
+		}
+		return result, nil
+	}
+
+	methods := map[string]Method{
+		"Get": {
+			Args: func() interface{} { return new(int64) },
+			Call: func(ctx context.Context, args interface{}) (interface{}, error) {
+				result := newResult(domain.Domain(false))
+				return reply(result, module.Get(ctx, args, result))
+			},
+		},
+		"Create": {
+			Args: func() interface{} { return domain.Domain(false) },
+			Call: func(ctx context.Context, args interface{}) (interface{}, error) {
+				result := newResult(nil)
+				return reply(result, module.Create(ctx, args, result))
+			},
+		},
+		"List": {
+			Args: func() interface{} { return domain.Filter() },
+			Call: func(ctx context.Context, args interface{}) (interface{}, error) {
+				result := &communal.FilterResult{Result: *newResult(domain.Array())}
+				if err := module.List(ctx, args.(communal.Filter), result); err != nil {
+					return nil, err
+				}
+				result.Error = nil
+				return result, nil
+			},
+		},
+		"Update": {
+			Args: func() interface{} { return domain.Domain(false) },
+			Call: func(ctx context.Context, args interface{}) (interface{}, error) {
+				idm, ok := args.(communal.IdInf)
+				if !ok {
+					return nil, errors.RPCFailedWithMsg("domain of " + module.Name + " has no id")
+				}
+				result := newResult(nil)
+				return reply(result, module.Update(ctx, idm, result))
+			},
+		},
+		"Patch": {
+			Args: func() interface{} { return &PatchArgs{} },
+			Call: func(ctx context.Context, args interface{}) (interface{}, error) {
+				pa := args.(*PatchArgs)
+				if _, ok := domain.Domain(false).(communal.IdInf); !ok {
+					return nil, errors.RPCFailedWithMsg("domain of " + module.Name + " has no id")
+				}
+				dm, err := module.Patch(ctx, pa.Id, pa.Patch, func() (communal.IdInf, error) {
+					return domain.Domain(false).(communal.IdInf), nil
+				}, communal.PatchChecks{})
+				if err != nil {
+					return nil, err
+				}
+				return reply(newResult(nil).Success(dm), nil)
+			},
+		},
+		"Delete": {
+			Args: func() interface{} { return new(int64) },
+			Call: func(ctx context.Context, args interface{}) (interface{}, error) {
+				result := newResult(nil)
+				return reply(result, module.Dtd(ctx, *args.(*int64), result))
+			},
+		},
+		"Stats": {
+			Args: func() interface{} { return &StatsArgs{Filter: domain.Filter()} },
+			Call: func(ctx context.Context, args interface{}) (interface{}, error) {
+				sa := args.(*StatsArgs)
+				if sa.Query == nil {
+					return nil, errors.InvalidParams()
+				}
+				result := newResult(nil)
+				return reply(result, module.Aggregate(ctx, sa.Filter.(communal.Filter), sa.Query, result))
+			},
+		},
+		"History": {
+			Args: func() interface{} { return &HistoryArgs{Page: &communal.Page{}} },
+			Call: func(ctx context.Context, args interface{}) (interface{}, error) {
+				ha := args.(*HistoryArgs)
+				result := communal.NewFilterResult(nil)
+				if err := module.Histories(ctx, ha.Id, ha.Page, result); err != nil {
+					return nil, err
+				}
+				result.Error = nil
+				return result, nil
+			},
+		},
+	}
+	if module.HistoryTable == "" {
+		delete(methods, "History")
+	}
+	return methods
+}
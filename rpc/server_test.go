@@ -0,0 +1,150 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sdjnlh/communal"
+	"github.com/sdjnlh/communal/errors"
+	"github.com/sdjnlh/communal/internal/dbtest"
+	"github.com/sdjnlh/communal/log"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestServer(t *testing.T) {
+	log.Logger.Logger = zap.NewNop()
+	server := NewServer().Handle("article", "Rename", Method{
+		Args: func() interface{} { return &article{} },
+		Call: func(ctx context.Context, args interface{}) (interface{}, error) {
+			a := args.(*article)
+			if a.Title == "" {
+				return nil, errors.InvalidParams().AddError(errors.InvalidField("title", "empty", ""))
+			}
+			a.Title += " by " + strconv.FormatInt(communal.UidFrom(ctx), 10)
+			return &communal.Result{Ok: true, Data: a}, nil
+		},
+	})
+	server.SetSecret("secret")
+	hs := httptest.NewServer(server)
+	defer hs.Close()
+
+	client := NewHttpClient(Config{Secret: "secret", Services: map[string]ServiceConfig{"article": {Url: hs.URL}}})
+	ctx := communal.WithUser(context.Background(), 42, 1)
+
+	result := &communal.Result{Error: &errors.SimpleBizError{}, Data: &article{}}
+	assert.NoError(t, client.Call(ctx, "article", "Rename", &article{Id: 3, Title: "go"}, result))
+	assert.Equal(t, &article{Id: 3, Title: "go by 42"}, result.Data)
+
+	err := client.Call(ctx, "article", "Rename", &article{Id: 3}, result)
+	assert.Equal(t, errors.Common_InvalidParams, err.(errors.BizError).GetCode())
+	assert.Equal(t, "title", (*err.(errors.BizError).GetErrors())[0].(*errors.FieldError).Name)
+
+	err = client.Call(ctx, "article", "Get", int64(3), result)
+	assert.Equal(t, errors.Common_RPCError, err.(errors.BizError).GetCode())
+}
+
+func TestServer_Signature(t *testing.T) {
+	log.Logger.Logger = zap.NewNop()
+	server := NewServer().Handle("article", "Whoami", Method{
+		Call: func(ctx context.Context, args interface{}) (interface{}, error) {
+			return &communal.Result{Ok: true, Data: communal.UidFrom(ctx)}, nil
+		},
+	})
+	hs := httptest.NewServer(server)
+	defer hs.Close()
+	ctx := communal.WithUser(context.Background(), 42, 1)
+	services := map[string]ServiceConfig{"article": {Url: hs.URL}}
+
+	// without a secret users are not trusted
+	result := &communal.Result{}
+	assert.NoError(t, NewHttpClient(Config{Services: services}).Call(ctx, "article", "Whoami", nil, result))
+	assert.Equal(t, float64(0), result.Data)
+
+	server.SetSecret("secret")
+	err := NewHttpClient(Config{Services: services}).Call(ctx, "article", "Whoami", nil, result)
+	assert.Equal(t, errors.Common_Unauthorized, err.(errors.BizError).GetCode())
+	err = NewHttpClient(Config{Secret: "other", Services: services}).Call(ctx, "article", "Whoami", nil, result)
+	assert.Equal(t, errors.Common_Unauthorized, err.(errors.BizError).GetCode())
+
+	assert.NoError(t, NewHttpClient(Config{Secret: "secret", Services: services}).Call(ctx, "article", "Whoami", nil, result))
+	assert.Equal(t, float64(42), result.Data)
+}
+
+func TestServer_Limits(t *testing.T) {
+	log.Logger.Logger = zap.NewNop()
+	server := NewServer().Handle("article", "Check", Method{
+		Args: func() interface{} { return &article{} },
+		Call: func(ctx context.Context, args interface{}) (interface{}, error) {
+			return nil, fmt.Errorf("check article: %w", errors.NotFound())
+		},
+	}).SetMaxBody(32)
+	serve := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/article/Check", strings.NewReader(body)))
+		return w
+	}
+
+	w := serve(`{"id":"3"}`)
+	assert.Equal(t, http.StatusNotFound, w.Code, "wrapped biz errors keep their status")
+	assert.Contains(t, w.Body.String(), errors.Common_NotFound)
+
+	w = serve(`{"title":"` + strings.Repeat("a", 32) + `"}`)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+}
+
+func TestVerify(t *testing.T) {
+	now := time.Now()
+	signature := sign("secret", now.Unix(), "article", "Get", "42", "", []byte("3"))
+	assert.True(t, verify("secret", signature, "article", "Get", "42", "", []byte("3"), now))
+	assert.False(t, verify("secret", signature, "article", "Get", "43", "", []byte("3"), now))
+	assert.False(t, verify("secret", signature, "article", "Delete", "42", "", []byte("3"), now))
+	assert.False(t, verify("secret", signature, "article", "Get", "42", "", []byte("4"), now))
+	assert.False(t, verify("secret", signature, "article", "Get", "42", "", []byte("3"), now.Add(MaxSignatureAge+time.Second)))
+	assert.False(t, verify("secret", "", "article", "Get", "42", "", []byte("3"), now))
+}
+
+type patchedArticle struct {
+	communal.DBase `xorm:"extends"`
+	Title          string `json:"title" valid:"required"`
+	Body           string `json:"body"`
+}
+
+type articleDomain struct{}
+
+func (articleDomain) Name() string                 { return "article" }
+func (articleDomain) Domain(init bool) interface{} { return &patchedArticle{} }
+func (articleDomain) Filter() communal.Filter      { return nil }
+func (articleDomain) Array() interface{}           { return &[]*patchedArticle{} }
+
+func TestServer_Patch(t *testing.T) {
+	log.Logger.Logger = zap.NewNop()
+	engine, db := dbtest.Open()
+	db.Rows("FROM `article`", []string{"id", "title", "body"}, []interface{}{int64(3), "go", "text"})
+	module := communal.NewModule("article", "article", "/articles").SetDomain(articleDomain{})
+	module.SetDB(engine)
+	hs := httptest.NewServer(NewServer().Serve(module))
+	defer hs.Close()
+	client := NewHttpClient(Config{Services: map[string]ServiceConfig{"article": {Url: hs.URL}}})
+
+	result := &communal.Result{Error: &errors.SimpleBizError{}, Data: &patchedArticle{}}
+	assert.NoError(t, client.Call(context.Background(), "article", "Patch", &PatchArgs{Id: 3, Patch: []byte(`{"title":"rust"}`)}, result))
+	assert.True(t, result.Ok)
+	assert.Equal(t, "rust", result.Data.(*patchedArticle).Title)
+	assert.Equal(t, "text", result.Data.(*patchedArticle).Body)
+
+	updates := db.Find("UPDATE `article`")
+	assert.Len(t, updates, 1)
+	assert.Contains(t, updates[0].SQL, "`title` = ?")
+	assert.Contains(t, updates[0].SQL, "`lut` = ?")
+	assert.NotContains(t, updates[0].SQL, "`body`")
+
+	err := client.Call(context.Background(), "article", "Patch", &PatchArgs{Id: 3, Patch: []byte(`{"title":null}`)}, result)
+	assert.Equal(t, errors.Common_InvalidParams, err.(errors.BizError).GetCode())
+}
@@ -2,8 +2,42 @@ package rpc
 
 import (
 	"context"
+	"sync"
 )
 
-//var starter app.Starter
+var (
+	mu            sync.RWMutex
+	defaultClient Client = NewHttpClient(Config{})
+)
+
+// Client calls method of a remote service, args is encoded as the request and
+// the response is decoded into reply.
+type Client interface {
+	Call(ctx context.Context, service string, method string, args interface{}, reply interface{}) error
+}
+
+// SetClient replaces the client used by Call
+func SetClient(client Client) {
+	mu.Lock()
+	defaultClient = client
+	mu.Unlock()
+}
+
+func GetClient() Client {
+	mu.RLock()
+	defer mu.RUnlock()
+	return defaultClient
+}
+
+// Configure adds the services of config to the default http client, and its
+// timeout when set.
+func Configure(config Config) {
+	if client, ok := GetClient().(*HttpClient); ok {
+		client.Configure(config)
+	}
+}
 
-var Call func(ctx context.Context, servicePath string, serviceMethod string, args interface{}, reply interface{}) error
+// Call makes a call with the default client
+var Call = func(ctx context.Context, servicePath string, serviceMethod string, args interface{}, reply interface{}) error {
+	return GetClient().Call(ctx, servicePath, serviceMethod, args, reply)
+}
@@ -1,9 +1,12 @@
 package sender
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/sdjnlh/communal/log"
+	"github.com/sdjnlh/communal/resilience"
 	"go.uber.org/zap"
 	"io/ioutil"
 	"math/rand"
@@ -12,30 +15,60 @@ import (
 	"time"
 )
 
-var response map[string]interface{}
-
 const (
 	CpName     = "ll"
 	CpPassword = "2dc3c7d576d95f9"
 )
 
+const (
+	smsUrl = "http://qxt.fungo.cn/Recv_center"
+	// SmsTarget names the sms gateway for resilience policies
+	SmsTarget = "sender.sms"
+)
+
 func SendCode(mobile string) (string, bool) {
+	return SendCodeContext(context.Background(), mobile)
+}
+
+// SendCodeContext sends a verification code to mobile with the deadline of ctx. The
+// gateway is called once, a retried call could send a second sms.
+func SendCodeContext(ctx context.Context, mobile string) (string, bool) {
 	rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
 	code := fmt.Sprintf("%06v", rnd.Int31n(1000000))
-	resp, err := http.Post("http://qxt.fungo.cn/Recv_center",
-		"application/x-www-form-urlencoded",
-		strings.NewReader("CpName="+CpName+"&CpPassword="+CpPassword+"&DesMobile="+mobile+"&Content=【龙灵科技】您的验证码是"+code+",请在十分钟内完成&ExtCode=1234"))
+	form := "CpName=" + CpName + "&CpPassword=" + CpPassword + "&DesMobile=" + mobile + "&Content=【龙灵科技】您的验证码是" + code + ",请在十分钟内完成&ExtCode=1234"
+
+	var respCode interface{}
+	err := resilience.Default().Do(resilience.Once(ctx), SmsTarget, func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, smsUrl, strings.NewReader(form))
+		if err != nil {
+			return resilience.Permanent(err)
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode >= http.StatusInternalServerError {
+			return errors.New("sms gateway answered " + resp.Status)
+		}
+
+		var response map[string]interface{}
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		_ = json.Unmarshal(body, &response)
+		respCode = response["code"]
+		return nil
+	})
 	if err != nil {
-		log.Logger.Error("fail send mobile code{}", zap.Any(mobile, err))
+		log.Ctx(ctx).Error("fail send mobile code{}", zap.Any(mobile, err))
 		return code, false
 	}
 
-	defer resp.Body.Close()
-	body, err := ioutil.ReadAll(resp.Body)
-	json.Unmarshal(body, &response)
-	respCode, _ := response["code"]
-	if "0" != respCode.(string) {
-		log.Logger.Error("send rest error{}", zap.Any("error code", respCode))
+	if "0" != respCode {
+		log.Ctx(ctx).Error("send rest error{}", zap.Any("error code", respCode))
 		return code, false
 	}
 	return code, true
@@ -0,0 +1,254 @@
+package sheet
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sdjnlh/communal/errors"
+	"github.com/sdjnlh/communal/util"
+)
+
+const TimeLayout = "2006-01-02 15:04:05"
+
+var (
+	timeType    = reflect.TypeOf(time.Time{})
+	timeLayouts = []string{TimeLayout, time.RFC3339, "2006-01-02", "2006/01/02 15:04:05", "2006/01/02"}
+	// day zero of spreadsheet serial dates
+	excelEpoch = time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+)
+
+// Column maps a struct field to a spreadsheet column. The header comes from the
+// sheet tag, e.g. `sheet:"Title"`, or the json key of the field; `sheet:"-"`
+// excludes the field.
+type Column struct {
+	Header string
+	Field  util.StructField
+}
+
+type Mapping struct {
+	Columns []Column
+}
+
+func NewMapping(domain interface{}) *Mapping {
+	mapping := &Mapping{}
+	for _, field := range util.StructFields(reflect.TypeOf(domain), nil) {
+		header := field.Tag.Get("sheet")
+		if header == "-" || (header == "" && field.Json == "") {
+			continue
+		}
+		if header == "" {
+			header = field.Json
+		}
+		mapping.Columns = append(mapping.Columns, Column{Header: header, Field: field})
+	}
+	return mapping
+}
+
+func (mapping *Mapping) Header() []string {
+	header := make([]string, len(mapping.Columns))
+	for i, col := range mapping.Columns {
+		header[i] = col.Header
+	}
+	return header
+}
+
+// Record formats the mapped fields of a domain
+func (mapping *Mapping) Record(domain interface{}) []string {
+	v := reflect.Indirect(reflect.ValueOf(domain))
+	record := make([]string, len(mapping.Columns))
+	for i, col := range mapping.Columns {
+		record[i] = formatValue(v.FieldByIndex(col.Field.Index))
+	}
+	return record
+}
+
+// Binder decodes records whose columns are given by a header row
+type Binder struct {
+	columns []*Column
+}
+
+// Bind matches a header row to the mapped columns by header or json key, unknown
+// headers are ignored.
+func (mapping *Mapping) Bind(header []string) *Binder {
+	binder := &Binder{columns: make([]*Column, len(header))}
+	for i, name := range header {
+		name = strings.TrimSpace(name)
+		for j := range mapping.Columns {
+			col := &mapping.Columns[j]
+			if col.Header == name || col.Field.Json == name {
+				binder.columns[i] = col
+				break
+			}
+		}
+	}
+	return binder
+}
+
+// Ignore unbinds the columns of headers or json keys, their values are not decoded
+func (binder *Binder) Ignore(names ...string) *Binder {
+	for i, col := range binder.columns {
+		for _, name := range names {
+			if col != nil && (col.Header == name || col.Field.Json == name) {
+				binder.columns[i] = nil
+			}
+		}
+	}
+	return binder
+}
+
+// Decode sets the fields of domain from a record, conversion failures are
+// collected as field errors.
+func (binder *Binder) Decode(record []string, domain interface{}) error {
+	v := reflect.Indirect(reflect.ValueOf(domain))
+	verr := errors.InvalidParams()
+	for i, value := range record {
+		if i >= len(binder.columns) || binder.columns[i] == nil {
+			continue
+		}
+		col := binder.columns[i]
+		if err := parseValue(v.FieldByIndex(col.Field.Index), strings.TrimSpace(value)); err != nil {
+			verr.AddError(errors.InvalidField(col.Field.Json, errors.FIELD_BAD_FORMAT, col.Header+": "+err.Error()))
+		}
+	}
+	if verr.HasError() {
+		return verr
+	}
+	return nil
+}
+
+func formatValue(v reflect.Value) string {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return ""
+		}
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		return v.String()
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10)
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'f', -1, 64)
+	}
+
+	if v.Type().ConvertibleTo(timeType) {
+		t := v.Convert(timeType).Interface().(time.Time)
+		if t.IsZero() {
+			return ""
+		}
+		return t.Format(TimeLayout)
+	}
+
+	var value interface{} = v.Interface()
+	if v.CanAddr() {
+		value = v.Addr().Interface()
+	}
+	bts, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(v.Interface())
+	}
+	if str, err := strconv.Unquote(string(bts)); err == nil {
+		return str
+	}
+	return string(bts)
+}
+
+func parseValue(v reflect.Value, str string) error {
+	if str == "" {
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+	if v.Kind() == reflect.Ptr {
+		v.Set(reflect.New(v.Type().Elem()))
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(str)
+		return nil
+	case reflect.Bool:
+		b, err := strconv.ParseBool(str)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := parseInt(str)
+		if err != nil {
+			return err
+		}
+		if v.OverflowInt(i) {
+			return fmt.Errorf("value %s out of range", str)
+		}
+		v.SetInt(i)
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		i, err := parseInt(str)
+		if err != nil || i < 0 || v.OverflowUint(uint64(i)) {
+			return fmt.Errorf("invalid unsigned value %s", str)
+		}
+		v.SetUint(uint64(i))
+		return nil
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(str, 64)
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+		return nil
+	}
+
+	if v.Type().ConvertibleTo(timeType) {
+		t, err := parseTime(str)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(t).Convert(v.Type()))
+		return nil
+	}
+
+	target := v.Addr().Interface()
+	if err := json.Unmarshal([]byte(str), target); err != nil {
+		return json.Unmarshal([]byte(strconv.Quote(str)), target)
+	}
+	return nil
+}
+
+// parseInt accepts numbers written by spreadsheets as floats, e.g. 1.2E+3
+func parseInt(str string) (int64, error) {
+	i, err := strconv.ParseInt(str, 10, 64)
+	if err == nil {
+		return i, nil
+	}
+	f, ferr := strconv.ParseFloat(str, 64)
+	if ferr != nil || f != math.Trunc(f) {
+		return 0, err
+	}
+	return int64(f), nil
+}
+
+func parseTime(str string) (time.Time, error) {
+	for _, layout := range timeLayouts {
+		if t, err := time.ParseInLocation(layout, str, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	if days, err := strconv.ParseFloat(str, 64); err == nil {
+		t := excelEpoch.Add(time.Duration(days * float64(24*time.Hour)))
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.Local), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %s", str)
+}
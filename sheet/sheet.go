@@ -0,0 +1,121 @@
+package sheet
+
+import (
+	"encoding/csv"
+	"io"
+	"strings"
+
+	"github.com/sdjnlh/communal/errors"
+)
+
+const (
+	FormatCSV  = "csv"
+	FormatXLSX = "xlsx"
+)
+
+// Writer writes spreadsheet rows one by one, nothing is buffered beyond the
+// underlying encoder, Close must be called to complete the document.
+type Writer interface {
+	Write(record []string) error
+	Flush() error
+	Close() error
+}
+
+// Reader reads spreadsheet rows one by one and returns io.EOF after the last row.
+type Reader interface {
+	Read() ([]string, error)
+}
+
+// Format normalizes a format name or file name, an empty string is returned for
+// unsupported formats.
+func Format(name string) string {
+	name = strings.ToLower(name)
+	if idx := strings.LastIndex(name, "."); idx >= 0 {
+		name = name[idx+1:]
+	}
+	if name == FormatCSV || name == FormatXLSX {
+		return name
+	}
+	return ""
+}
+
+func ContentType(format string) string {
+	if format == FormatXLSX {
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	}
+	return "text/csv; charset=utf-8"
+}
+
+func NewWriter(format string, w io.Writer) (Writer, error) {
+	if format == FormatXLSX {
+		return NewXLSXWriter(w)
+	}
+	return NewCSVWriter(w), nil
+}
+
+func NewReader(format string, r io.ReaderAt, size int64) (Reader, error) {
+	if format == FormatXLSX {
+		return NewXLSXReader(r, size)
+	}
+	return NewCSVReader(io.NewSectionReader(r, 0, size)), nil
+}
+
+type csvWriter struct {
+	w *csv.Writer
+}
+
+// NewCSVWriter writes csv with an UTF-8 BOM, so that spreadsheet software detects the encoding
+func NewCSVWriter(w io.Writer) Writer {
+	_, _ = w.Write([]byte("\xEF\xBB\xBF"))
+	return &csvWriter{w: csv.NewWriter(w)}
+}
+
+func (cw *csvWriter) Write(record []string) error {
+	return cw.w.Write(record)
+}
+
+func (cw *csvWriter) Flush() error {
+	cw.w.Flush()
+	return cw.w.Error()
+}
+
+func (cw *csvWriter) Close() error {
+	return cw.Flush()
+}
+
+type csvReader struct {
+	r     *csv.Reader
+	first bool
+}
+
+func NewCSVReader(r io.Reader) Reader {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	return &csvReader{r: cr, first: true}
+}
+
+func (cr *csvReader) Read() ([]string, error) {
+	record, err := cr.r.Read()
+	if err == nil && cr.first && len(record) > 0 {
+		record[0] = strings.TrimPrefix(record[0], "\xEF\xBB\xBF")
+	}
+	cr.first = false
+	return record, err
+}
+
+// Report summarizes an import, Row numbers count the header row as row 1
+type Report struct {
+	Total    int        `json:"total"`
+	Imported int        `json:"imported"`
+	Errors   []RowError `json:"errors,omitempty"`
+}
+
+type RowError struct {
+	Row   int             `json:"row"`
+	Error errors.BizError `json:"err"`
+}
+
+// Fail reports the error of row, as errors.Public answers it to clients
+func (report *Report) Fail(row int, err errors.BizError) {
+	report.Errors = append(report.Errors, RowError{Row: row, Error: errors.Public(err)})
+}
@@ -0,0 +1,94 @@
+package sheet
+
+import (
+	"bytes"
+	"encoding/json"
+	stderrors "errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/sdjnlh/communal"
+	"github.com/sdjnlh/communal/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+type article struct {
+	communal.Base `xorm:"extends"`
+	Title         string  `json:"title" sheet:"Title"`
+	Price         float64 `json:"price"`
+	Hidden        bool    `json:"hidden" sheet:"-"`
+	Secret        string  `json:"-"`
+}
+
+func roundTrip(t *testing.T, format string) {
+	crt := time.Date(2020, 3, 7, 8, 30, 0, 0, time.Local)
+	in := &article{Title: `a "quoted", <tagged> & title`, Price: 12.5}
+	in.Id = 42
+	in.Crt = crt
+	in.Status = 1
+
+	buf := &bytes.Buffer{}
+	mapping := NewMapping(in)
+	w, err := NewWriter(format, buf)
+	assert.Nil(t, err)
+	assert.Nil(t, w.Write(mapping.Header()))
+	assert.Nil(t, w.Write(mapping.Record(in)))
+	assert.Nil(t, w.Close())
+
+	r, err := NewReader(format, bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	assert.Nil(t, err)
+	header, err := r.Read()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"id", "crt", "lut", "status", "Title", "price"}, header)
+
+	record, err := r.Read()
+	assert.Nil(t, err)
+	out := &article{}
+	assert.Nil(t, mapping.Bind(header).Decode(record, out))
+	assert.Equal(t, in.Id, out.Id)
+	assert.Equal(t, in.Title, out.Title)
+	assert.Equal(t, in.Price, out.Price)
+	assert.True(t, crt.Equal(out.Crt))
+	assert.True(t, out.Lut.IsZero())
+
+	_, err = r.Read()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestCSVRoundTrip(t *testing.T) {
+	roundTrip(t, FormatCSV)
+}
+
+func TestXLSXRoundTrip(t *testing.T) {
+	roundTrip(t, FormatXLSX)
+}
+
+func TestDecodeErrors(t *testing.T) {
+	binder := NewMapping(&article{}).Bind([]string{"price", "status", "unknown"})
+	err := binder.Decode([]string{"cheap", "1.2E+1", "x"}, &article{})
+	assert.NotNil(t, err)
+
+	out := &article{}
+	assert.Nil(t, binder.Decode([]string{"3", "1.2E+1", "x"}, out))
+	assert.Equal(t, int16(12), out.Status)
+}
+
+func TestColumnName(t *testing.T) {
+	for i, name := range map[int]string{0: "A", 25: "Z", 26: "AA", 701: "ZZ", 702: "AAA"} {
+		assert.Equal(t, name, columnName(i))
+		assert.Equal(t, i, columnIndex(name+"12"))
+	}
+}
+
+func TestReport_Fail(t *testing.T) {
+	report := &Report{}
+	report.Fail(2, errors.Wrap(stderrors.New("pq: relation secret_table"), errors.Common_ServerError))
+	report.Fail(3, errors.InvalidParams().AddError(errors.InvalidField("price", errors.FIELD_BAD_FORMAT, "cheap")))
+
+	bts, err := json.Marshal(report)
+	assert.Nil(t, err)
+	assert.NotContains(t, string(bts), "secret_table")
+	assert.Equal(t, errors.Common_ServerError, report.Errors[0].Error.GetCode())
+	assert.Len(t, *report.Errors[1].Error.GetErrors(), 1, "field errors are public")
+}
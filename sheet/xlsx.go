@@ -0,0 +1,308 @@
+package sheet
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"errors"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+const (
+	xlsxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/><Default Extension="xml" ContentType="application/xml"/><Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/><Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/></Types>`
+	xlsxRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/></Relationships>`
+	xlsxWorkbook = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="Sheet1" sheetId="1" r:id="rId1"/></sheets></workbook>`
+	xlsxWorkbookRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/></Relationships>`
+	xlsxSheetHead = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`
+	xlsxSheetTail = `</sheetData></worksheet>`
+)
+
+type xlsxWriter struct {
+	zw    *zip.Writer
+	sheet *bufio.Writer
+	rows  int
+}
+
+// NewXLSXWriter writes a single sheet workbook, cells are written as inline strings
+// so that rows can be streamed without a shared string table.
+func NewXLSXWriter(w io.Writer) (Writer, error) {
+	zw := zip.NewWriter(w)
+	parts := [][2]string{
+		{"[Content_Types].xml", xlsxContentTypes},
+		{"_rels/.rels", xlsxRels},
+		{"xl/workbook.xml", xlsxWorkbook},
+		{"xl/_rels/workbook.xml.rels", xlsxWorkbookRels},
+	}
+	for _, part := range parts {
+		pw, err := zw.Create(part[0])
+		if err != nil {
+			return nil, err
+		}
+		if _, err = io.WriteString(pw, part[1]); err != nil {
+			return nil, err
+		}
+	}
+
+	sw, err := zw.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+	xw := &xlsxWriter{zw: zw, sheet: bufio.NewWriter(sw)}
+	_, err = xw.sheet.WriteString(xlsxSheetHead)
+	return xw, err
+}
+
+func (xw *xlsxWriter) Write(record []string) error {
+	xw.rows++
+	row := strconv.Itoa(xw.rows)
+	xw.sheet.WriteString(`<row r="` + row + `">`)
+	for i, value := range record {
+		xw.sheet.WriteString(`<c r="` + columnName(i) + row + `" t="inlineStr"><is><t xml:space="preserve">`)
+		if err := xml.EscapeText(xw.sheet, []byte(value)); err != nil {
+			return err
+		}
+		xw.sheet.WriteString(`</t></is></c>`)
+	}
+	_, err := xw.sheet.WriteString(`</row>`)
+	return err
+}
+
+func (xw *xlsxWriter) Flush() error {
+	if err := xw.sheet.Flush(); err != nil {
+		return err
+	}
+	return xw.zw.Flush()
+}
+
+func (xw *xlsxWriter) Close() error {
+	if _, err := xw.sheet.WriteString(xlsxSheetTail); err != nil {
+		return err
+	}
+	if err := xw.sheet.Flush(); err != nil {
+		return err
+	}
+	return xw.zw.Close()
+}
+
+// columnName converts a zero based column index to A, B, ..., AA
+func columnName(index int) string {
+	name := ""
+	for index >= 0 {
+		name = string(rune('A'+index%26)) + name
+		index = index/26 - 1
+	}
+	return name
+}
+
+// columnIndex converts a cell reference like AB12 to a zero based column index
+func columnIndex(ref string) int {
+	index := 0
+	for _, r := range ref {
+		if r < 'A' || r > 'Z' {
+			break
+		}
+		index = index*26 + int(r-'A') + 1
+	}
+	return index - 1
+}
+
+type xlsxReader struct {
+	rc      io.ReadCloser
+	decoder *xml.Decoder
+	shared  []string
+}
+
+// NewXLSXReader reads the rows of the first sheet of a workbook
+func NewXLSXReader(r io.ReaderAt, size int64) (Reader, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+	files := map[string]*zip.File{}
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	xr := &xlsxReader{}
+	if f := files["xl/sharedStrings.xml"]; f != nil {
+		if xr.shared, err = readSharedStrings(f); err != nil {
+			return nil, err
+		}
+	}
+
+	name, err := firstSheet(files)
+	if err != nil {
+		return nil, err
+	}
+	if xr.rc, err = files[name].Open(); err != nil {
+		return nil, err
+	}
+	xr.decoder = xml.NewDecoder(xr.rc)
+	return xr, nil
+}
+
+func (xr *xlsxReader) Read() ([]string, error) {
+	for {
+		token, err := xr.decoder.Token()
+		if err == io.EOF {
+			xr.rc.Close()
+		}
+		if err != nil {
+			return nil, err
+		}
+		if se, ok := token.(xml.StartElement); ok && se.Name.Local == "row" {
+			return xr.readRow()
+		}
+	}
+}
+
+func (xr *xlsxReader) readRow() ([]string, error) {
+	var record []string
+	for {
+		token, err := xr.decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		switch tk := token.(type) {
+		case xml.StartElement:
+			if tk.Name.Local != "c" {
+				continue
+			}
+			var cell xlsxCell
+			if err = xr.decoder.DecodeElement(&cell, &tk); err != nil {
+				return nil, err
+			}
+			index := len(record)
+			if cell.Ref != "" {
+				index = columnIndex(cell.Ref)
+			}
+			for len(record) <= index {
+				record = append(record, "")
+			}
+			record[index] = xr.cellValue(&cell)
+		case xml.EndElement:
+			if tk.Name.Local == "row" {
+				return record, nil
+			}
+		}
+	}
+}
+
+func (xr *xlsxReader) cellValue(cell *xlsxCell) string {
+	switch cell.Type {
+	case "s":
+		if i, err := strconv.Atoi(cell.Value); err == nil && i >= 0 && i < len(xr.shared) {
+			return xr.shared[i]
+		}
+		return ""
+	case "inlineStr":
+		return cell.Inline.text()
+	case "b":
+		if cell.Value == "1" {
+			return "true"
+		}
+		return "false"
+	}
+	return cell.Value
+}
+
+type xlsxCell struct {
+	Ref    string      `xml:"r,attr"`
+	Type   string      `xml:"t,attr"`
+	Value  string      `xml:"v"`
+	Inline xlsxRichStr `xml:"is"`
+}
+
+type xlsxRichStr struct {
+	T    string `xml:"t"`
+	Runs []struct {
+		T string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (rs *xlsxRichStr) text() string {
+	if len(rs.Runs) == 0 {
+		return rs.T
+	}
+	var sb strings.Builder
+	for _, run := range rs.Runs {
+		sb.WriteString(run.T)
+	}
+	return sb.String()
+}
+
+func readSharedStrings(f *zip.File) ([]string, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	var sst struct {
+		Items []xlsxRichStr `xml:"si"`
+	}
+	if err = xml.NewDecoder(rc).Decode(&sst); err != nil {
+		return nil, err
+	}
+	shared := make([]string, len(sst.Items))
+	for i := range sst.Items {
+		shared[i] = sst.Items[i].text()
+	}
+	return shared, nil
+}
+
+// firstSheet resolves the part name of the first sheet through the workbook relationships
+func firstSheet(files map[string]*zip.File) (string, error) {
+	const fallback = "xl/worksheets/sheet1.xml"
+
+	var workbook struct {
+		Sheets []struct {
+			Id string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	var rels struct {
+		Items []struct {
+			Id     string `xml:"Id,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}
+	if decodePart(files["xl/workbook.xml"], &workbook) == nil && decodePart(files["xl/_rels/workbook.xml.rels"], &rels) == nil && len(workbook.Sheets) > 0 {
+		for _, rel := range rels.Items {
+			if rel.Id != workbook.Sheets[0].Id {
+				continue
+			}
+			name := path.Join("xl", rel.Target)
+			if strings.HasPrefix(rel.Target, "/") {
+				name = strings.TrimPrefix(rel.Target, "/")
+			}
+			if files[name] != nil {
+				return name, nil
+			}
+		}
+	}
+
+	if files[fallback] == nil {
+		return "", errors.New("no worksheet found in workbook")
+	}
+	return fallback, nil
+}
+
+func decodePart(f *zip.File, target interface{}) error {
+	if f == nil {
+		return errors.New("part not found")
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return xml.NewDecoder(rc).Decode(target)
+}
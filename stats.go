@@ -0,0 +1,242 @@
+package communal
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/sdjnlh/communal/db"
+	"github.com/sdjnlh/communal/errors"
+	"github.com/sdjnlh/communal/log"
+	"go.uber.org/zap"
+	"xorm.io/xorm/schemas"
+)
+
+const (
+	BucketDay   = "day"
+	BucketWeek  = "week"
+	BucketMonth = "month"
+
+	// BucketColumn is the time column buckets are computed on
+	BucketColumn = "crt"
+)
+
+var aggregateFuncs = map[string]bool{"count": true, "sum": true, "avg": true, "min": true, "max": true}
+
+// Aggregate is one aggregate function over a column, Column is optional for count
+type Aggregate struct {
+	Func   string `json:"func"`
+	Column string `json:"column,omitempty"`
+	As     string `json:"as,omitempty"`
+}
+
+func (agg *Aggregate) alias() string {
+	if agg.As != "" {
+		return agg.As
+	}
+	if agg.Column == "" {
+		return agg.Func
+	}
+	return agg.Func + "_" + agg.Column
+}
+
+type StatsQuery struct {
+	Aggregates []Aggregate `json:"aggregates"`
+	GroupBy    []string    `json:"groupBy,omitempty"`
+	// Bucket groups rows by day, week or month of the crt column
+	Bucket string `json:"bucket,omitempty"`
+}
+
+type StatsRow struct {
+	Bucket interface{}            `json:"bucket,omitempty"`
+	Groups map[string]interface{} `json:"groups,omitempty"`
+	Values map[string]interface{} `json:"values"`
+}
+
+type Stats struct {
+	Rows []StatsRow `json:"rows"`
+}
+
+// ParseAggregates parses comma separated aggregates of format func[:column], e.g. count,sum:amount
+func ParseAggregates(str string) []Aggregate {
+	var aggs []Aggregate
+	for _, item := range strings.Split(str, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		pair := strings.SplitN(item, ":", 2)
+		agg := Aggregate{Func: strings.ToLower(pair[0])}
+		if len(pair) > 1 {
+			agg.Column = pair[1]
+		}
+		aggs = append(aggs, agg)
+	}
+	return aggs
+}
+
+// AllowStats whitelists the columns which can be aggregated or grouped by
+func (module *Module) AllowStats(columns ...string) *Module {
+	module.StatColumns = append(module.StatColumns, columns...)
+	return module
+}
+
+func (module *Module) statAllowed(column string) bool {
+	for _, col := range module.StatColumns {
+		if col == column {
+			return true
+		}
+	}
+	return false
+}
+
+// Aggregate computes the statistics of query over the rows matched by filter,
+// result data is set to *Stats. Like SqlSession, soft deleted rows are skipped.
+func (module *Module) Aggregate(ctx context.Context, filter Filter, query *StatsQuery, result *Result) (err error) {
+	if err = module.validateStats(query); err != nil {
+		result.Failure(err.(errors.BizError))
+		return err
+	}
+
+	selects, groups, err := buildStatsSql(module.Db.Dialect().URI().DBType, module.Db.Quote, query)
+	if err != nil {
+		result.Failure(err.(errors.BizError))
+		return err
+	}
+
+	// the filter session is used only to collect conditions, paging is ignored
+	cs := module.Db.NewSession()
+	defer cs.Close()
+	if filter != nil {
+		filter.Apply(cs)
+	}
+
+	ss := module.Db.Table(module.TableName).Where(db.UndeletedCause).And(cs.Conds()).Select(strings.Join(selects, ", "))
+	if len(groups) > 0 {
+		ss.GroupBy(strings.Join(groups, ", ")).OrderBy(strings.Join(groups, ", "))
+	}
+	rows, err := ss.QueryInterface()
+	if err != nil {
+		log.Ctx(ctx).Error("fail to aggregate", zap.String("module", module.Name), zap.Error(err))
+		return err
+	}
+
+	stats := &Stats{Rows: make([]StatsRow, 0, len(rows))}
+	for _, row := range rows {
+		sr := StatsRow{Values: map[string]interface{}{}}
+		if query.Bucket != "" {
+			sr.Bucket = statValue(row["bucket"])
+		}
+		if len(query.GroupBy) > 0 {
+			sr.Groups = map[string]interface{}{}
+			for _, col := range query.GroupBy {
+				sr.Groups[col] = statValue(row[col])
+			}
+		}
+		for _, agg := range query.Aggregates {
+			sr.Values[agg.alias()] = statValue(row[agg.alias()])
+		}
+		stats.Rows = append(stats.Rows, sr)
+	}
+
+	result.Success(stats)
+	return nil
+}
+
+func (module *Module) validateStats(query *StatsQuery) error {
+	verr := errors.InvalidParams()
+	if query == nil || len(query.Aggregates) == 0 {
+		return verr.AddError(errors.InvalidField("agg", "empty", "no aggregate given"))
+	}
+
+	for _, agg := range query.Aggregates {
+		if !aggregateFuncs[agg.Func] {
+			verr.AddError(errors.InvalidField("agg", "unsupported", "unsupported aggregate "+agg.Func))
+		} else if agg.Column == "" && agg.Func != "count" {
+			verr.AddError(errors.InvalidField("agg", "empty", "column needed for aggregate "+agg.Func))
+		} else if agg.Column != "" && !module.statAllowed(agg.Column) {
+			verr.AddError(errors.InvalidField("agg", "forbidden", "column not allowed "+agg.Column))
+		}
+	}
+	for _, col := range query.GroupBy {
+		if !module.statAllowed(col) {
+			verr.AddError(errors.InvalidField("group", "forbidden", "column not allowed "+col))
+		}
+	}
+	if query.Bucket != "" && query.Bucket != BucketDay && query.Bucket != BucketWeek && query.Bucket != BucketMonth {
+		verr.AddError(errors.InvalidField("bucket", "unsupported", "bucket should be day, week or month"))
+	}
+
+	if verr.HasError() {
+		return verr
+	}
+	return nil
+}
+
+// buildStatsSql returns the select and group by expressions of a validated query
+func buildStatsSql(dbType schemas.DBType, quote func(string) string, query *StatsQuery) (selects []string, groups []string, err error) {
+	if query.Bucket != "" {
+		bucket, err := bucketExpr(dbType, quote(BucketColumn), query.Bucket)
+		if err != nil {
+			return nil, nil, err
+		}
+		selects = append(selects, bucket+" AS bucket")
+		groups = append(groups, bucket)
+	}
+
+	for _, col := range query.GroupBy {
+		selects = append(selects, quote(col))
+		groups = append(groups, quote(col))
+	}
+
+	for _, agg := range query.Aggregates {
+		target := "*"
+		if agg.Column != "" {
+			target = quote(agg.Column)
+		}
+		selects = append(selects, agg.Func+"("+target+") AS "+quote(agg.alias()))
+	}
+	return
+}
+
+func bucketExpr(dbType schemas.DBType, column string, bucket string) (string, error) {
+	switch dbType {
+	case schemas.POSTGRES:
+		return "date_trunc('" + bucket + "', " + column + ")", nil
+	case schemas.MYSQL:
+		switch bucket {
+		case BucketDay:
+			return "DATE(" + column + ")", nil
+		case BucketWeek:
+			return "DATE(DATE_SUB(" + column + ", INTERVAL WEEKDAY(" + column + ") DAY))", nil
+		default:
+			return "DATE_FORMAT(" + column + ", '%Y-%m-01')", nil
+		}
+	case schemas.SQLITE:
+		switch bucket {
+		case BucketDay:
+			return "date(" + column + ")", nil
+		case BucketWeek:
+			return "date(" + column + ", 'weekday 0', '-6 days')", nil
+		default:
+			return "strftime('%Y-%m-01', " + column + ")", nil
+		}
+	}
+	return "", errors.InvalidParams().AddError(errors.InvalidField("bucket", "unsupported", "time bucket not supported by "+string(dbType)))
+}
+
+// statValue converts raw driver values, numbers read as bytes are parsed
+func statValue(value interface{}) interface{} {
+	bts, ok := value.([]byte)
+	if !ok {
+		return value
+	}
+
+	str := string(bts)
+	if i, err := strconv.ParseInt(str, 10, 64); err == nil {
+		return i
+	}
+	if f, err := strconv.ParseFloat(str, 64); err == nil {
+		return f
+	}
+	return str
+}
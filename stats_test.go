@@ -0,0 +1,68 @@
+package communal
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sdjnlh/communal/internal/dbtest"
+	"github.com/stretchr/testify/assert"
+	"xorm.io/xorm"
+	"xorm.io/xorm/schemas"
+)
+
+func TestBuildStatsSql(t *testing.T) {
+	quote := func(s string) string { return `"` + s + `"` }
+	query := &StatsQuery{
+		Aggregates: ParseAggregates("count, sum:amount"),
+		GroupBy:    []string{"status"},
+		Bucket:     BucketMonth,
+	}
+
+	selects, groups, err := buildStatsSql(schemas.POSTGRES, quote, query)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{`date_trunc('month', "crt") AS bucket`, `"status"`, `count(*) AS "count"`, `sum("amount") AS "sum_amount"`}, selects)
+	assert.Equal(t, []string{`date_trunc('month', "crt")`, `"status"`}, groups)
+
+	_, _, err = buildStatsSql(schemas.MSSQL, quote, query)
+	assert.NotNil(t, err)
+}
+
+func TestModule_ValidateStats(t *testing.T) {
+	module := NewModule("order", "order", "/orders").AllowStats("status", "amount")
+
+	assert.Nil(t, module.validateStats(&StatsQuery{Aggregates: ParseAggregates("count,avg:amount"), GroupBy: []string{"status"}}))
+	assert.NotNil(t, module.validateStats(&StatsQuery{}))
+	assert.NotNil(t, module.validateStats(&StatsQuery{Aggregates: ParseAggregates("sum")}))
+	assert.NotNil(t, module.validateStats(&StatsQuery{Aggregates: ParseAggregates("sum:password")}))
+	assert.NotNil(t, module.validateStats(&StatsQuery{Aggregates: ParseAggregates("count"), GroupBy: []string{"uid"}}))
+	assert.NotNil(t, module.validateStats(&StatsQuery{Aggregates: ParseAggregates("count"), Bucket: "hour"}))
+}
+
+type statusFilter struct {
+	Page
+	Status int16
+}
+
+func (filter *statusFilter) Apply(session *xorm.Session) {
+	session.Where("status = ?", filter.Status)
+}
+
+func (filter *statusFilter) GetPage() *Page {
+	return &filter.Page
+}
+
+func TestModule_Aggregate(t *testing.T) {
+	engine, db := dbtest.Open()
+	db.Rows("FROM `order`", []string{"count"}, []interface{}{int64(2)})
+	module := NewModule("order", "order", "/orders").AllowStats("status")
+	module.SetDB(engine)
+
+	result := &Result{}
+	err := module.Aggregate(context.Background(), &statusFilter{Status: 1}, &StatsQuery{Aggregates: ParseAggregates("count")}, result)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), result.Data.(*Stats).Rows[0].Values["count"])
+
+	statement := db.Statements()[0]
+	assert.Contains(t, statement.SQL, "WHERE (dtd=false) AND (status = ?)")
+	assert.Equal(t, []interface{}{int64(1)}, statement.Args)
+}
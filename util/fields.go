@@ -0,0 +1,145 @@
+package util
+
+import (
+	"reflect"
+	"strings"
+	"time"
+
+	"xorm.io/xorm/names"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// StructField describes an exported field of a domain struct, with embedded
+// structs flattened the same way encoding/json and xorm flatten them.
+// Json is empty when the field is hidden from json, Column is empty when the
+// field is not mapped by xorm.
+type StructField struct {
+	Name   string
+	Index  []int
+	Type   reflect.Type
+	Tag    reflect.StructTag
+	Json   string
+	Column string
+}
+
+// StructFields lists the fields of a struct type (or pointer to struct type).
+// Column names are resolved from the xorm tag when quoted, otherwise with the
+// given mapper, which defaults to xorm's snake mapper.
+func StructFields(t reflect.Type, mapper names.Mapper) []StructField {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	if mapper == nil {
+		mapper = names.SnakeMapper{}
+	}
+
+	var fields []StructField
+	collectFields(t, nil, mapper, &fields)
+	return fields
+}
+
+func collectFields(t reflect.Type, index []int, mapper names.Mapper, fields *[]StructField) {
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" && !sf.Anonymous {
+			continue
+		}
+
+		idx := make([]int, len(index)+1)
+		copy(idx, index)
+		idx[len(index)] = i
+
+		ft := sf.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		xtag := sf.Tag.Get("xorm")
+		jsonName, _ := jsonKey(sf)
+		if ft.Kind() == reflect.Struct && ft != timeType && (sf.Anonymous || hasTagOption(xtag, "extends")) && jsonName == "" {
+			collectFields(ft, idx, mapper, fields)
+			continue
+		}
+		if sf.PkgPath != "" {
+			continue
+		}
+
+		field := StructField{
+			Name:  sf.Name,
+			Index: idx,
+			Type:  sf.Type,
+			Tag:   sf.Tag,
+		}
+		if name, ok := jsonKey(sf); ok {
+			if name == "" {
+				name = sf.Name
+			}
+			field.Json = name
+		}
+		if xtag != "-" {
+			field.Column = columnName(sf.Name, xtag, mapper)
+		}
+		*fields = append(*fields, field)
+	}
+}
+
+// jsonKey returns the explicit json name of a field and whether the field is
+// visible to encoding/json at all.
+func jsonKey(sf reflect.StructField) (string, bool) {
+	tag := sf.Tag.Get("json")
+	if tag == "-" {
+		return "", false
+	}
+	if idx := strings.Index(tag, ","); idx >= 0 {
+		tag = tag[:idx]
+	}
+	return tag, true
+}
+
+func columnName(fieldName string, xtag string, mapper names.Mapper) string {
+	parts := strings.Fields(xtag)
+	for i := 0; i < len(parts); i++ {
+		part := parts[i]
+		if strings.EqualFold(part, "default") {
+			// the quoted value following default is no column name
+			i++
+			continue
+		}
+		if len(part) > 1 && part[0] == '\'' && part[len(part)-1] == '\'' {
+			return part[1 : len(part)-1]
+		}
+	}
+	return mapper.Obj2Table(fieldName)
+}
+
+func hasTagOption(tag string, option string) bool {
+	for _, part := range strings.Fields(tag) {
+		if strings.EqualFold(part, option) {
+			return true
+		}
+	}
+	return false
+}
+
+// FieldByJson finds the field with the given json key.
+func FieldByJson(fields []StructField, key string) (StructField, bool) {
+	for _, field := range fields {
+		if field.Json == key {
+			return field, true
+		}
+	}
+	return StructField{}, false
+}
+
+// FieldByColumn finds the field mapped to the given column.
+func FieldByColumn(fields []StructField, column string) (StructField, bool) {
+	for _, field := range fields {
+		if field.Column == column {
+			return field, true
+		}
+	}
+	return StructField{}, false
+}
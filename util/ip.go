@@ -0,0 +1,64 @@
+package util
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ParseProxies parses the addresses or CIDR ranges of trusted proxies, skipping the
+// invalid ones, whose error is answered.
+func ParseProxies(proxies []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	var invalid error
+	for _, proxy := range proxies {
+		if !strings.Contains(proxy, "/") {
+			if strings.Contains(proxy, ":") {
+				proxy += "/128"
+			} else {
+				proxy += "/32"
+			}
+		}
+		if _, ipNet, err := net.ParseCIDR(proxy); err == nil {
+			nets = append(nets, ipNet)
+		} else {
+			invalid = err
+		}
+	}
+	return nets, invalid
+}
+
+// ClientIp answers the address a request comes from: the peer address, unless it is
+// one of proxies, then X-Forwarded-For is walked back from the right through them.
+// X-Forwarded-For is never read when proxies is empty, as any client can set it.
+func ClientIp(r *http.Request, proxies []*net.IPNet) string {
+	host, _, err := net.SplitHostPort(strings.TrimSpace(r.RemoteAddr))
+	if err != nil {
+		host = strings.TrimSpace(r.RemoteAddr)
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !trusted(proxies, ip) {
+		return host
+	}
+	forwarded := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(forwarded[i]))
+		if hop == nil {
+			break
+		}
+		ip = hop
+		if !trusted(proxies, hop) {
+			break
+		}
+	}
+	return ip.String()
+}
+
+func trusted(proxies []*net.IPNet, ip net.IP) bool {
+	for _, proxy := range proxies {
+		if proxy.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
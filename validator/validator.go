@@ -41,6 +41,20 @@ type CacheableValidator struct {
 }
 
 func (dv *CacheableValidator) ValidateStruct(target interface{}, ruleSetName string) error {
+	return dv.validateStruct(target, ruleSetName, nil)
+}
+
+// ValidateFields validates only the given struct fields of target, rules of
+// other fields in the rule set are skipped.
+func (dv *CacheableValidator) ValidateFields(target interface{}, ruleSetName string, fields ...string) error {
+	only := map[string]bool{}
+	for _, field := range fields {
+		only[field] = true
+	}
+	return dv.validateStruct(target, ruleSetName, only)
+}
+
+func (dv *CacheableValidator) validateStruct(target interface{}, ruleSetName string, only map[string]bool) error {
 	if target == nil {
 		return nil
 	}
@@ -90,6 +104,9 @@ func (dv *CacheableValidator) ValidateStruct(target interface{}, ruleSetName str
 		var verr = errors.InvalidParams()
 
 		for name, fieldRules := range ruleSet {
+			if only != nil && !only[name] {
+				continue
+			}
 			field := val.FieldByName(name)
 
 			for _, ru := range fieldRules.Rules {
@@ -123,6 +140,10 @@ func ValidateStruct(target interface{}, ruleSetName string) error {
 	return CachedValidator.ValidateStruct(target, ruleSetName)
 }
 
+func ValidateFields(target interface{}, ruleSetName string, fields ...string) error {
+	return CachedValidator.ValidateFields(target, ruleSetName, fields...)
+}
+
 func translateAndCacheRules(prefix string, fieldName string, rulesTag string) (err error) {
 	//fmt.Println("translate ruleset field " + prefix + " " + fieldName + " " + rulesTag)
 	rs := strings.TrimSpace(rulesTag)
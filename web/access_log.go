@@ -0,0 +1,166 @@
+package web
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sdjnlh/communal"
+	"github.com/sdjnlh/communal/app"
+	"github.com/sdjnlh/communal/errors"
+	"github.com/sdjnlh/communal/log"
+	"github.com/sdjnlh/communal/util"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	// failureKey keeps the error a request failed with, for the access log
+	failureKey = "failure"
+
+	DefaultAccessLogName = "access"
+)
+
+// AccessLogConfig is the accesslog config section of a web app, e.g.
+//
+//	accesslog:
+//	  sample: 10
+//	  slow: 500ms
+//	  exclude:
+//	    - /health
+//	    - GET /static/*
+//	  trustedProxies:
+//	    - 10.0.0.0/8
+//
+// Sample logs one of Sample requests, all of them when not above 1. Requests slower
+// than Slow are logged as warnings, failed ones as warnings or errors by their status,
+// and are never sampled out. Exclude lists routes or paths, with or without the method,
+// a trailing * matching their prefix. The client ip is read from X-Forwarded-For when
+// the request comes from one of TrustedProxies, never when none is set.
+type AccessLogConfig struct {
+	Name           string
+	Sample         int
+	Slow           time.Duration
+	Exclude        []string
+	TrustedProxies []string
+}
+
+// recordFailure keeps the error a request failed with
+func recordFailure(c *gin.Context, err error) {
+	if err != nil {
+		c.Set(failureKey, err)
+	}
+}
+
+// AccessLogHandler logs requests by the accesslog config of webapp
+func AccessLogHandler(webapp *app.Web) gin.HandlerFunc {
+	conf := &AccessLogConfig{}
+	if webapp.Started() {
+		if webapp.RawConfig != nil {
+			_ = webapp.RawConfig.UnmarshalKey("accesslog", conf)
+		}
+	} else {
+		webapp.Subscribe("accesslog", conf)
+	}
+
+	// the config is read when the app starts, after the handler is made
+	var once sync.Once
+	var handler gin.HandlerFunc
+	return func(c *gin.Context) {
+		once.Do(func() {
+			handler = AccessLog(conf)
+		})
+		handler(c)
+	}
+}
+
+// AccessLog logs a line per request with the logger named conf.Name, "access" by
+// default, so that access logs can be sent to their own sink
+func AccessLog(conf *AccessLogConfig) gin.HandlerFunc {
+	name := conf.Name
+	if name == "" {
+		name = DefaultAccessLogName
+	}
+	proxies, err := util.ParseProxies(conf.TrustedProxies)
+	if err != nil {
+		log.Logger.Warn("invalid trusted proxy", zap.Error(err))
+	}
+	var count uint64
+
+	return func(c *gin.Context) {
+		start := time.Now()
+		path := c.Request.URL.Path
+		c.Next()
+
+		if excluded(conf.Exclude, c.Request.Method, c.FullPath(), path) {
+			return
+		}
+		latency := time.Since(start)
+		status := c.Writer.Status()
+		size := c.Writer.Size()
+		if size < 0 {
+			size = 0
+		}
+
+		level := zapcore.InfoLevel
+		if status >= 500 {
+			level = zapcore.ErrorLevel
+		} else if status >= 400 || (conf.Slow > 0 && latency >= conf.Slow) {
+			level = zapcore.WarnLevel
+		}
+		if level == zapcore.InfoLevel && conf.Sample > 1 && atomic.AddUint64(&count, 1)%uint64(conf.Sample) != 1 {
+			return
+		}
+		if log.Logger.Logger == nil {
+			return
+		}
+
+		fields := []zap.Field{
+			zap.String("method", c.Request.Method),
+			zap.String("route", c.FullPath()),
+			zap.String("path", path),
+			zap.Int("status", status),
+			zap.Duration("latency", latency),
+			zap.Int("bytes", size),
+			zap.String("ip", util.ClientIp(c.Request, proxies)),
+		}
+		if uid := c.GetInt64(communal.UserIdKey); uid > 0 {
+			fields = append(fields, zap.Int64("uid", uid))
+		}
+		if requestId := c.GetString(log.RequestIdKey); requestId != "" {
+			fields = append(fields, zap.String(log.RequestIdKey, requestId))
+		}
+		if ep := EndpointOf(c); ep != nil {
+			fields = append(fields, zap.String("endpoint", ep.Name()))
+		}
+		if failure, ok := c.Get(failureKey); ok {
+			fields = append(fields, zap.String("code", errors.CodeOf(failure.(error)).Code))
+		}
+		if ce := log.Logger.Named(name).Check(level, "access"); ce != nil {
+			ce.Write(fields...)
+		}
+	}
+}
+
+// excluded tells whether the route or the path of a request matches one of patterns
+func excluded(patterns []string, method string, route string, path string) bool {
+	for _, pattern := range patterns {
+		if i := strings.IndexByte(pattern, ' '); i > 0 {
+			if !strings.EqualFold(pattern[:i], method) {
+				continue
+			}
+			pattern = strings.TrimSpace(pattern[i+1:])
+		}
+		if strings.HasSuffix(pattern, "*") {
+			prefix := strings.TrimSuffix(pattern, "*")
+			if strings.HasPrefix(path, prefix) || (route != "" && strings.HasPrefix(route, prefix)) {
+				return true
+			}
+		} else if path == pattern || route == pattern {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,91 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sdjnlh/communal"
+	"github.com/sdjnlh/communal/errors"
+	"github.com/sdjnlh/communal/log"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestAccessLog(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	log.Logger.Logger = zap.New(core)
+	defer func() { log.Logger.Logger = zap.NewNop() }()
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.Use(RequestId, AccessLog(&AccessLogConfig{
+		Sample:         2,
+		Slow:           20 * time.Millisecond,
+		Exclude:        []string{"/health", "GET /static/*"},
+		TrustedProxies: []string{"10.0.0.0/8"},
+	}))
+	router.GET("/health", func(c *gin.Context) { c.Status(http.StatusOK) })
+	router.GET("/static/*file", func(c *gin.Context) { c.Status(http.StatusOK) })
+	router.GET("/posts/:id", func(c *gin.Context) {
+		c.Set(communal.UserIdKey, int64(5))
+		c.String(http.StatusOK, "post")
+	})
+	router.GET("/slow", func(c *gin.Context) {
+		time.Sleep(25 * time.Millisecond)
+		c.Status(http.StatusOK)
+	})
+	router.GET("/fail", func(c *gin.Context) { ApiFail(c, errors.NotFound()) })
+
+	serve := func(path string, remote string, forwarded string) {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = remote
+		if forwarded != "" {
+			req.Header.Set("X-Forwarded-For", forwarded)
+		}
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	serve("/health", "1.2.3.4:1000", "")
+	serve("/static/app.js", "1.2.3.4:1000", "")
+	assert.Equal(t, 0, logs.Len())
+
+	serve("/posts/7", "10.0.0.2:1000", "6.6.6.6, 5.6.7.8, 10.0.0.1")
+	entries := logs.TakeAll()
+	if assert.Len(t, entries, 1) {
+		entry := entries[0]
+		assert.Equal(t, "access", entry.LoggerName)
+		assert.Equal(t, zapcore.InfoLevel, entry.Level)
+		fields := entry.ContextMap()
+		assert.Equal(t, "GET", fields["method"])
+		assert.Equal(t, "/posts/:id", fields["route"])
+		assert.Equal(t, int64(200), fields["status"])
+		assert.Equal(t, int64(4), fields["bytes"])
+		assert.Equal(t, "5.6.7.8", fields["ip"])
+		assert.Equal(t, int64(5), fields["uid"])
+		assert.NotEmpty(t, fields[log.RequestIdKey])
+	}
+
+	// one of two successful requests is sampled out
+	serve("/posts/7", "1.2.3.4:1000", "6.6.6.6")
+	assert.Equal(t, 0, logs.Len())
+	serve("/posts/7", "1.2.3.4:1000", "6.6.6.6")
+	entries = logs.TakeAll()
+	if assert.Len(t, entries, 1) {
+		assert.Equal(t, "1.2.3.4", entries[0].ContextMap()["ip"], "untrusted remote")
+	}
+
+	// failed and slow requests are always logged
+	serve("/fail", "1.2.3.4:1000", "")
+	serve("/slow", "1.2.3.4:1000", "")
+	entries = logs.TakeAll()
+	if assert.Len(t, entries, 2) {
+		assert.Equal(t, zapcore.WarnLevel, entries[0].Level)
+		assert.Equal(t, errors.Common_NotFound, entries[0].ContextMap()["code"])
+		assert.Equal(t, zapcore.WarnLevel, entries[1].Level)
+	}
+}
@@ -0,0 +1,82 @@
+package web
+
+import (
+	"io"
+	"reflect"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sdjnlh/communal/client"
+)
+
+// ClientSpec describes a typed client of the api endpoints of builders, Export and
+// Import endpoints are left out as they do not answer a Result.
+func ClientSpec(pkg string, builders ...*EndpointBuilder) *client.Spec {
+	spec := &client.Spec{Package: pkg}
+	for _, builder := range builders {
+		service := &client.Service{Name: builder.Module.Name}
+		names := make([]string, 0, len(builder.endPoints))
+		for name := range builder.endPoints {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			iep := builder.endPoints[name]
+			meta, ok := iep.(interface{ Meta() *Endpoint })
+			if !ok || meta.Meta().Type == END_POINT_TYPE_HTML {
+				continue
+			}
+			ep := meta.Meta()
+			op := &client.Operation{Name: name, Method: ep.Method(), Path: ep.Path()}
+
+			switch ep := iep.(type) {
+			case *Get:
+				op.Kind, op.Domain = client.KindGet, typeOf(ep.DomainCreator)
+			case *Create:
+				op.Kind, op.Domain = client.KindCreate, typeOf(ep.DomainCreator)
+			case *Update:
+				op.Kind, op.Domain = client.KindUpdate, typeOf(idCreator(ep.DomainCreator))
+			case *Patch:
+				op.Kind, op.Domain = client.KindPatch, typeOf(idCreator(ep.DomainCreator))
+			case *Delete:
+				op.Kind = client.KindDelete
+			case *List:
+				op.Kind, op.Domain, op.Filter = client.KindList, typeOf(ep.ArrayCreator), filterTypeOf(ep.FilterCreator)
+			case *Stats:
+				op.Kind, op.Filter = client.KindStats, filterTypeOf(ep.FilterCreator)
+			case *History:
+				op.Kind = client.KindHistory
+			default:
+				continue
+			}
+			service.Operations = append(service.Operations, op)
+		}
+		spec.Services = append(spec.Services, service)
+	}
+	return spec
+}
+
+// GenerateClient writes the source of a client package for the api endpoints of
+// builders, e.g. from a go:generate program of the service:
+//
+//	web.GenerateClient(file, "articleclient", article.Builder)
+func GenerateClient(w io.Writer, pkg string, builders ...*EndpointBuilder) error {
+	return client.Generate(w, ClientSpec(pkg, builders...))
+}
+
+func typeOf(create DomainCreator) reflect.Type {
+	if value := probe(create); value != nil {
+		return reflect.TypeOf(value)
+	}
+	return nil
+}
+
+func filterTypeOf(create FilterCreator) reflect.Type {
+	if create == nil {
+		return nil
+	}
+	return typeOf(func(c *gin.Context) (interface{}, error) {
+		return create(c)
+	})
+}
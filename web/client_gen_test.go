@@ -0,0 +1,37 @@
+package web
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sdjnlh/communal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerateClient(t *testing.T) {
+	builder := NewEndpointBuilder("article", "article", "/articles")
+	builder.NewGet().Creator(func(c *gin.Context) (interface{}, error) { return &article{}, nil })
+	builder.NewList().Creator(
+		func(c *gin.Context) (communal.Filter, error) { return &articleFilter{}, nil },
+		func(c *gin.Context) (interface{}, error) { return &[]*article{}, nil },
+	)
+	builder.NewStats("Count").Creator(func(c *gin.Context) (communal.Filter, error) { return &articleFilter{}, nil })
+	builder.NewDelete()
+	builder.Api()
+	builder.NewCreate().Html()
+
+	spec := ClientSpec("articleclient", builder)
+	assert.Len(t, spec.Services[0].Operations, 4)
+
+	buf := &bytes.Buffer{}
+	assert.NoError(t, GenerateClient(buf, "articleclient", builder))
+	src := buf.String()
+	assert.Contains(t, src, "package articleclient")
+	assert.Contains(t, src, "func (pc *ArticleClient) Get(pCtx context.Context, pId int64) (*json.RawMessage, error)")
+	assert.Contains(t, src, "func (pc *ArticleClient) List(pCtx context.Context, pFilter interface{}) ([]json.RawMessage, *communal.Page, error)")
+	assert.Contains(t, src, `func (pc *ArticleClient) Count(pCtx context.Context, pFilter interface{}, pQuery *communal.StatsQuery) (*communal.Stats, error)`)
+	assert.Contains(t, src, `client.Path("/articles/stats")`)
+	assert.Contains(t, src, `pc.Call(pCtx, "DELETE", client.Path("/articles/:id", pId)`)
+	assert.NotContains(t, src, "Create(")
+}
@@ -0,0 +1,264 @@
+package web
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sdjnlh/communal/app"
+	"github.com/sdjnlh/communal/log"
+	"go.uber.org/zap"
+)
+
+var (
+	DefaultCorsMethods = []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+	DefaultCorsHeaders = []string{"Accept", "Authorization", "Cache-Control", "Content-Type", "DNT", "If-Match", "If-Modified-Since",
+		"If-None-Match", "Keep-Alive", "Origin", "User-Agent", "X-Mx-ReqToken", "X-Requested-With", IdempotencyKeyHeader, log.RequestIdHeader}
+	DefaultCorsMaxAge = 20 * 24 * time.Hour
+)
+
+// CorsConfig is read from the cors key of the app config. Methods, headers and max
+// age fall back to the defaults when not set.
+type CorsConfig struct {
+	// AllowOrigins lists exact origins, e.g. https://example.com, and wildcard
+	// subdomain patterns, e.g. https://*.example.com, which do not match the domain
+	// itself. Entries without a scheme match any scheme, * matches any origin.
+	AllowOrigins []string
+	AllowMethods []string
+	// AllowHeaders are the request headers allowed on preflight, * allows any
+	AllowHeaders     []string
+	ExposeHeaders    []string
+	MaxAge           time.Duration
+	AllowCredentials bool
+
+	// Deprecated: use AllowOrigins. AllowAll allows any origin and AllowOrigin a
+	// domain and its subdomains, both with credentials.
+	AllowAll    bool
+	AllowOrigin string
+}
+
+type corsPolicy struct {
+	// disabled when no origin is configured
+	disabled    bool
+	any         bool
+	origins     map[string]bool
+	wildcards   []string
+	methods     map[string]bool
+	anyHeader   bool
+	headers     map[string]bool
+	credentials bool
+
+	allowMethods  string
+	allowHeaders  string
+	exposeHeaders string
+	maxAge        string
+}
+
+// Cors answers preflight requests and sets the CORS headers of the requests from
+// allowed origins, requests from other origins are rejected with 403. Without allowed
+// origins CORS is off, requests are served without CORS headers and browsers keep
+// to the same origin. The config can be replaced while serving.
+type Cors struct {
+	policy atomic.Value
+}
+
+func NewCors(conf CorsConfig) *Cors {
+	cors := &Cors{}
+	cors.Configure(conf)
+	return cors
+}
+
+// CorsHandler handles CORS with the cors config of webapp, which is reloaded with it
+func CorsHandler(webapp *app.Web) func(c *gin.Context) {
+	cors := NewCors(CorsConfig{})
+	if webapp.Started() && webapp.RawConfig != nil {
+		conf := CorsConfig{}
+		_ = webapp.RawConfig.UnmarshalKey("cors", &conf)
+		cors.Configure(conf)
+	}
+	webapp.SubscribeFunc("cors", &CorsConfig{}, func(value interface{}) {
+		cors.Configure(*value.(*CorsConfig))
+	})
+	return cors.Handler
+}
+
+// Configure replaces the config of cors
+func (cors *Cors) Configure(conf CorsConfig) {
+	if len(conf.AllowOrigins) == 0 {
+		if conf.AllowAll {
+			conf.AllowOrigins = []string{"*"}
+			conf.AllowCredentials = true
+		} else if conf.AllowOrigin != "" {
+			conf.AllowOrigins = []string{conf.AllowOrigin, "*." + conf.AllowOrigin}
+			conf.AllowCredentials = true
+		}
+	}
+	if len(conf.AllowMethods) == 0 {
+		conf.AllowMethods = DefaultCorsMethods
+	}
+	if len(conf.AllowHeaders) == 0 {
+		conf.AllowHeaders = DefaultCorsHeaders
+	}
+	if conf.MaxAge == 0 {
+		conf.MaxAge = DefaultCorsMaxAge
+	}
+
+	policy := &corsPolicy{
+		origins:       map[string]bool{},
+		methods:       map[string]bool{},
+		headers:       map[string]bool{},
+		credentials:   conf.AllowCredentials,
+		exposeHeaders: strings.Join(conf.ExposeHeaders, ", "),
+	}
+	for _, origin := range conf.AllowOrigins {
+		origin = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(origin), "/"))
+		switch {
+		case origin == "*":
+			policy.any = true
+		case strings.Contains(origin, "*."):
+			policy.wildcards = append(policy.wildcards, origin)
+		case origin != "":
+			policy.origins[origin] = true
+		}
+	}
+	var methods []string
+	for _, method := range conf.AllowMethods {
+		method = strings.ToUpper(strings.TrimSpace(method))
+		policy.methods[method] = true
+		methods = append(methods, method)
+	}
+	policy.allowMethods = strings.Join(methods, ", ")
+	for _, header := range conf.AllowHeaders {
+		header = strings.TrimSpace(header)
+		if header == "*" {
+			policy.anyHeader = true
+		}
+		policy.headers[strings.ToLower(header)] = true
+	}
+	policy.allowHeaders = strings.Join(conf.AllowHeaders, ", ")
+	if conf.MaxAge > 0 {
+		policy.maxAge = strconv.FormatInt(int64(conf.MaxAge/time.Second), 10)
+	}
+	policy.disabled = !policy.any && len(policy.origins) == 0 && len(policy.wildcards) == 0
+	cors.policy.Store(policy)
+}
+
+func (cors *Cors) Handler(c *gin.Context) {
+	origin := c.GetHeader("Origin")
+	policy := cors.policy.Load().(*corsPolicy)
+	if origin == "" || policy.disabled {
+		c.Next()
+		return
+	}
+
+	header := c.Writer.Header()
+	requestMethod := c.GetHeader("Access-Control-Request-Method")
+	preflight := c.Request.Method == http.MethodOptions && requestMethod != ""
+	if preflight {
+		header.Add("Vary", "Origin")
+		header.Add("Vary", "Access-Control-Request-Method")
+		header.Add("Vary", "Access-Control-Request-Headers")
+	} else if !policy.any || policy.credentials {
+		header.Add("Vary", "Origin")
+	}
+
+	if !policy.allowOrigin(origin) {
+		log.Ctx(c).Warn("cors request from disallowed origin", zap.String("origin", origin))
+		c.AbortWithStatus(http.StatusForbidden)
+		return
+	}
+
+	if !preflight {
+		policy.setOrigin(header, origin)
+		if policy.exposeHeaders != "" {
+			header.Set("Access-Control-Expose-Headers", policy.exposeHeaders)
+		}
+		c.Next()
+		return
+	}
+
+	requestHeaders := c.GetHeader("Access-Control-Request-Headers")
+	if !policy.methods[strings.ToUpper(requestMethod)] || !policy.headersAllowed(requestHeaders) {
+		log.Ctx(c).Warn("cors preflight disallowed", zap.String("origin", origin),
+			zap.String("method", requestMethod), zap.String("headers", requestHeaders))
+		c.AbortWithStatus(http.StatusForbidden)
+		return
+	}
+	policy.setOrigin(header, origin)
+	header.Set("Access-Control-Allow-Methods", policy.allowMethods)
+	if policy.anyHeader {
+		if requestHeaders != "" {
+			header.Set("Access-Control-Allow-Headers", requestHeaders)
+		}
+	} else {
+		header.Set("Access-Control-Allow-Headers", policy.allowHeaders)
+	}
+	if policy.maxAge != "" {
+		header.Set("Access-Control-Max-Age", policy.maxAge)
+	}
+	c.AbortWithStatus(http.StatusNoContent)
+}
+
+func (policy *corsPolicy) setOrigin(header http.Header, origin string) {
+	if policy.any && !policy.credentials {
+		header.Set("Access-Control-Allow-Origin", "*")
+		return
+	}
+	header.Set("Access-Control-Allow-Origin", origin)
+	if policy.credentials {
+		header.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+func (policy *corsPolicy) allowOrigin(origin string) bool {
+	if policy.any {
+		return true
+	}
+	origin = strings.ToLower(origin)
+	i := strings.Index(origin, "://")
+	if i <= 0 {
+		return false
+	}
+	host := origin[i+3:]
+	if policy.origins[origin] || policy.origins[host] {
+		return true
+	}
+	for _, pattern := range policy.wildcards {
+		if matchWildcardOrigin(pattern, origin, host) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchWildcardOrigin matches patterns like https://*.example.com, or *.example.com
+// for any scheme, against origins of subdomains of example.com.
+func matchWildcardOrigin(pattern string, origin string, host string) bool {
+	target := host
+	if strings.Contains(pattern, "://") {
+		target = origin
+	}
+	i := strings.Index(pattern, "*.")
+	prefix, suffix := pattern[:i], pattern[i+1:]
+	if len(target) <= len(prefix)+len(suffix) || !strings.HasPrefix(target, prefix) || !strings.HasSuffix(target, suffix) {
+		return false
+	}
+	sub := target[len(prefix) : len(target)-len(suffix)]
+	return !strings.ContainsAny(sub, "/:@")
+}
+
+func (policy *corsPolicy) headersAllowed(requested string) bool {
+	if policy.anyHeader {
+		return true
+	}
+	for _, header := range strings.Split(requested, ",") {
+		header = strings.ToLower(strings.TrimSpace(header))
+		if header != "" && !policy.headers[header] {
+			return false
+		}
+	}
+	return true
+}
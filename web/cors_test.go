@@ -0,0 +1,164 @@
+package web
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sdjnlh/communal/app"
+	"github.com/sdjnlh/communal/log"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func corsRequest(router *gin.Engine, method string, origin string, headers map[string]string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(method, "/articles", nil)
+	if origin != "" {
+		req.Header.Set("Origin", origin)
+	}
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestCors(t *testing.T) {
+	log.Logger.Logger = zap.NewNop()
+	gin.SetMode(gin.TestMode)
+
+	cors := NewCors(CorsConfig{
+		AllowOrigins:     []string{"https://example.com", "https://*.example.com", "app.test:8080"},
+		AllowMethods:     []string{"get", "post"},
+		AllowHeaders:     []string{"Content-Type", "X-Token"},
+		ExposeHeaders:    []string{"ETag", "X-Total"},
+		MaxAge:           10 * time.Minute,
+		AllowCredentials: true,
+	})
+	router := gin.New()
+	router.Use(cors.Handler)
+	router.GET("/articles", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	w := corsRequest(router, http.MethodGet, "", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+
+	for _, origin := range []string{"https://example.com", "https://api.example.com", "https://a.b.example.com", "http://app.test:8080"} {
+		w = corsRequest(router, http.MethodGet, origin, nil)
+		assert.Equal(t, http.StatusOK, w.Code, origin)
+		assert.Equal(t, origin, w.Header().Get("Access-Control-Allow-Origin"))
+		assert.Equal(t, "true", w.Header().Get("Access-Control-Allow-Credentials"))
+		assert.Equal(t, "ETag, X-Total", w.Header().Get("Access-Control-Expose-Headers"))
+		assert.Equal(t, []string{"Origin"}, w.Header()["Vary"])
+	}
+
+	for _, origin := range []string{"https://evilexample.com", "http://api.example.com", "https://example.com.evil.com", "https://app.test", "null"} {
+		w = corsRequest(router, http.MethodGet, origin, nil)
+		assert.Equal(t, http.StatusForbidden, w.Code, origin)
+		assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+		assert.Equal(t, []string{"Origin"}, w.Header()["Vary"])
+	}
+
+	w = corsRequest(router, http.MethodOptions, "https://api.example.com", map[string]string{
+		"Access-Control-Request-Method":  "POST",
+		"Access-Control-Request-Headers": "content-type, x-token",
+	})
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "https://api.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "GET, POST", w.Header().Get("Access-Control-Allow-Methods"))
+	assert.Equal(t, "Content-Type, X-Token", w.Header().Get("Access-Control-Allow-Headers"))
+	assert.Equal(t, "600", w.Header().Get("Access-Control-Max-Age"))
+	assert.Equal(t, []string{"Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers"}, w.Header()["Vary"])
+
+	w = corsRequest(router, http.MethodOptions, "https://api.example.com", map[string]string{"Access-Control-Request-Method": "DELETE"})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = corsRequest(router, http.MethodOptions, "https://api.example.com", map[string]string{
+		"Access-Control-Request-Method":  "GET",
+		"Access-Control-Request-Headers": "X-Other",
+	})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	cors.Configure(CorsConfig{AllowOrigins: []string{"*"}, AllowHeaders: []string{"*"}})
+	w = corsRequest(router, http.MethodGet, "https://other.org", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "*", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Credentials"))
+	assert.Empty(t, w.Header()["Vary"])
+
+	w = corsRequest(router, http.MethodOptions, "https://other.org", map[string]string{
+		"Access-Control-Request-Method":  "PATCH",
+		"Access-Control-Request-Headers": "X-Other",
+	})
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "X-Other", w.Header().Get("Access-Control-Allow-Headers"))
+	assert.Equal(t, "1728000", w.Header().Get("Access-Control-Max-Age"))
+}
+
+func TestCorsLegacyConfig(t *testing.T) {
+	log.Logger.Logger = zap.NewNop()
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.Use(NewCors(CorsConfig{AllowOrigin: "example.com"}).Handler)
+	router.GET("/articles", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	w := corsRequest(router, http.MethodGet, "https://www.example.com", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "true", w.Header().Get("Access-Control-Allow-Credentials"))
+	w = corsRequest(router, http.MethodGet, "https://badexample.com", nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func TestCorsHandlerReload(t *testing.T) {
+	log.Logger.Logger = zap.NewNop()
+	gin.SetMode(gin.TestMode)
+
+	file := filepath.Join(t.TempDir(), "web.yml")
+	writeConfig := func(content string) {
+		assert.NoError(t, ioutil.WriteFile(file, []byte(content), 0644))
+	}
+	writeConfig("cors:\n  allowOrigins: [https://a.example.com, https://b.example.com]\n  maxAge: 10m\n")
+
+	webapp := &app.Web{}
+	webapp.RawConfig = viper.New()
+	webapp.RawConfig.SetConfigFile(file)
+	router := gin.New()
+	router.Use(CorsHandler(webapp))
+	router.GET("/articles", func(c *gin.Context) { c.Status(http.StatusOK) })
+	assert.NoError(t, webapp.Reload())
+
+	w := corsRequest(router, http.MethodOptions, "https://b.example.com", map[string]string{"Access-Control-Request-Method": "GET"})
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "600", w.Header().Get("Access-Control-Max-Age"))
+
+	writeConfig("cors:\n  allowOrigins: [https://a.example.com]\n")
+	assert.NoError(t, webapp.Reload())
+	assert.Equal(t, http.StatusForbidden, corsRequest(router, http.MethodGet, "https://b.example.com", nil).Code)
+	assert.Equal(t, http.StatusOK, corsRequest(router, http.MethodGet, "https://a.example.com", nil).Code)
+	w = corsRequest(router, http.MethodOptions, "https://a.example.com", map[string]string{"Access-Control-Request-Method": "GET"})
+	assert.Equal(t, "1728000", w.Header().Get("Access-Control-Max-Age"), "reloads start from a fresh config")
+}
+
+func TestCorsHandlerNoConfig(t *testing.T) {
+	log.Logger.Logger = zap.NewNop()
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.Use(CorsHandler(&app.Web{}))
+	router.GET("/articles", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	w := corsRequest(router, http.MethodGet, "https://example.com", nil)
+	assert.Equal(t, http.StatusOK, w.Code, "cors is off without a config")
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Empty(t, w.Header()["Vary"])
+
+	w = corsRequest(router, http.MethodOptions, "https://example.com", map[string]string{"Access-Control-Request-Method": "GET"})
+	assert.NotEqual(t, http.StatusForbidden, w.Code)
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+}
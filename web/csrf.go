@@ -0,0 +1,285 @@
+package web
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"github.com/sdjnlh/communal"
+	"github.com/sdjnlh/communal/app"
+	"github.com/sdjnlh/communal/errors"
+	"github.com/sdjnlh/communal/log"
+	"go.uber.org/zap"
+)
+
+const (
+	CsrfHeader = "X-CSRF-Token"
+	// CsrfField is the form field of the token, and the name of the double-submit cookie
+	CsrfField = "_csrf"
+	// CsrfTokenKey is where the token is kept, in the gin context, the session and the
+	// extra of the results rendered as HTML
+	CsrfTokenKey = "csrfToken"
+)
+
+// CsrfConfig is read from the csrf key of the app config
+type CsrfConfig struct {
+	// Exempt lists the routes not checked, as registered, e.g. /hooks/:id, or
+	// prefixed by the method, e.g. POST /login, a trailing * matches any suffix
+	Exempt []string
+	// Page renders the rejections, which are redirected to /403.html by default
+	Page string
+	// Secret signs the double-submit cookies, the secret of the jwt store by default.
+	// Apps without a session store fail to start without one.
+	Secret string
+	Secure bool
+}
+
+// Csrf rejects unsafe requests, not GET, HEAD, OPTIONS or TRACE, without the token of
+// the user, given in the X-CSRF-Token header or the _csrf form field. The token is a
+// synchronizer token kept in the session with the session store, and a double-submit
+// cookie signed with the user otherwise. Csrf is used after the state store, so that
+// the session and the user are available.
+type Csrf struct {
+	Config CsrfConfig
+	// Session tells whether the token is kept in the session, the cookie is used when nil
+	Session func() bool
+	// Domain, Path and Secret of the cookie, Config.Secret is used when Secret is nil
+	Domain func() string
+	Path   func() string
+	Secret func() []byte
+}
+
+// CsrfHandler protects the routes of webapp, keeping the token in the session when its
+// state store is a session store. Without one, the app fails to start when no secret
+// signs the cookies.
+func CsrfHandler(webapp *app.Web) func(c *gin.Context) {
+	csrf := &Csrf{}
+	if webapp.Started() {
+		if webapp.RawConfig != nil {
+			_ = webapp.RawConfig.UnmarshalKey("csrf", &csrf.Config)
+		}
+	} else {
+		webapp.Subscribe("csrf", &csrf.Config)
+	}
+
+	csrf.Session = func() bool {
+		if webapp.StateManager == nil {
+			return false
+		}
+		_, ok := webapp.StateManager.Store.(*app.SessionStore)
+		return ok
+	}
+	csrf.Domain = func() string {
+		if webapp.StateManager == nil {
+			return ""
+		}
+		return webapp.StateManager.Domain()
+	}
+	csrf.Path = func() string {
+		if webapp.StateManager == nil {
+			return ""
+		}
+		return webapp.StateManager.Path()
+	}
+	csrf.Secret = func() []byte {
+		if csrf.Config.Secret != "" {
+			return []byte(csrf.Config.Secret)
+		}
+		if webapp.StateManager != nil {
+			if js, ok := webapp.StateManager.Store.(*app.JwtStore); ok && js.Options.Secret != "" {
+				return []byte(js.Options.Secret)
+			}
+		}
+		return nil
+	}
+
+	// the state manager is set when the app starts, after the handler is made
+	check := func() error {
+		if !csrf.Session() && len(csrf.Secret()) == 0 {
+			return errors.ServerErrorWithMsg("csrf secret needed without a session store")
+		}
+		return nil
+	}
+	if webapp.Started() {
+		if err := check(); err != nil {
+			panic(err.Error())
+		}
+	} else {
+		app.OnStarted(webapp.Name()+".USTM", func(ctx communal.Context) error {
+			return check()
+		})
+	}
+	return csrf.Handler
+}
+
+func (csrf *Csrf) Handler(c *gin.Context) {
+	var token string
+	if csrf.Session != nil && csrf.Session() {
+		token = csrf.sessionToken(c)
+	} else {
+		token = csrf.cookieToken(c)
+	}
+	if token == "" {
+		DefaultHtmlHandler.InternalError(c, "", nil)
+		c.Abort()
+		return
+	}
+	c.Set(CsrfTokenKey, token)
+
+	switch c.Request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		c.Next()
+		return
+	}
+	if csrf.exempt(c) {
+		c.Next()
+		return
+	}
+
+	submitted := c.GetHeader(CsrfHeader)
+	if submitted == "" {
+		submitted = c.PostForm(CsrfField)
+	}
+	if submitted == "" || subtle.ConstantTimeCompare([]byte(submitted), []byte(token)) != 1 {
+		log.Ctx(c).Warn("csrf token mismatch", zap.String("method", c.Request.Method), zap.String("path", c.Request.URL.Path))
+		DefaultHtmlHandler.Forbidden(c, csrf.Config.Page, &errors.SimpleBizError{Code: errors.Common_Forbidden, Msg: "invalid csrf token"})
+		c.Abort()
+		return
+	}
+	c.Next()
+}
+
+func (csrf *Csrf) exempt(c *gin.Context) bool {
+	route := c.FullPath()
+	for _, pattern := range csrf.Config.Exempt {
+		target := route
+		if i := strings.IndexByte(pattern, ' '); i > 0 {
+			if !strings.EqualFold(pattern[:i], c.Request.Method) {
+				continue
+			}
+			pattern = strings.TrimSpace(pattern[i+1:])
+		}
+		if strings.HasSuffix(pattern, "*") {
+			if strings.HasPrefix(target, strings.TrimSuffix(pattern, "*")) {
+				return true
+			}
+		} else if target == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+func (csrf *Csrf) sessionToken(c *gin.Context) string {
+	session := sessions.Default(c)
+	if token, ok := session.Get(CsrfTokenKey).(string); ok && token != "" {
+		return token
+	}
+	token := randomToken()
+	session.Set(CsrfTokenKey, token)
+	if err := session.Save(); err != nil {
+		log.Ctx(c).Error("fail to save csrf token", zap.Error(err))
+		return ""
+	}
+	return token
+}
+
+// cookieToken answers the token of the double-submit cookie, a random value and its
+// signature with the user, so that cookies planted by other subdomains, or minted for
+// another user, are rejected
+func (csrf *Csrf) cookieToken(c *gin.Context) string {
+	secret := []byte(csrf.Config.Secret)
+	if csrf.Secret != nil {
+		secret = csrf.Secret()
+	}
+	if len(secret) == 0 {
+		log.Ctx(c).Error("no secret to sign csrf cookies")
+		return ""
+	}
+	identity := strconv.FormatInt(c.GetInt64(communal.UserIdKey), 10)
+	if token, err := c.Cookie(CsrfField); err == nil && validCsrfCookie(token, identity, secret) {
+		return token
+	}
+	value := randomToken()
+	token := value + "." + csrfSignature(value, identity, secret)
+
+	path, domain := "/", ""
+	if csrf.Path != nil && csrf.Path() != "" {
+		path = csrf.Path()
+	}
+	if csrf.Domain != nil {
+		domain = csrf.Domain()
+	}
+	c.SetSameSite(http.SameSiteLaxMode)
+	// readable by scripts, which send it back in the header
+	c.SetCookie(CsrfField, token, 0, path, domain, csrf.Config.Secure, false)
+	return token
+}
+
+func validCsrfCookie(token string, identity string, secret []byte) bool {
+	i := strings.IndexByte(token, '.')
+	if i <= 0 {
+		return false
+	}
+	return hmac.Equal([]byte(token[i+1:]), []byte(csrfSignature(token[:i], identity, secret)))
+}
+
+func csrfSignature(value string, identity string, secret []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(value + "\n" + identity))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func randomToken() string {
+	data := make([]byte, 32)
+	if _, err := rand.Read(data); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// CsrfToken answers the token of the request, for the X-CSRF-Token header of ajax calls
+func CsrfToken(c *gin.Context) string {
+	return c.GetString(CsrfTokenKey)
+}
+
+// withCsrf puts the token into the extra of results rendered as HTML
+func withCsrf(c *gin.Context, data interface{}) {
+	if result, ok := data.(communal.IResult); ok && result != nil {
+		if token := CsrfToken(c); token != "" {
+			result.Set(CsrfTokenKey, token)
+		}
+	}
+}
+
+// csrfTokenOf answers the token of the data of a template, a result, a map or the token
+func csrfTokenOf(data interface{}) string {
+	var extra map[string]interface{}
+	switch value := data.(type) {
+	case string:
+		return value
+	case *communal.Result:
+		extra = value.Extra
+	case *communal.FilterResult:
+		extra = value.Extra
+	case gin.H:
+		extra = value
+	case map[string]interface{}:
+		extra = value
+	}
+	token, _ := extra[CsrfTokenKey].(string)
+	return token
+}
+
+// csrfField renders the hidden form field of the token, {{csrfField .}}
+func csrfField(data interface{}) template.HTML {
+	return template.HTML(`<input type="hidden" name="` + CsrfField + `" value="` + template.HTMLEscapeString(csrfTokenOf(data)) + `">`)
+}
@@ -0,0 +1,160 @@
+package web
+
+import (
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-contrib/sessions/memstore"
+	"github.com/gin-gonic/gin"
+	"github.com/sdjnlh/communal"
+	"github.com/sdjnlh/communal/app"
+	"github.com/sdjnlh/communal/log"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func csrfRouter(csrf *Csrf, session bool) *gin.Engine {
+	router := gin.New()
+	if session {
+		router.Use(sessions.Sessions("sid", memstore.NewStore([]byte("secret"))))
+	}
+	router.Use(csrf.Handler)
+	router.SetHTMLTemplate(template.Must(template.New("form").Funcs(CommonFuncMap).Parse(`<form>{{csrfField .}}</form>`)))
+	router.GET("/form", func(c *gin.Context) {
+		DefaultHtmlHandler.Result(c, "form", &communal.Result{Ok: true})
+	})
+	router.POST("/articles", func(c *gin.Context) { c.Status(http.StatusOK) })
+	router.POST("/hooks/:id", func(c *gin.Context) { c.Status(http.StatusOK) })
+	return router
+}
+
+func csrfPost(router *gin.Engine, path string, cookies []*http.Cookie, header string, field string) *httptest.ResponseRecorder {
+	var req *http.Request
+	if field != "" {
+		req = httptest.NewRequest(http.MethodPost, path, strings.NewReader(url.Values{CsrfField: {field}}.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	} else {
+		req = httptest.NewRequest(http.MethodPost, path, nil)
+	}
+	if header != "" {
+		req.Header.Set(CsrfHeader, header)
+	}
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func formToken(t *testing.T, w *httptest.ResponseRecorder) string {
+	body := w.Body.String()
+	start := strings.Index(body, `value="`)
+	if !assert.True(t, start > 0, body) {
+		return ""
+	}
+	body = body[start+len(`value="`):]
+	return body[:strings.IndexByte(body, '"')]
+}
+
+func TestCsrfCookie(t *testing.T) {
+	log.Logger.Logger = zap.NewNop()
+	gin.SetMode(gin.TestMode)
+	router := csrfRouter(&Csrf{Config: CsrfConfig{Secret: "s3cret", Exempt: []string{"POST /hooks/*"}}}, false)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/form", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	cookies := w.Result().Cookies()
+	if !assert.Len(t, cookies, 1) {
+		return
+	}
+	assert.Equal(t, CsrfField, cookies[0].Name)
+	assert.False(t, cookies[0].HttpOnly)
+	token := formToken(t, w)
+	assert.Equal(t, cookies[0].Value, token)
+
+	assert.Equal(t, http.StatusOK, csrfPost(router, "/articles", cookies, token, "").Code)
+	assert.Equal(t, http.StatusOK, csrfPost(router, "/articles", cookies, "", token).Code)
+	assert.Equal(t, http.StatusOK, csrfPost(router, "/hooks/1", nil, "", "").Code)
+
+	w = csrfPost(router, "/articles", cookies, "", "")
+	assert.Equal(t, http.StatusSeeOther, w.Code)
+	assert.Equal(t, "/403.html", w.Header().Get("Location"))
+	assert.Equal(t, http.StatusSeeOther, csrfPost(router, "/articles", cookies, "forged", "").Code)
+
+	// a cookie not signed with the secret, e.g. planted by another subdomain
+	planted := []*http.Cookie{{Name: CsrfField, Value: "abc.def"}}
+	assert.Equal(t, http.StatusSeeOther, csrfPost(router, "/articles", planted, "abc.def", "").Code)
+}
+
+func TestCsrfSession(t *testing.T) {
+	log.Logger.Logger = zap.NewNop()
+	gin.SetMode(gin.TestMode)
+	router := csrfRouter(&Csrf{Session: func() bool { return true }}, true)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/form", nil))
+	cookies := w.Result().Cookies()
+	if !assert.Len(t, cookies, 1) {
+		return
+	}
+	assert.Equal(t, "sid", cookies[0].Name)
+	token := formToken(t, w)
+	assert.NotEmpty(t, token)
+
+	w = httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/form", nil)
+	req.AddCookie(cookies[0])
+	router.ServeHTTP(w, req)
+	assert.Equal(t, token, formToken(t, w))
+
+	assert.Equal(t, http.StatusOK, csrfPost(router, "/articles", cookies, token, "").Code)
+	assert.Equal(t, http.StatusSeeOther, csrfPost(router, "/articles", cookies, "forged", "").Code)
+	assert.Equal(t, http.StatusSeeOther, csrfPost(router, "/articles", nil, token, "").Code)
+}
+
+func TestCsrfCookie_User(t *testing.T) {
+	log.Logger.Logger = zap.NewNop()
+	gin.SetMode(gin.TestMode)
+	csrf := &Csrf{Config: CsrfConfig{Secret: "s3cret"}}
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		if uid, err := strconv.ParseInt(c.GetHeader("X-Uid"), 10, 64); err == nil {
+			c.Set(communal.UserIdKey, uid)
+		}
+	}, csrf.Handler)
+	router.POST("/articles", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	post := func(uid string, cookies []*http.Cookie, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/articles", nil)
+		req.Header.Set("X-Uid", uid)
+		req.Header.Set(CsrfHeader, token)
+		for _, cookie := range cookies {
+			req.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := post("1", nil, "")
+	cookies := w.Result().Cookies()
+	if !assert.Len(t, cookies, 1) {
+		return
+	}
+	assert.Equal(t, http.StatusOK, post("1", cookies, cookies[0].Value).Code)
+	assert.Equal(t, http.StatusSeeOther, post("2", cookies, cookies[0].Value).Code, "cookies are bound to their user")
+}
+
+func TestCsrfHandler_Secret(t *testing.T) {
+	webapp := app.NewWeb("csrf")
+	webapp.SetStarted(true)
+	assert.Panics(t, func() { CsrfHandler(webapp) }, "no secret without a session store")
+}
@@ -6,12 +6,16 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
 	"github.com/sdjnlh/communal"
 	"github.com/sdjnlh/communal/errors"
 	"github.com/sdjnlh/communal/log"
+	"github.com/sdjnlh/communal/policy"
+	"github.com/sdjnlh/communal/rbac"
+	"github.com/sdjnlh/communal/rpc"
 	"github.com/sdjnlh/communal/util"
 	"github.com/sdjnlh/communal/validator"
 	"go.uber.org/zap"
@@ -41,8 +45,34 @@ type Endpoint struct {
 	RouterPath   string
 	RightKey     string
 	RightChecker func(c *gin.Context, ep *Endpoint) bool
-	registered   bool
-	page         string
+	// ETag tags the domains of conditional endpoints, nil when not conditional
+	ETag ETagFunc
+	// Policies authorize users on the entity loaded by the endpoint
+	Policies   []policy.Policy
+	Hooks      Hooks
+	scoped     bool
+	registered bool
+	page       string
+}
+
+// Meta gives access to the endpoint metadata of the concrete endpoints
+func (ep *Endpoint) Meta() *Endpoint {
+	return ep
+}
+
+// Name of the endpoint as used for rights, {module}:{rightKey}
+func (ep *Endpoint) Name() string {
+	return ep.Module.Name + ":" + ep.RightKey
+}
+
+// Method is the upper case http method of the endpoint
+func (ep *Endpoint) Method() string {
+	return strings.ToUpper(ep.HttpMethod)
+}
+
+// Path is the route of the endpoint, module prefix included
+func (ep *Endpoint) Path() string {
+	return ep.Module.RoutePrefix + ep.RouterPath
 }
 
 func (ep *Endpoint) Html() *Endpoint {
@@ -80,7 +110,7 @@ func (ep *Endpoint) AdminRightCheck() *Endpoint {
 func (ep *Endpoint) hasRight(c *gin.Context) bool {
 	rights := c.GetStringMap(communal.UserRightKey)
 
-	if rights == nil && rights[ep.RightKey] == nil {
+	if rights == nil || (rights[ep.Name()] == nil && rights[ep.RightKey] == nil) {
 		return false
 	}
 
@@ -117,6 +147,13 @@ func (ep *Endpoint) SetType(typ EndpointType) {
 		if ep.Fail == nil {
 			ep.Fail = EndpointHtmlFail
 		}
+	} else if typ == END_POINT_TYPE_NEGOTIATED {
+		if ep.Success == nil {
+			ep.Success = EndpointNegotiatedSuccess
+		}
+		if ep.Fail == nil {
+			ep.Fail = EndpointNegotiatedFail
+		}
 	} else {
 		if ep.Success == nil {
 			ep.Success = EndpointApiSuccess
@@ -148,6 +185,17 @@ func (bep *Endpoint) validateId(c *gin.Context) (id int64, err error) {
 	return
 }
 
+// expand reads the relations requested with the comma separated expand query param
+func (ep *Endpoint) expand(c *gin.Context) []string {
+	var names []string
+	for _, name := range strings.Split(c.Query("expand"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
 func (ep *Endpoint) BindAndValidate(c *gin.Context, domain interface{}, ruleSetName string) (err error) {
 	err = c.ShouldBind(domain)
 	if err != nil {
@@ -180,6 +228,14 @@ func (ep *Endpoint) register(router gin.IRouter, handlers ...gin.HandlerFunc) {
 		if ep.Success == nil {
 			ep.Success = EndpointHtmlSuccess
 		}
+	} else if ep.Type == END_POINT_TYPE_NEGOTIATED {
+		if ep.Fail == nil {
+			ep.Fail = EndpointNegotiatedFail
+		}
+
+		if ep.Success == nil {
+			ep.Success = EndpointNegotiatedSuccess
+		}
 	} else {
 		if ep.Fail == nil {
 			ep.Fail = EndpointApiFail
@@ -191,27 +247,39 @@ func (ep *Endpoint) register(router gin.IRouter, handlers ...gin.HandlerFunc) {
 	}
 
 	if ep.RightChecker == nil {
-		ep.RightChecker = AlwaysRejectRightChecker
+		ep.RightChecker = DefaultRightChecker
 	}
 
 	var httpMethod = strings.ToLower(ep.HttpMethod)
-	hds := append(handlers)
-	if httpMethod == "get" {
-		router.GET(path, hds...)
-	} else if httpMethod == "post" {
-		router.POST(path, hds...)
-	} else if httpMethod == "put" {
-		router.PUT(path, hds...)
-	} else if httpMethod == "delete" {
-		router.DELETE(path, hds...)
-	} else {
-		panic("unsupported endpoint http method: " + httpMethod + ", " + ep.Module.Name)
+	hds := handlers
+	paths := []string{path}
+	if ep.Type == END_POINT_TYPE_NEGOTIATED {
+		hds = append([]gin.HandlerFunc{negotiate}, handlers...)
+		if !endsWithParam(path) {
+			paths = append(paths, path+jsonSuffix)
+		}
+	}
+	for _, path := range paths {
+		routeEndpoints.Store(strings.ToUpper(httpMethod)+" "+fullPath(router, path), ep)
+		if httpMethod == "get" {
+			router.GET(path, hds...)
+		} else if httpMethod == "post" {
+			router.POST(path, hds...)
+		} else if httpMethod == "put" {
+			router.PUT(path, hds...)
+		} else if httpMethod == "patch" {
+			router.PATCH(path, hds...)
+		} else if httpMethod == "delete" {
+			router.DELETE(path, hds...)
+		} else {
+			panic("unsupported endpoint http method: " + httpMethod + ", " + ep.Module.Name)
+		}
 	}
 	ep.registered = true
 }
 
 func EndpointApiFail(c *gin.Context, md *Endpoint, err error) {
-	log.Logger.Warn(md.Module.Name+" endpoint error", zap.String("error", err.Error()))
+	logFailure(c, md.Module.Name+" endpoint error", err)
 
 	ApiFail(c, err)
 }
@@ -222,39 +290,83 @@ func EndpointApiSuccess(c *gin.Context, md *Endpoint, data interface{}) {
 
 //TODO process error
 func EndpointHtmlFail(c *gin.Context, md *Endpoint, err error) {
-	log.Logger.Warn(md.Module.Name+" endpoint error", zap.String("error", err.Error()))
+	logFailure(c, md.Module.Name+" endpoint error", err)
 
 	HtmlFail(c, md.page, err)
 }
 
 func EndpointHtmlSuccess(c *gin.Context, md *Endpoint, data interface{}) {
+	withCsrf(c, data)
 	c.HTML(http.StatusOK, md.page, data)
 }
 
 var AlwaysPassRightChecker = func(c *gin.Context, ep *Endpoint) bool { return true }
 var AlwaysRejectRightChecker = func(c *gin.Context, ep *Endpoint) bool { return false }
 
+// DefaultRightChecker rejects the requests to endpoints registered without a right
+// checker, warning that one is missing
+var DefaultRightChecker = func(c *gin.Context, ep *Endpoint) bool {
+	log.Ctx(c).Warn("no right checker set for endpoint, request rejected", zap.String("endpoint", ep.Name()))
+	return false
+}
+
+// ContextRightChecker grants the endpoints whose name or right key is in the rights
+// map set in the context
+var ContextRightChecker = func(c *gin.Context, ep *Endpoint) bool {
+	return ep.hasRight(c)
+}
+
 var EndpointAdminRightChecker = func(c *gin.Context, ep *Endpoint) bool {
 	return AdminRightChecker(c, ep.Module.Name+":"+ep.RightKey)
 }
+
+// AdminRightChecker looks rightKey up in the rights set in the context by the state
+// builder, falling back to the rights kept in the session. Rights may be wildcard
+// patterns, see rbac.Match.
 var AdminRightChecker = func(c *gin.Context, rightKey string) bool {
-	session := sessions.Default(c)
-	value := session.Get("rights")
-	if value == nil {
-		return false
-	}
-	rights := value.(string)
-	array := strings.Split(rights, ",")
-	if len(array) < 1 {
-		return false
-	}
-	for _, right := range array {
-		if rightKey == right {
-			return true
+	value, ok := c.Get(communal.UserRightKey)
+	if !ok {
+		if _, hasSession := c.Get(sessions.DefaultKey); !hasSession {
+			return false
+		}
+		value = sessions.Default(c).Get(communal.UserRightKey)
+	}
+	return rbac.Any(rightsOf(value), rightKey)
+}
+
+// rightsOf reads rights kept as a comma separated string, a list or a set
+func rightsOf(value interface{}) []string {
+	switch rights := value.(type) {
+	case string:
+		return strings.Split(rights, ",")
+	case []string:
+		return rights
+	case []interface{}:
+		array := make([]string, 0, len(rights))
+		for _, right := range rights {
+			if s, ok := right.(string); ok {
+				array = append(array, s)
+			}
 		}
+		return array
+	case map[string]interface{}:
+		array := make([]string, 0, len(rights))
+		for right, granted := range rights {
+			if granted != nil && granted != false {
+				array = append(array, right)
+			}
+		}
+		return array
+	case map[string]bool:
+		array := make([]string, 0, len(rights))
+		for right, granted := range rights {
+			if granted {
+				array = append(array, right)
+			}
+		}
+		return array
 	}
-
-	return false
+	return nil
 }
 
 type Get struct {
@@ -267,6 +379,7 @@ func (ep *Get) Register(router gin.IRouter, handlers ...gin.HandlerFunc) {
 		panic("domain creator needed for Get endpoint")
 	}
 
+	ep.checkHooks(ep)
 	ep.Endpoint.register(router, append(handlers, ep.Do)...)
 }
 
@@ -297,24 +410,50 @@ func (ep *Get) Do(c *gin.Context) {
 		ep.Fail(c, ep.Endpoint, err)
 		return
 	}
+	if err = ep.hook(c, ep.Hooks.beforeBind, result.Data); err != nil {
+		ep.Fail(c, ep.Endpoint, err)
+		return
+	}
 	//log.Logger.Debug("rpc params", zap.Any("domain", domain))
 
 	if ep.Module.RpcOn {
-		//if err = rpc.RPC.Call(context.Background(), ep.Module.Name, ep.RpcMethod, id, result); err != nil {
-		//	//log.Logger.Error("failed to call rpc", zap.Any("error", err))
-		//	ep.Fail(c, ep.Endpoint, err)
-		//	return
-		//}
+		if err = rpc.Call(c, ep.Module.Name, ep.RpcMethod, id, result); err != nil {
+			ep.Fail(c, ep.Endpoint, err)
+			return
+		}
 	} else {
-		_, err := ep.Module.Db.ID(id).Get(result.Data)
+		has, err := ep.Module.Load(c, id, result.Data)
 		if err != nil {
 			ep.Fail(c, ep.Endpoint, err)
 			return
 		}
+		if !has {
+			ep.Fail(c, ep.Endpoint, errors.NotFound())
+			return
+		}
+		if err = ep.Module.Expand(c, result.Data, ep.expand(c)...); err != nil {
+			ep.Fail(c, ep.Endpoint, err)
+			return
+		}
 		result.Ok = true
 	}
 
 	if result.Ok {
+		if err = ep.authorize(c, result.Data); err != nil {
+			ep.Fail(c, ep.Endpoint, err)
+			return
+		}
+		if err = ep.hook(c, ep.Hooks.afterBind, result.Data); err != nil {
+			ep.Fail(c, ep.Endpoint, err)
+			return
+		}
+		if ep.notModified(c, result.Data) {
+			return
+		}
+		if result.Data, err = ep.transform(c, result.Data); err != nil {
+			ep.Fail(c, ep.Endpoint, err)
+			return
+		}
 		result.Error = nil
 		ep.Success(c, ep.Endpoint, result)
 		//c.JSON(http.StatusOK, result)
@@ -325,6 +464,8 @@ func (ep *Get) Do(c *gin.Context) {
 
 type Create struct {
 	DomainCreator DomainCreator
+	// Idempotency is set for endpoints honoring the Idempotency-Key header
+	Idempotency *Idempotency
 	*Endpoint
 }
 
@@ -332,6 +473,7 @@ func (ep *Create) Register(router gin.IRouter, handlers ...gin.HandlerFunc) {
 	if ep.DomainCreator == nil {
 		panic("domain creator needed for Create endpoint")
 	}
+	ep.checkHooks(ep)
 	ep.Endpoint.register(router, append(handlers, ep.Do)...)
 }
 
@@ -341,11 +483,18 @@ func (ep *Create) Creator(domainCreator DomainCreator) *Create {
 }
 
 func (ep *Create) Do(c *gin.Context) {
-	log.Logger.Debug("create " + ep.Module.Name)
+	log.Ctx(c).Debug("create " + ep.Module.Name)
 	if !ep.RightChecker(c, ep.Endpoint) {
 		ep.Fail(c, ep.Endpoint, errors.Unauthorized())
 		return
 	}
+	if ep.Idempotency != nil && c.GetHeader(IdempotencyKeyHeader) != "" {
+		key, claimed := ep.Idempotency.begin(c, ep.Endpoint)
+		if !claimed {
+			return
+		}
+		defer ep.Idempotency.end(c, key)
+	}
 	var err error
 
 	result := &communal.Result{
@@ -357,18 +506,33 @@ func (ep *Create) Do(c *gin.Context) {
 		return
 	}
 
+	if err = ep.hook(c, ep.Hooks.beforeBind, result.Data); err != nil {
+		ep.Fail(c, ep.Endpoint, err)
+		return
+	}
 	if err = ep.BindAndValidate(c, result.Data, ""); err != nil {
 		//log.Logger.Warn("failed to bind domain", zap.Any("error", err))
 		ep.Fail(c, ep.Endpoint, err)
 		return
 	}
+	if err = ep.hook(c, ep.Hooks.afterBind, result.Data); err != nil {
+		ep.Fail(c, ep.Endpoint, err)
+		return
+	}
+	if err = ep.hook(c, ep.Hooks.beforePersist, result.Data); err != nil {
+		ep.Fail(c, ep.Endpoint, err)
+		return
+	}
+	if err = ep.authorize(c, result.Data); err != nil {
+		ep.Fail(c, ep.Endpoint, err)
+		return
+	}
 
 	if ep.Module.RpcOn {
-		//if err = rpc.RPC.Call(context.Background(), ep.Module.Name, ep.RpcMethod, result.Data, result); err != nil {
-		//	//log.Logger.Error("failed to call rpc", zap.Any("error", err))
-		//	ep.Fail(c, ep.Endpoint, err)
-		//	return
-		//}
+		if err = rpc.Call(c, ep.Module.Name, ep.RpcMethod, result.Data, result); err != nil {
+			ep.Fail(c, ep.Endpoint, err)
+			return
+		}
 	} else {
 		_, err = ep.Module.Db.Insert(result.Data)
 		if err != nil {
@@ -379,6 +543,14 @@ func (ep *Create) Do(c *gin.Context) {
 	}
 
 	if result.Ok {
+		if err = ep.hook(c, ep.Hooks.afterPersist, result.Data); err != nil {
+			ep.Fail(c, ep.Endpoint, err)
+			return
+		}
+		if result.Data, err = ep.transform(c, result.Data); err != nil {
+			ep.Fail(c, ep.Endpoint, err)
+			return
+		}
 		result.Error = nil
 		ep.Success(c, ep.Endpoint, result)
 	} else {
@@ -395,6 +567,7 @@ func (ep *Update) Register(router gin.IRouter, handlers ...gin.HandlerFunc) {
 	if ep.DomainCreator == nil {
 		panic("domain creator needed for Update endpoint")
 	}
+	ep.checkHooks(ep)
 	ep.Endpoint.register(router, append(handlers, ep.Do)...)
 }
 
@@ -404,7 +577,7 @@ func (ep *Update) Creator(domainCreator IdDomainCreator) *Update {
 }
 
 func (ep *Update) Do(c *gin.Context) {
-	log.Logger.Debug("update " + ep.Module.Name)
+	log.Ctx(c).Debug("update " + ep.Module.Name)
 	if !ep.RightChecker(c, ep.Endpoint) {
 		ep.Fail(c, ep.Endpoint, errors.Unauthorized())
 		return
@@ -420,28 +593,184 @@ func (ep *Update) Do(c *gin.Context) {
 		return
 	}
 
+	if err = ep.hook(c, ep.Hooks.beforeBind, dm); err != nil {
+		ep.Fail(c, ep.Endpoint, err)
+		return
+	}
 	if err = ep.BindAndValidate(c, dm, ""); err != nil {
 		//log.Logger.Warn("failed to bind domain", zap.Any("error", err))
 		ep.Fail(c, ep.Endpoint, err)
 		return
 	}
+	if err = ep.hook(c, ep.Hooks.afterBind, dm); err != nil {
+		ep.Fail(c, ep.Endpoint, err)
+		return
+	}
+
+	// the domain written is checked too, not to hand it over to other users
+	persist := func() error {
+		if err := ep.hook(c, ep.Hooks.beforePersist, dm); err != nil {
+			return err
+		}
+		return ep.authorize(c, dm)
+	}
+	if ep.Module.RpcOn {
+		if _, err = ep.guard(c, dm.GetId(), idCreator(ep.DomainCreator)); err == nil {
+			err = persist()
+		}
+		if err != nil {
+			ep.Fail(c, ep.Endpoint, err)
+			return
+		}
+		if err = rpc.Call(c, ep.Module.Name, ep.RpcMethod, dm, result); err != nil {
+			ep.Fail(c, ep.Endpoint, err)
+			return
+		}
+	} else {
+		err = ep.write(c, communal.HistoryUpdate, dm.GetId(), idCreator(ep.DomainCreator), persist, func(ss *xorm.Session) error {
+			return ep.Module.Write(ss, dm)
+		})
+		if err != nil {
+			ep.Fail(c, ep.Endpoint, err)
+			return
+		}
+		result.Ok = true
+	}
+
+	if result.Ok {
+		if err = ep.hook(c, ep.Hooks.afterPersist, dm); err != nil {
+			ep.Fail(c, ep.Endpoint, err)
+			return
+		}
+		if result.Data, err = ep.transform(c, result.Data); err != nil {
+			ep.Fail(c, ep.Endpoint, err)
+			return
+		}
+		result.Error = nil
+		ep.Success(c, ep.Endpoint, result)
+	} else {
+		ep.Fail(c, ep.Endpoint, result.Error)
+	}
+}
+
+// Patch updates exactly the columns present in a JSON merge patch (RFC 7386) body
+type Patch struct {
+	DomainCreator IdDomainCreator
+	*Endpoint
+}
+
+func (ep *Patch) Register(router gin.IRouter, handlers ...gin.HandlerFunc) {
+	if ep.DomainCreator == nil {
+		panic("domain creator needed for Patch endpoint")
+	}
+	ep.checkHooks(ep)
+	ep.Endpoint.register(router, append(handlers, ep.Do)...)
+}
+
+func (ep *Patch) Creator(domainCreator IdDomainCreator) *Patch {
+	ep.DomainCreator = domainCreator
+	return ep
+}
+
+func (ep *Patch) Do(c *gin.Context) {
+	log.Ctx(c).Debug("patch " + ep.Module.Name)
+	if !ep.RightChecker(c, ep.Endpoint) {
+		ep.Fail(c, ep.Endpoint, errors.Unauthorized())
+		return
+	}
+	var err error
+	var id int64
+
+	if id, err = ep.validateId(c); err != nil {
+		ep.Fail(c, ep.Endpoint, err)
+		return
+	}
+
+	patch, err := c.GetRawData()
+	if err != nil {
+		ep.Fail(c, ep.Endpoint, errors.InvalidParams())
+		return
+	}
+	if _, err = communal.PatchKeys(patch); err != nil {
+		ep.Fail(c, ep.Endpoint, err)
+		return
+	}
+
+	result := &communal.Result{
+		Error: &errors.SimpleBizError{},
+	}
+	current, err := ep.DomainCreator(c)
+	if err != nil {
+		ep.Fail(c, ep.Endpoint, err)
+		return
+	}
 
 	if ep.Module.RpcOn {
-		//if err = rpc.RPC.Call(context.Background(), ep.Module.Name, ep.RpcMethod, dm, result); err != nil {
-		//	//log.Logger.Error("failed to call rpc", zap.Any("error", err))
-		//	ep.Fail(c, ep.Endpoint, err)
-		//	return
-		//}
+		var loaded interface{}
+		loaded, err = ep.guard(c, id, idCreator(ep.DomainCreator))
+		if err == nil && loaded != nil && len(ep.Policies) > 0 {
+			// the patch is merged here too, to check the domain written
+			var dm communal.IdInf
+			if dm, err = ep.DomainCreator(c); err == nil {
+				if err = communal.MergeDomain(loaded, patch, dm); err == nil {
+					err = ep.authorize(c, dm)
+				}
+			}
+		}
+		if err != nil {
+			ep.Fail(c, ep.Endpoint, err)
+			return
+		}
+		result.Data = current
+		if err = rpc.Call(c, ep.Module.Name, ep.RpcMethod, &rpc.PatchArgs{Id: id, Patch: patch}, result); err != nil {
+			ep.Fail(c, ep.Endpoint, err)
+			return
+		}
 	} else {
-		_, err = ep.Module.Db.ID(dm.GetId()).Update(dm)
+		// the current domain is locked from the If-Match check to the update
+		var dm communal.IdInf
+		dm, err = ep.Module.Patch(c, id, patch, func() (communal.IdInf, error) {
+			return ep.DomainCreator(c)
+		}, communal.PatchChecks{
+			Loaded: func(current communal.IdInf) error {
+				if err := ep.checkETag(c.GetHeader("If-Match"), current); err != nil {
+					return err
+				}
+				if err := ep.authorize(c, current); err != nil {
+					return err
+				}
+				return ep.hook(c, ep.Hooks.beforeBind, current)
+			},
+			Merged: func(dm communal.IdInf) error {
+				if err := ep.hook(c, ep.Hooks.afterBind, dm); err != nil {
+					return err
+				}
+				if err := ep.hook(c, ep.Hooks.beforePersist, dm); err != nil {
+					return err
+				}
+				return ep.authorize(c, dm)
+			},
+		})
 		if err != nil {
 			ep.Fail(c, ep.Endpoint, err)
 			return
 		}
 		result.Ok = true
+		result.Data = dm
 	}
 
 	if result.Ok {
+		if err = ep.hook(c, ep.Hooks.afterPersist, result.Data); err != nil {
+			ep.Fail(c, ep.Endpoint, err)
+			return
+		}
+		if ep.ETag != nil && result.Data != nil {
+			c.Header("ETag", `"`+ep.ETag(result.Data)+`"`)
+		}
+		if result.Data, err = ep.transform(c, result.Data); err != nil {
+			ep.Fail(c, ep.Endpoint, err)
+			return
+		}
 		result.Error = nil
 		ep.Success(c, ep.Endpoint, result)
 	} else {
@@ -459,6 +788,8 @@ func (ep *List) Register(router gin.IRouter, handlers ...gin.HandlerFunc) {
 	if ep.FilterCreator == nil {
 		panic("domain creator needed for List endpoint")
 	}
+	ep.checkScoped()
+	ep.checkHooks(ep)
 	ep.Endpoint.register(router, append(handlers, ep.Do)...)
 }
 
@@ -469,7 +800,7 @@ func (ep *List) Creator(filterCreator FilterCreator, arrayCreator DomainCreator)
 }
 
 func (ep *List) Do(c *gin.Context) {
-	log.Logger.Debug("list " + ep.Module.Name)
+	log.Ctx(c).Debug("list " + ep.Module.Name)
 	if !ep.RightChecker(c, ep.Endpoint) {
 		ep.Fail(c, ep.Endpoint, errors.Unauthorized())
 		return
@@ -481,10 +812,18 @@ func (ep *List) Do(c *gin.Context) {
 		return
 	}
 
+	if err = ep.hook(c, ep.Hooks.beforeBind, filter); err != nil {
+		ep.Fail(c, ep.Endpoint, err)
+		return
+	}
 	if err = ep.Bind(c, filter); err != nil {
 		ep.Fail(c, ep.Endpoint, err)
 		return
 	}
+	if err = ep.hook(c, ep.Hooks.afterBind, filter); err != nil {
+		ep.Fail(c, ep.Endpoint, err)
+		return
+	}
 
 	var result = &communal.FilterResult{
 		Page: &communal.Page{},
@@ -500,10 +839,10 @@ func (ep *List) Do(c *gin.Context) {
 	result.Data = arr
 
 	if ep.Module.RpcOn {
-		//if err = rpc.RPC.Call(context.Background(), ep.Module.Name, ep.RpcMethod, filter, result); err != nil {
-		//	ep.Fail(c, ep.Endpoint, err)
-		//	return
-		//}
+		if err = rpc.Call(c, ep.Module.Name, ep.RpcMethod, filter, result); err != nil {
+			ep.Fail(c, ep.Endpoint, err)
+			return
+		}
 	} else {
 		sess := ep.Module.Db.NewSession()
 		filter.Apply(sess)
@@ -513,12 +852,102 @@ func (ep *List) Do(c *gin.Context) {
 			ep.Fail(c, ep.Endpoint, err)
 			return
 		}
+		if err = ep.Module.Expand(c, arr, ep.expand(c)...); err != nil {
+			ep.Fail(c, ep.Endpoint, err)
+			return
+		}
 		result.Page = filter.GetPage()
 		result.Page.Cnt = int64(count)
 		result.Ok = true
 	}
 
 	if result.Ok {
+		if result.Data, err = ep.transform(c, result.Data); err != nil {
+			ep.Fail(c, ep.Endpoint, err)
+			return
+		}
+		result.Error = nil
+		ep.Success(c, ep.Endpoint, result)
+	} else {
+		ep.Fail(c, ep.Endpoint, result.Error)
+	}
+}
+
+// Stats answers aggregates of the rows matched by the filter, query params:
+// agg=count,sum:amount group=status bucket=day|week|month
+type Stats struct {
+	FilterCreator FilterCreator
+	*Endpoint
+}
+
+func (ep *Stats) Register(router gin.IRouter, handlers ...gin.HandlerFunc) {
+	if ep.FilterCreator == nil {
+		panic("filter creator needed for Stats endpoint")
+	}
+	ep.checkScoped()
+	ep.checkHooks(ep)
+	ep.Endpoint.register(router, append(handlers, ep.Do)...)
+}
+
+func (ep *Stats) Creator(filterCreator FilterCreator) *Stats {
+	ep.FilterCreator = filterCreator
+	return ep
+}
+
+func (ep *Stats) Do(c *gin.Context) {
+	log.Ctx(c).Debug("stats " + ep.Module.Name)
+	if !ep.RightChecker(c, ep.Endpoint) {
+		ep.Fail(c, ep.Endpoint, errors.Unauthorized())
+		return
+	}
+
+	filter, err := ep.FilterCreator(c)
+	if err != nil {
+		ep.Fail(c, ep.Endpoint, err)
+		return
+	}
+
+	if err = ep.hook(c, ep.Hooks.beforeBind, filter); err != nil {
+		ep.Fail(c, ep.Endpoint, err)
+		return
+	}
+	if err = ep.Bind(c, filter); err != nil {
+		ep.Fail(c, ep.Endpoint, err)
+		return
+	}
+	if err = ep.hook(c, ep.Hooks.afterBind, filter); err != nil {
+		ep.Fail(c, ep.Endpoint, err)
+		return
+	}
+
+	query := &communal.StatsQuery{
+		Aggregates: communal.ParseAggregates(c.Query("agg")),
+		Bucket:     c.Query("bucket"),
+	}
+	for _, col := range strings.Split(c.Query("group"), ",") {
+		if col = strings.TrimSpace(col); col != "" {
+			query.GroupBy = append(query.GroupBy, col)
+		}
+	}
+
+	var result = &communal.Result{
+		Error: &errors.SimpleBizError{},
+	}
+	if ep.Module.RpcOn {
+		if err = rpc.Call(c, ep.Module.Name, ep.RpcMethod, &rpc.StatsArgs{Filter: filter, Query: query}, result); err != nil {
+			ep.Fail(c, ep.Endpoint, err)
+			return
+		}
+	} else if err = ep.Module.Aggregate(c, filter, query, result); err != nil {
+		ep.Fail(c, ep.Endpoint, err)
+		return
+	}
+
+	if result.Ok {
+		if result.Data, err = ep.transform(c, result.Data); err != nil {
+			ep.Fail(c, ep.Endpoint, err)
+			return
+		}
 		result.Error = nil
 		ep.Success(c, ep.Endpoint, result)
 	} else {
@@ -528,14 +957,28 @@ func (ep *List) Do(c *gin.Context) {
 
 type Delete struct {
 	*Endpoint
+	// DomainCreator is only needed to check If-Match of conditional deletes
+	DomainCreator DomainCreator
 }
 
 func (ep *Delete) Register(router gin.IRouter, handlers ...gin.HandlerFunc) {
+	if ep.ETag != nil && ep.DomainCreator == nil {
+		panic("domain creator needed for conditional Delete endpoint")
+	}
+	if len(ep.Policies) > 0 && ep.DomainCreator == nil {
+		panic("domain creator needed for Delete endpoint with policies")
+	}
+	ep.checkHooks(ep)
 	ep.Endpoint.register(router, append(handlers, ep.Do)...)
 }
 
+func (ep *Delete) Creator(domainCreator DomainCreator) *Delete {
+	ep.DomainCreator = domainCreator
+	return ep
+}
+
 func (ep *Delete) Do(c *gin.Context) {
-	log.Logger.Debug("logically delete " + ep.Module.Name)
+	log.Ctx(c).Debug("logically delete " + ep.Module.Name)
 	if !ep.RightChecker(c, ep.Endpoint) {
 		ep.Fail(c, ep.Endpoint, errors.Unauthorized())
 		return
@@ -548,18 +991,30 @@ func (ep *Delete) Do(c *gin.Context) {
 		return
 	}
 
+	persist := func() error {
+		return ep.hook(c, ep.Hooks.beforePersist, id)
+	}
 	var result = &communal.Result{
 		Error: &errors.SimpleBizError{},
 	}
 	if ep.Module.RpcOn {
-		//if err = rpc.RPC.Call(context.Background(), ep.Module.Name, ep.RpcMethod, &id, result); err != nil {
-		//	//log.Logger.Error("failed to call rpc", zap.Any("error", err))
-		//	ep.Fail(c, ep.Endpoint, err)
-		//	return
-		//}
+		if _, err = ep.guard(c, id, ep.DomainCreator); err == nil {
+			err = persist()
+		}
+		if err != nil {
+			ep.Fail(c, ep.Endpoint, err)
+			return
+		}
+		if err = rpc.Call(c, ep.Module.Name, ep.RpcMethod, id, result); err != nil {
+			ep.Fail(c, ep.Endpoint, err)
+			return
+		}
 	} else {
-		log.Logger.Debug("delete "+ep.Module.Name+" with id ", zap.Int64("", id))
-		_, err = ep.Module.Db.Exec("update "+ep.Module.TableName+" set status = 0 where id = ?", id)
+		log.Ctx(c).Debug("delete "+ep.Module.Name+" with id ", zap.Int64("", id))
+		err = ep.write(c, communal.HistoryDelete, id, ep.DomainCreator, persist, func(ss *xorm.Session) error {
+			_, err := ss.Exec("update "+ep.Module.TableName+" set status = 0, lut = ? where id = ?", time.Now().Truncate(time.Second), id)
+			return err
+		})
 		if err != nil {
 			ep.Fail(c, ep.Endpoint, err)
 			return
@@ -568,6 +1023,14 @@ func (ep *Delete) Do(c *gin.Context) {
 	}
 
 	if result.Ok {
+		if err = ep.hook(c, ep.Hooks.afterPersist, id); err != nil {
+			ep.Fail(c, ep.Endpoint, err)
+			return
+		}
+		if result.Data, err = ep.transform(c, result.Data); err != nil {
+			ep.Fail(c, ep.Endpoint, err)
+			return
+		}
 		result.Error = nil
 		ep.Success(c, ep.Endpoint, result)
 	} else {
@@ -586,6 +1049,8 @@ type CrudDomainFactory interface {
 const (
 	END_POINT_TYPE_HTML EndpointType = iota
 	END_POINT_TYPE_API
+	// END_POINT_TYPE_NEGOTIATED serves html or json as asked for by the request
+	END_POINT_TYPE_NEGOTIATED
 )
 
 type EndpointBuilder struct {
@@ -617,6 +1082,14 @@ func (builder *EndpointBuilder) Crud(creator CrudDomainFactory) *EndpointBuilder
 	return builder
 }
 
+// CrudWithPatch is Crud with a Patch endpoint, checked with the update right like
+// Update, for apps whose updates may be partial
+func (builder *EndpointBuilder) CrudWithPatch(creator CrudDomainFactory) *EndpointBuilder {
+	builder.Crud(creator)
+	builder.NewPatch().Creator(creator.Update)
+	return builder
+}
+
 func (builder *EndpointBuilder) RpcOn() *EndpointBuilder {
 	builder.Module.RpcOn = true
 	return builder
@@ -753,6 +1226,45 @@ func (builder *EndpointBuilder) NewUpdate(endpointName ...string) *Update {
 	return ep
 }
 
+func (builder *EndpointBuilder) NewPatch(endpointName ...string) *Patch {
+	name := "Patch"
+	if len(endpointName) > 0 {
+		name = endpointName[0]
+	}
+
+	var ep = &Patch{
+		Endpoint: &Endpoint{
+			Module:     builder.Module,
+			HttpMethod: "Patch",
+			RpcMethod:  "Patch",
+			RouterPath: "/:id",
+			RightKey:   "update",
+		},
+	}
+	builder.endPoints[name] = IEndPoint(ep)
+	return ep
+}
+
+func (builder *EndpointBuilder) NewStats(endpointName ...string) *Stats {
+	name := "Stats"
+	if len(endpointName) > 0 {
+		name = endpointName[0]
+	}
+
+	var ep = &Stats{
+		Endpoint: &Endpoint{
+			Module:     builder.Module,
+			HttpMethod: "Get",
+			RpcMethod:  "Stats",
+			RouterPath: "/stats",
+			RightKey:   "stats",
+		},
+	}
+	ep.page = util.LowerFirst(builder.Module.Name) + "Stats.html"
+	builder.endPoints[name] = IEndPoint(ep)
+	return ep
+}
+
 func (builder *EndpointBuilder) NewDelete(endpointName ...string) *Delete {
 	name := "Delete"
 	if len(endpointName) > 0 {
@@ -772,7 +1284,13 @@ func (builder *EndpointBuilder) NewDelete(endpointName ...string) *Delete {
 	return ep
 }
 
+// Endpoints of the builder by name
+func (builder *EndpointBuilder) Endpoints() map[string]IEndPoint {
+	return builder.endPoints
+}
+
 func (builder *EndpointBuilder) RegisterAll(router gin.IRouter, handlers ...gin.HandlerFunc) {
+	trackBuilder(builder)
 	for _, ep := range builder.endPoints {
 		ep.Register(router, handlers...)
 	}
@@ -0,0 +1,60 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sdjnlh/communal"
+	"github.com/sdjnlh/communal/errors"
+	"github.com/sdjnlh/communal/log"
+	"github.com/sdjnlh/communal/rpc"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+type article struct {
+	communal.ID `xorm:"extends"`
+	Title       string `json:"title"`
+}
+
+func TestRpcOnEndpoints(t *testing.T) {
+	log.Logger.Logger = zap.NewNop()
+	gin.SetMode(gin.TestMode)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/article/Get":
+			var id int64
+			_ = json.NewDecoder(r.Body).Decode(&id)
+			a := &article{Title: "remote"}
+			a.Id = id
+			_ = json.NewEncoder(w).Encode(&communal.Result{Ok: true, Data: a})
+		case "/article/Delete":
+			_ = json.NewEncoder(w).Encode(&communal.Result{Error: errors.InvalidParams().AddError(errors.InvalidField("id", "locked", ""))})
+		}
+	}))
+	defer server.Close()
+	rpc.SetClient(rpc.NewHttpClient(rpc.Config{Services: map[string]rpc.ServiceConfig{"article": {Url: server.URL}}}))
+	defer rpc.SetClient(rpc.NewHttpClient(rpc.Config{}))
+
+	builder := NewEndpointBuilder("article", "article", "/articles").RpcOn()
+	builder.NewGet().Creator(func(c *gin.Context) (interface{}, error) { return &article{}, nil })
+	builder.NewDelete()
+	builder.Api().AlwaysPassRightCheck()
+	router := gin.New()
+	builder.RegisterAll(router)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/articles/7", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"title":"remote"`)
+	assert.Contains(t, w.Body.String(), `"id":"7"`)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/articles/7", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), `"code":"locked","name":"id"`)
+}
@@ -0,0 +1,154 @@
+package web
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sdjnlh/communal"
+	"github.com/sdjnlh/communal/errors"
+	"github.com/sdjnlh/communal/rpc"
+)
+
+// ETagFunc answers the strong entity tag of a domain, without the quotes
+type ETagFunc func(domain interface{}) string
+
+// VersionETag tags a domain by its id and Lut, set to the second by every write of
+// the module, domains without a Lut are tagged by HashETag.
+func VersionETag(domain interface{}) string {
+	idm, ok := domain.(communal.IdInf)
+	if !ok {
+		return HashETag(domain)
+	}
+	v := reflect.Indirect(reflect.ValueOf(domain))
+	if v.Kind() != reflect.Struct {
+		return HashETag(domain)
+	}
+	field := v.FieldByName("Lut")
+	if !field.IsValid() {
+		return HashETag(domain)
+	}
+	lut, ok := field.Interface().(time.Time)
+	if !ok || lut.IsZero() {
+		return HashETag(domain)
+	}
+	return strconv.FormatInt(idm.GetId(), 36) + "-" + strconv.FormatInt(lut.UnixNano(), 36)
+}
+
+// HashETag tags a domain by the hash of its JSON
+func HashETag(domain interface{}) string {
+	data, _ := json.Marshal(domain)
+	sum := sha1.Sum(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// matchETag tells whether header, a list of entity tags or *, matches tag. The weak
+// comparison of If-None-Match ignores the W/ prefix, which never matches strongly.
+func matchETag(header string, tag string, weak bool) bool {
+	for _, item := range strings.Split(header, ",") {
+		item = strings.TrimSpace(item)
+		if item == "*" {
+			return true
+		}
+		if strings.HasPrefix(item, "W/") {
+			if !weak {
+				continue
+			}
+			item = item[2:]
+		}
+		if item == `"`+tag+`"` {
+			return true
+		}
+	}
+	return false
+}
+
+// Conditional makes the endpoint answer conditional requests, tagging domains with
+// etag or VersionETag by default.
+func (ep *Endpoint) Conditional(etag ...ETagFunc) *Endpoint {
+	ep.ETag = VersionETag
+	if len(etag) > 0 && etag[0] != nil {
+		ep.ETag = etag[0]
+	}
+	return ep
+}
+
+// notModified sets the ETag of domain and answers 304 when it matches If-None-Match
+func (ep *Endpoint) notModified(c *gin.Context, domain interface{}) bool {
+	if ep.ETag == nil {
+		return false
+	}
+	tag := ep.ETag(domain)
+	c.Header("ETag", `"`+tag+`"`)
+	if header := c.GetHeader("If-None-Match"); header != "" && matchETag(header, tag, true) {
+		c.AbortWithStatus(http.StatusNotModified)
+		return true
+	}
+	return false
+}
+
+// load answers the current domain of id, created with create
+func (ep *Endpoint) load(c *gin.Context, id int64, create DomainCreator) (interface{}, error) {
+	current, err := create(c)
+	if err != nil {
+		return nil, err
+	}
+	if ep.Module.RpcOn {
+		result := &communal.Result{Error: &errors.SimpleBizError{}, Data: current}
+		if err = rpc.Call(c, ep.Module.Name, "Get", id, result); err != nil {
+			return nil, err
+		}
+		if !result.Ok {
+			return nil, result.Error
+		}
+	} else {
+		has, err := ep.Module.Load(c, id, current)
+		if err != nil {
+			return nil, err
+		}
+		if !has {
+			return nil, errors.NotFound()
+		}
+	}
+	return current, nil
+}
+
+func (ep *Endpoint) checkETag(header string, current interface{}) error {
+	if ep.ETag == nil || header == "" || matchETag(header, ep.ETag(current), false) {
+		return nil
+	}
+	return errors.PreconditionFailed()
+}
+
+// Conditional makes Get answer If-None-Match with 304, and Update, Patch and Delete
+// check If-Match, answering 412 when the entity has changed. The entity is locked from
+// the check to the write, but for rpc modules. Delete loads the entity with the creator
+// of Get unless it has its own.
+func (builder *EndpointBuilder) Conditional(etag ...ETagFunc) *EndpointBuilder {
+	var get *Get
+	for _, iep := range builder.endPoints {
+		switch ep := iep.(type) {
+		case *Get:
+			get = ep
+			ep.Conditional(etag...)
+		case *Update:
+			ep.Conditional(etag...)
+		case *Patch:
+			ep.Conditional(etag...)
+		case *Delete:
+			ep.Conditional(etag...)
+		}
+	}
+	for _, iep := range builder.endPoints {
+		if ep, ok := iep.(*Delete); ok && ep.DomainCreator == nil && get != nil {
+			ep.DomainCreator = get.DomainCreator
+		}
+	}
+	return builder
+}
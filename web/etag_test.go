@@ -0,0 +1,183 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sdjnlh/communal"
+	"github.com/sdjnlh/communal/internal/dbtest"
+	"github.com/sdjnlh/communal/log"
+	"github.com/sdjnlh/communal/rpc"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"xorm.io/xorm"
+)
+
+type post struct {
+	communal.DBase `xorm:"extends"`
+	Title          string `json:"title" valid:"required"`
+}
+
+func TestVersionETag(t *testing.T) {
+	p := &post{Title: "a"}
+	p.Id = 1
+	assert.Equal(t, HashETag(p), VersionETag(p), "hash when lut is not set")
+
+	p.Lut = time.Unix(0, 36)
+	assert.Equal(t, "1-10", VersionETag(p))
+	assert.Equal(t, HashETag(&article{}), VersionETag(&article{}))
+
+	assert.True(t, matchETag(`"x", W/"1-10"`, "1-10", true))
+	assert.False(t, matchETag(`W/"1-10"`, "1-10", false))
+	assert.True(t, matchETag(`*`, "1-10", false))
+	assert.False(t, matchETag(`"1-11"`, "1-10", false))
+}
+
+func TestConditional(t *testing.T) {
+	log.Logger.Logger = zap.NewNop()
+	gin.SetMode(gin.TestMode)
+
+	lut := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	var calls []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, r.URL.Path)
+		p := &post{Title: "remote"}
+		p.Id, p.Lut = 7, lut
+		_ = json.NewEncoder(w).Encode(&communal.Result{Ok: true, Data: p})
+	}))
+	defer server.Close()
+	rpc.SetClient(rpc.NewHttpClient(rpc.Config{Services: map[string]rpc.ServiceConfig{"post": {Url: server.URL}}}))
+	defer rpc.SetClient(rpc.NewHttpClient(rpc.Config{}))
+
+	builder := NewEndpointBuilder("post", "post", "/posts").RpcOn()
+	builder.NewGet().Creator(func(c *gin.Context) (interface{}, error) { return &post{}, nil })
+	builder.NewUpdate().Creator(func(c *gin.Context) (communal.IdInf, error) { return &post{}, nil })
+	builder.NewDelete()
+	builder.Api().AlwaysPassRightCheck().Conditional()
+	router := gin.New()
+	builder.RegisterAll(router)
+
+	serve := func(method string, header string, value string, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, "/posts/7", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if header != "" {
+			req.Header.Set(header, value)
+		}
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := serve(http.MethodGet, "", "", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	tag := w.Header().Get("ETag")
+	assert.Equal(t, `"`+VersionETag(&post{DBase: communal.DBase{ID: communal.ID{Id: 7}, Lut: lut}})+`"`, tag)
+
+	w = serve(http.MethodGet, "If-None-Match", tag, "")
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Empty(t, w.Body.String())
+
+	calls = nil
+	w = serve(http.MethodPut, "If-Match", `"stale"`, `{"id":"7","title":"new"}`)
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+	assert.Contains(t, w.Body.String(), `"code":"c.PRECONDITION_FAILED"`)
+	assert.Equal(t, []string{"/post/Get"}, calls)
+
+	calls = nil
+	w = serve(http.MethodPut, "If-Match", tag, `{"id":"7","title":"new"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []string{"/post/Get", "/post/Update"}, calls)
+
+	calls = nil
+	w = serve(http.MethodPut, "", "", `{"id":"7","title":"new"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []string{"/post/Update"}, calls, "unconditional requests are not checked")
+
+	w = serve(http.MethodDelete, "If-Match", `"stale"`, "")
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+}
+
+func TestConditional_Db(t *testing.T) {
+	log.Logger.Logger = zap.NewNop()
+	gin.SetMode(gin.TestMode)
+
+	engine, db := dbtest.Open()
+	lut := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	db.Rows("FOR UPDATE", []string{"id", "title", "lut"}, []interface{}{int64(7), "old", lut})
+	builder := NewEndpointBuilder("post", "post", "/posts")
+	builder.Module.SetDB(engine)
+	builder.NewUpdate().Creator(func(c *gin.Context) (communal.IdInf, error) { return &post{}, nil })
+	builder.NewPatch().Creator(func(c *gin.Context) (communal.IdInf, error) { return &post{}, nil })
+	builder.Api().AlwaysPassRightCheck().Conditional()
+	router := gin.New()
+	builder.RegisterAll(router)
+
+	serve := func(method string, tag string, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, "/posts/7", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("If-Match", tag)
+		router.ServeHTTP(w, req)
+		return w
+	}
+	tag := `"` + VersionETag(&post{DBase: communal.DBase{ID: communal.ID{Id: 7}, Lut: lut}}) + `"`
+
+	w := serve(http.MethodPut, `"stale"`, `{"id":"7","title":"new"}`)
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+	assert.Empty(t, db.Find("UPDATE `post`"), "stale writes are refused")
+	assert.Len(t, db.Find("FOR UPDATE"), 1, "the current row is locked")
+
+	w = serve(http.MethodPut, tag, `{"id":"7","title":"new","lut":"2020-01-01T00:00:00Z"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	updates := db.Find("UPDATE `post`")
+	assert.Len(t, updates, 1)
+	assert.Contains(t, updates[0].SQL, "`lut` = ?")
+	assert.NotContains(t, updates[0].Args, lut, "lut is set by the server")
+
+	w = serve(http.MethodPatch, tag, `{"title":"newer"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotEqual(t, tag, w.Header().Get("ETag"))
+	updates = db.Find("UPDATE `post`")
+	assert.Len(t, updates, 2)
+	assert.Contains(t, updates[1].SQL, "`lut` = ?")
+
+	w = serve(http.MethodPatch, `"stale"`, `{"title":"newer"}`)
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+	assert.Len(t, db.Find("UPDATE `post`"), 2)
+}
+
+func TestGet_Db(t *testing.T) {
+	log.Logger.Logger = zap.NewNop()
+	gin.SetMode(gin.TestMode)
+
+	serve := func(engine *xorm.Engine) *httptest.ResponseRecorder {
+		builder := NewEndpointBuilder("post", "post", "/posts")
+		builder.Module.SetDB(engine)
+		builder.NewGet().Creator(func(c *gin.Context) (interface{}, error) { return &post{}, nil })
+		builder.Api().AlwaysPassRightCheck().Conditional()
+		router := gin.New()
+		builder.RegisterAll(router)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/posts/7", nil))
+		return w
+	}
+
+	engine, db := dbtest.Open()
+	w := serve(engine)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Empty(t, w.Header().Get("ETag"))
+	if selects := db.Find("SELECT"); assert.Len(t, selects, 1) {
+		assert.Contains(t, selects[0].SQL, "`post`")
+	}
+
+	engine, db = dbtest.Open()
+	db.Rows("SELECT", []string{"id", "title"}, []interface{}{int64(7), "old"})
+	w = serve(engine)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotEmpty(t, w.Header().Get("ETag"))
+}
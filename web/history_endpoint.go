@@ -0,0 +1,145 @@
+package web
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sdjnlh/communal"
+	"github.com/sdjnlh/communal/errors"
+	"github.com/sdjnlh/communal/log"
+	"github.com/sdjnlh/communal/rpc"
+)
+
+// History lists the recorded changes of an entity, paged by the p and ps query params.
+// With the at query param (RFC 3339) and a DomainCreator, the entity as it was at
+// that time is answered instead. Policies are checked on the current entity.
+type History struct {
+	DomainCreator DomainCreator
+	*Endpoint
+}
+
+func (ep *History) Register(router gin.IRouter, handlers ...gin.HandlerFunc) {
+	if ep.Module.HistoryTable == "" {
+		panic("history is not tracked for module " + ep.Module.Name)
+	}
+	if len(ep.Policies) > 0 && ep.DomainCreator == nil {
+		panic("domain creator needed for History endpoint with policies")
+	}
+	ep.checkHooks(ep)
+	ep.Endpoint.register(router, append(handlers, ep.Do)...)
+}
+
+func (ep *History) Creator(domainCreator DomainCreator) *History {
+	ep.DomainCreator = domainCreator
+	return ep
+}
+
+func (ep *History) Do(c *gin.Context) {
+	log.Ctx(c).Debug("history " + ep.Module.Name)
+	if !ep.RightChecker(c, ep.Endpoint) {
+		ep.Fail(c, ep.Endpoint, errors.Unauthorized())
+		return
+	}
+
+	id, err := ep.validateId(c)
+	if err != nil {
+		ep.Fail(c, ep.Endpoint, err)
+		return
+	}
+	if len(ep.Policies) > 0 {
+		var current interface{}
+		if current, err = ep.load(c, id, ep.DomainCreator); err == nil {
+			err = ep.authorize(c, current)
+		}
+		if err != nil {
+			ep.Fail(c, ep.Endpoint, err)
+			return
+		}
+	}
+
+	if at := c.Query("at"); at != "" && ep.DomainCreator != nil {
+		ep.asOf(c, id, at)
+		return
+	}
+
+	page := &communal.Page{}
+	if err = ep.Bind(c, page); err != nil {
+		ep.Fail(c, ep.Endpoint, err)
+		return
+	}
+
+	result := communal.NewFilterResult(nil)
+	if ep.Module.RpcOn {
+		if err = rpc.Call(c, ep.Module.Name, ep.RpcMethod, &rpc.HistoryArgs{Id: id, Page: page}, result); err != nil {
+			ep.Fail(c, ep.Endpoint, err)
+			return
+		}
+	} else if err = ep.Module.Histories(c, id, page, result); err != nil {
+		ep.Fail(c, ep.Endpoint, err)
+		return
+	}
+
+	if result.Ok {
+		if result.Data, err = ep.transform(c, result.Data); err != nil {
+			ep.Fail(c, ep.Endpoint, err)
+			return
+		}
+		result.Error = nil
+		ep.Success(c, ep.Endpoint, result)
+	} else {
+		ep.Fail(c, ep.Endpoint, result.Error)
+	}
+}
+
+func (ep *History) asOf(c *gin.Context, id int64, at string) {
+	t, err := time.Parse(time.RFC3339, at)
+	if err != nil {
+		ep.Fail(c, ep.Endpoint, errors.InvalidParams().AddError(errors.InvalidField("at", errors.FIELD_BAD_FORMAT, "at should be a RFC 3339 time")))
+		return
+	}
+
+	if ep.Module.RpcOn {
+		ep.Fail(c, ep.Endpoint, errors.RPCFailedWithMsg("history at a time is not available for rpc modules"))
+		return
+	}
+	domain, err := ep.DomainCreator(c)
+	if err != nil {
+		ep.Fail(c, ep.Endpoint, err)
+		return
+	}
+
+	found, err := ep.Module.AsOf(c, id, t, domain)
+	if err != nil {
+		ep.Fail(c, ep.Endpoint, err)
+		return
+	}
+	if !found {
+		ep.Fail(c, ep.Endpoint, errors.NotFound())
+		return
+	}
+	data, err := ep.transform(c, domain)
+	if err != nil {
+		ep.Fail(c, ep.Endpoint, err)
+		return
+	}
+	ep.Success(c, ep.Endpoint, &communal.Result{Ok: true, Data: data})
+}
+
+func (builder *EndpointBuilder) NewHistory(endpointName ...string) *History {
+	name := "History"
+	if len(endpointName) > 0 {
+		name = endpointName[0]
+	}
+
+	var ep = &History{
+		Endpoint: &Endpoint{
+			Module:     builder.Module,
+			HttpMethod: "Get",
+			RpcMethod:  "History",
+			RouterPath: "/:id/history",
+			RightKey:   "history",
+		},
+	}
+	builder.endPoints[name] = IEndPoint(ep)
+	return ep
+}
@@ -0,0 +1,192 @@
+package web
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+// Hook runs at a point of the requests to an endpoint, on the domain of the request.
+// Hooks may change the domain, an error stops the request and is answered instead.
+type Hook func(c *gin.Context, ep *Endpoint, domain interface{}) error
+
+// Transform replaces the data answered by an endpoint
+type Transform func(c *gin.Context, ep *Endpoint, data interface{}) (interface{}, error)
+
+// Hooks of an endpoint, run in the order they are added:
+//
+//	Create, Update: BeforeBind and AfterBind around binding and validating the domain,
+//	                BeforePersist and AfterPersist around saving it
+//	Patch:          BeforeBind on the current domain and AfterBind on the domain the
+//	                patch is merged into, BeforePersist and AfterPersist around saving
+//	                it, the columns BeforePersist changes are written along the patched
+//	                ones. Patches of rpc modules are merged by the service, only their
+//	                AfterPersist hooks run, on the domain answered.
+//	Get:            BeforeBind and AfterBind around loading the domain
+//	List, Stats:    BeforeBind and AfterBind around binding the filter
+//	Export:         BeforeBind and AfterBind around binding the filter, no transform
+//	History:        transforms only
+//	Delete:         BeforePersist and AfterPersist around deleting, on the id
+//	Import:         all of them on every row, AfterPersist once its batch is saved, no
+//	                transform
+//
+// Transforms apply to the data answered. The hooks of the builder are only added to
+// the endpoints running them, endpoints refuse to register with hooks they do not run.
+// AfterPersist runs once the change is committed: its error is answered as the
+// failure of the request, although the change is saved.
+type Hooks struct {
+	beforeBind    []Hook
+	afterBind     []Hook
+	beforePersist []Hook
+	afterPersist  []Hook
+	transforms    []Transform
+}
+
+func (ep *Endpoint) BeforeBind(hook Hook) *Endpoint {
+	ep.Hooks.beforeBind = append(ep.Hooks.beforeBind, hook)
+	return ep
+}
+
+func (ep *Endpoint) AfterBind(hook Hook) *Endpoint {
+	ep.Hooks.afterBind = append(ep.Hooks.afterBind, hook)
+	return ep
+}
+
+func (ep *Endpoint) BeforePersist(hook Hook) *Endpoint {
+	ep.Hooks.beforePersist = append(ep.Hooks.beforePersist, hook)
+	return ep
+}
+
+// AfterPersist adds a hook run once the change is committed, its error is answered
+// although the change is saved
+func (ep *Endpoint) AfterPersist(hook Hook) *Endpoint {
+	ep.Hooks.afterPersist = append(ep.Hooks.afterPersist, hook)
+	return ep
+}
+
+func (ep *Endpoint) Transform(transform Transform) *Endpoint {
+	ep.Hooks.transforms = append(ep.Hooks.transforms, transform)
+	return ep
+}
+
+func (builder *EndpointBuilder) BeforeBind(hook Hook) *EndpointBuilder {
+	builder.eachRunning(hookBeforeBind, func(ep *Endpoint) { ep.BeforeBind(hook) })
+	return builder
+}
+
+func (builder *EndpointBuilder) AfterBind(hook Hook) *EndpointBuilder {
+	builder.eachRunning(hookAfterBind, func(ep *Endpoint) { ep.AfterBind(hook) })
+	return builder
+}
+
+func (builder *EndpointBuilder) BeforePersist(hook Hook) *EndpointBuilder {
+	builder.eachRunning(hookBeforePersist, func(ep *Endpoint) { ep.BeforePersist(hook) })
+	return builder
+}
+
+func (builder *EndpointBuilder) AfterPersist(hook Hook) *EndpointBuilder {
+	builder.eachRunning(hookAfterPersist, func(ep *Endpoint) { ep.AfterPersist(hook) })
+	return builder
+}
+
+func (builder *EndpointBuilder) Transform(transform Transform) *EndpointBuilder {
+	builder.eachRunning(hookTransform, func(ep *Endpoint) { ep.Transform(transform) })
+	return builder
+}
+
+// each calls fn with the metadata of the endpoints of the builder
+func (builder *EndpointBuilder) each(fn func(ep *Endpoint)) {
+	for _, iep := range builder.endPoints {
+		if meta, ok := iep.(interface{ Meta() *Endpoint }); ok {
+			fn(meta.Meta())
+		}
+	}
+}
+
+// the points endpoints run hooks at
+type hookPoint int8
+
+const (
+	hookBeforeBind hookPoint = 1 << iota
+	hookAfterBind
+	hookBeforePersist
+	hookAfterPersist
+	hookTransform
+
+	hookBind    = hookBeforeBind | hookAfterBind
+	hookPersist = hookBeforePersist | hookAfterPersist
+	hookAll     = hookBind | hookPersist | hookTransform
+)
+
+// hookPoints answers the points iep runs hooks at, all of them for endpoints not of
+// this package
+func hookPoints(iep IEndPoint) hookPoint {
+	switch ep := iep.(type) {
+	case *Create, *Update:
+		return hookAll
+	case *Patch:
+		if ep.Module.RpcOn {
+			return hookAfterPersist | hookTransform
+		}
+		return hookAll
+	case *Import:
+		return hookBind | hookPersist
+	case *Delete:
+		return hookPersist | hookTransform
+	case *Get, *List, *Stats:
+		return hookBind | hookTransform
+	case *Export:
+		return hookBind
+	case *History:
+		return hookTransform
+	}
+	return hookAll
+}
+
+// eachRunning calls fn with the metadata of the endpoints of the builder running hooks at point
+func (builder *EndpointBuilder) eachRunning(point hookPoint, fn func(ep *Endpoint)) {
+	for _, iep := range builder.endPoints {
+		if meta, ok := iep.(interface{ Meta() *Endpoint }); ok && hookPoints(iep)&point != 0 {
+			fn(meta.Meta())
+		}
+	}
+}
+
+// checkHooks panics when iep has hooks it does not run, as they would silently not be
+func (ep *Endpoint) checkHooks(iep IEndPoint) {
+	points := hookPoints(iep)
+	for _, h := range []struct {
+		point hookPoint
+		name  string
+		set   bool
+	}{
+		{hookBeforeBind, "BeforeBind", len(ep.Hooks.beforeBind) > 0},
+		{hookAfterBind, "AfterBind", len(ep.Hooks.afterBind) > 0},
+		{hookBeforePersist, "BeforePersist", len(ep.Hooks.beforePersist) > 0},
+		{hookAfterPersist, "AfterPersist", len(ep.Hooks.afterPersist) > 0},
+		{hookTransform, "Transform", len(ep.Hooks.transforms) > 0},
+	} {
+		if h.set && points&h.point == 0 {
+			panic(h.name + " hooks are not run by " + ep.Name())
+		}
+	}
+}
+
+// hook runs hooks on domain, stopping at the first error
+func (ep *Endpoint) hook(c *gin.Context, hooks []Hook, domain interface{}) error {
+	for _, hook := range hooks {
+		if err := hook(c, ep, domain); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// transform applies the transforms of the endpoint to data
+func (ep *Endpoint) transform(c *gin.Context, data interface{}) (interface{}, error) {
+	var err error
+	for _, transform := range ep.Hooks.transforms {
+		if data, err = transform(c, ep, data); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
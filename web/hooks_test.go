@@ -0,0 +1,177 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sdjnlh/communal"
+	"github.com/sdjnlh/communal/errors"
+	"github.com/sdjnlh/communal/internal/dbtest"
+	"github.com/sdjnlh/communal/log"
+	"github.com/sdjnlh/communal/rpc"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestHooks(t *testing.T) {
+	log.Logger.Logger = zap.NewNop()
+	gin.SetMode(gin.TestMode)
+
+	var sent []*ownedPost
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/Delete") {
+			_ = json.NewEncoder(w).Encode(&communal.Result{Ok: true})
+			return
+		}
+		p := &ownedPost{}
+		_ = json.NewDecoder(r.Body).Decode(p)
+		sent = append(sent, p)
+		p.Id = 7
+		_ = json.NewEncoder(w).Encode(&communal.Result{Ok: true, Data: p})
+	}))
+	defer server.Close()
+	rpc.SetClient(rpc.NewHttpClient(rpc.Config{Services: map[string]rpc.ServiceConfig{"post": {Url: server.URL}}}))
+	defer rpc.SetClient(rpc.NewHttpClient(rpc.Config{}))
+
+	var steps []string
+	builder := NewEndpointBuilder("post", "post", "/posts").RpcOn()
+	builder.NewCreate().Creator(func(c *gin.Context) (interface{}, error) { return &ownedPost{}, nil }).
+		BeforeBind(func(c *gin.Context, ep *Endpoint, domain interface{}) error {
+			steps = append(steps, "beforeBind")
+			domain.(*ownedPost).Title = "untitled"
+			return nil
+		}).
+		AfterBind(func(c *gin.Context, ep *Endpoint, domain interface{}) error {
+			steps = append(steps, "afterBind")
+			if domain.(*ownedPost).Title == "spam" {
+				return errors.InvalidParams()
+			}
+			return nil
+		}).
+		BeforePersist(func(c *gin.Context, ep *Endpoint, domain interface{}) error {
+			steps = append(steps, "beforePersist")
+			domain.(*ownedPost).Uid = c.GetInt64(communal.UserIdKey)
+			return nil
+		}).
+		AfterPersist(func(c *gin.Context, ep *Endpoint, domain interface{}) error {
+			steps = append(steps, "afterPersist")
+			return nil
+		})
+	builder.NewDelete().BeforePersist(func(c *gin.Context, ep *Endpoint, domain interface{}) error {
+		if domain.(int64) == 9 {
+			return errors.Forbidden()
+		}
+		return nil
+	})
+	builder.Api().AlwaysPassRightCheck().Transform(func(c *gin.Context, ep *Endpoint, data interface{}) (interface{}, error) {
+		if p, ok := data.(*ownedPost); ok {
+			return map[string]string{"title": strings.ToUpper(p.Title)}, nil
+		}
+		return data, nil
+	})
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set(communal.UserIdKey, int64(5))
+	})
+	builder.RegisterAll(router)
+
+	serve := func(method string, path string, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := serve(http.MethodPost, "/posts", `{}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []string{"beforeBind", "afterBind", "beforePersist", "afterPersist"}, steps)
+	assert.Equal(t, int64(5), sent[0].Uid)
+	assert.Equal(t, "untitled", sent[0].Title)
+	assert.Contains(t, w.Body.String(), `"title":"UNTITLED"`)
+
+	steps = nil
+	w = serve(http.MethodPost, "/posts", `{"title":"spam"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, []string{"beforeBind", "afterBind"}, steps)
+	assert.Len(t, sent, 1)
+
+	assert.Equal(t, http.StatusForbidden, serve(http.MethodDelete, "/posts/9", "").Code)
+	assert.Equal(t, http.StatusOK, serve(http.MethodDelete, "/posts/8", "").Code)
+}
+
+func TestHooks_Patch(t *testing.T) {
+	log.Logger.Logger = zap.NewNop()
+	gin.SetMode(gin.TestMode)
+
+	engine, db := dbtest.Open()
+	db.Rows("FOR UPDATE", []string{"id", "uid", "title"}, []interface{}{int64(7), int64(3), "old"})
+	var steps []string
+	step := func(name string) Hook {
+		return func(c *gin.Context, ep *Endpoint, domain interface{}) error {
+			steps = append(steps, name)
+			return nil
+		}
+	}
+	builder := NewEndpointBuilder("post", "post", "/posts")
+	builder.Module.SetDB(engine)
+	builder.NewPatch().Creator(func(c *gin.Context) (communal.IdInf, error) { return &ownedPost{}, nil })
+	builder.NewList().Creator(func(c *gin.Context) (communal.Filter, error) { return &articleFilter{}, nil }, nil)
+	builder.Api().AlwaysPassRightCheck().
+		BeforeBind(step("beforeBind")).
+		AfterBind(step("afterBind")).
+		BeforePersist(func(c *gin.Context, ep *Endpoint, domain interface{}) error {
+			steps = append(steps, "beforePersist")
+			domain.(*ownedPost).Uid = 5
+			return nil
+		}).
+		AfterPersist(step("afterPersist")).
+		Transform(func(c *gin.Context, ep *Endpoint, data interface{}) (interface{}, error) {
+			return map[string]string{"title": strings.ToUpper(data.(*ownedPost).Title)}, nil
+		})
+	list := builder.GetEndpoint("List").(*List)
+	assert.Empty(t, list.Hooks.beforePersist, "List persists nothing")
+	assert.Len(t, list.Hooks.beforeBind, 1)
+	router := gin.New()
+	builder.RegisterAll(router)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPatch, "/posts/7", strings.NewReader(`{"title":"new"}`))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []string{"beforeBind", "afterBind", "beforePersist", "afterPersist"}, steps)
+	assert.Contains(t, w.Body.String(), `"title":"NEW"`)
+	updates := db.Find("UPDATE `post`")
+	if assert.Len(t, updates, 1) {
+		// the uid set by the hook is written along the patched title
+		assert.Contains(t, updates[0].SQL, "`title` = ?")
+		assert.Contains(t, updates[0].SQL, "`uid` = ?")
+		assert.NotContains(t, updates[0].SQL, "`crt` = ?")
+	}
+}
+
+func TestHooks_Unsupported(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	noop := func(c *gin.Context, ep *Endpoint, domain interface{}) error { return nil }
+
+	builder := NewEndpointBuilder("post", "post", "/posts")
+	builder.NewStats().Creator(func(c *gin.Context) (communal.Filter, error) { return &articleFilter{}, nil })
+	builder.GetEndpoint("Stats").(*Stats).BeforePersist(noop)
+	assert.Panics(t, func() { builder.GetEndpoint("Stats").Register(gin.New()) })
+
+	rpcBuilder := NewEndpointBuilder("post", "post", "/posts").RpcOn()
+	rpcBuilder.NewPatch().Creator(func(c *gin.Context) (communal.IdInf, error) { return &ownedPost{}, nil })
+	rpcBuilder.NewHistory()
+	rpcBuilder.BeforePersist(noop).AfterPersist(noop).AfterBind(noop)
+	patch := rpcBuilder.GetEndpoint("Patch").(*Patch)
+	assert.Empty(t, patch.Hooks.beforePersist, "the patches of rpc modules are merged by the service")
+	assert.Len(t, patch.Hooks.afterPersist, 1)
+	assert.Empty(t, rpcBuilder.GetEndpoint("History").(*History).Hooks.afterBind)
+	patch.BeforeBind(noop)
+	assert.Panics(t, func() { patch.Register(gin.New()) })
+}
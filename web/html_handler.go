@@ -45,6 +45,19 @@ func (handler *HtmlHandler) Unauthorized(c *gin.Context, page string, data inter
 	}
 }
 
+func (handler *HtmlHandler) Forbidden(c *gin.Context, page string, data interface{}) {
+	if page == "" {
+		c.Redirect(http.StatusSeeOther, "/403.html")
+		return
+	}
+
+	if be, ok := data.(*errors.SimpleBizError); ok {
+		c.HTML(http.StatusForbidden, page, be)
+	} else {
+		c.HTML(http.StatusForbidden, page, gin.H{"ok": false, "data": data})
+	}
+}
+
 func (handler *HtmlHandler) NotFound(c *gin.Context, page string, data interface{}) {
 	if page == "" {
 		c.Redirect(http.StatusTemporaryRedirect, "/404.html")
@@ -75,6 +88,7 @@ func HtmlFail(c *gin.Context, page string, err error) {
 }
 
 func writeResult(c *gin.Context, result communal.IResult, err error, pages ...string) {
+	withCsrf(c, result)
 	if result != nil && result.IsOk() {
 		c.HTML(http.StatusOK, pages[0], result)
 		return
@@ -85,29 +99,31 @@ func writeResult(c *gin.Context, result communal.IResult, err error, pages ...st
 		errPage = pages[1]
 	}
 
+	failure := err
+	if failure == nil && result != nil && result.Err() != nil {
+		failure = result.Err()
+	}
 	code := http.StatusInternalServerError
-
-	if err == nil {
-		if result != nil && result.Err() != nil {
-			switch result.Err().GetCode() {
-			case errors.Common_InvalidParams:
-				code = http.StatusBadRequest
-			case errors.Common_NotFound:
-				code = http.StatusNotFound
-			case errors.Common_Forbidden:
-				code = http.StatusForbidden
-			default:
-				break
-			}
+	if failure != nil {
+		recordFailure(c, failure)
+		code = errors.StatusOf(failure)
+		if result == nil {
+			result = &communal.Result{}
 		}
+		result.SetError(errors.Public(failure))
 	}
 
 	if errPage == "" {
-		if code == http.StatusBadRequest {
+		switch code {
+		case http.StatusBadRequest:
 			errPage = "/400.html"
-		} else if code == http.StatusNotFound {
+		case http.StatusUnauthorized:
+			errPage = "/login.html"
+		case http.StatusForbidden:
+			errPage = "/403.html"
+		case http.StatusNotFound:
 			errPage = "/404.html"
-		} else {
+		default:
 			errPage = "/500.html"
 		}
 		c.Redirect(http.StatusTemporaryRedirect, errPage)
@@ -0,0 +1,181 @@
+package web
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sdjnlh/communal"
+	"github.com/sdjnlh/communal/errors"
+	"github.com/sdjnlh/communal/idempotency"
+	"github.com/sdjnlh/communal/log"
+	"go.uber.org/zap"
+)
+
+const (
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// IdempotentReplayedHeader marks responses replayed from the store
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+
+	DefaultIdempotencyTTL = 24 * time.Hour
+	// DefaultIdempotencyLock is how long a pending key stays claimed, freeing the keys
+	// of requests whose server died before storing the response
+	DefaultIdempotencyLock = time.Minute
+	idempotencyPoll        = 50 * time.Millisecond
+)
+
+// Idempotency stores the first response of requests carrying an Idempotency-Key
+// header, per user and key, and replays it for retries. Duplicates arriving while
+// the first request is in flight wait up to Wait, then get a 409. A key reused
+// with another body is rejected. Pending keys are claimed for Lock, responses are
+// kept for TTL.
+type Idempotency struct {
+	Store idempotency.Store
+	TTL   time.Duration
+	Lock  time.Duration
+	Wait  time.Duration
+}
+
+type recordingWriter struct {
+	gin.ResponseWriter
+	owner string
+	hash  string
+	body  bytes.Buffer
+}
+
+func (w *recordingWriter) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *recordingWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (idem *Idempotency) ttl() time.Duration {
+	if idem.TTL > 0 {
+		return idem.TTL
+	}
+	return DefaultIdempotencyTTL
+}
+
+func (idem *Idempotency) lock() time.Duration {
+	if idem.Lock > 0 {
+		return idem.Lock
+	}
+	return DefaultIdempotencyLock
+}
+
+// begin claims the key of the request, answering false when the request was
+// answered, by a replay or an error, instead. end must be deferred once a request
+// is claimed.
+func (idem *Idempotency) begin(c *gin.Context, ep *Endpoint) (key string, claimed bool) {
+	body, err := c.GetRawData()
+	if err != nil {
+		ep.Fail(c, ep, errors.InvalidParams())
+		return "", false
+	}
+	c.Request.Body = ioutil.NopCloser(bytes.NewReader(body))
+	hash := hashOf(string(body))
+	key = ep.Module.Name + ":" + strconv.FormatInt(c.GetInt64(communal.UserIdKey), 10) + ":" + c.GetHeader(IdempotencyKeyHeader)
+
+	deadline := time.Now().Add(idem.Wait)
+	for {
+		record, started, err := idem.Store.Start(c, key, hash, idem.lock())
+		if err != nil {
+			ep.Fail(c, ep, err)
+			return "", false
+		}
+		if started {
+			c.Writer = &recordingWriter{ResponseWriter: c.Writer, owner: record.Owner, hash: hash}
+			return key, true
+		}
+		if record.Hash != hash {
+			ep.Fail(c, ep, errors.InvalidParams().AddError(errors.InvalidField(IdempotencyKeyHeader, "REUSED", "the key was used with another request body")))
+			return "", false
+		}
+		if record.Done {
+			c.Header(IdempotentReplayedHeader, "true")
+			c.Data(record.Status, record.ContentType, record.Body)
+			c.Abort()
+			return "", false
+		}
+		if !time.Now().Before(deadline) {
+			ep.Fail(c, ep, &errors.SimpleBizError{Code: errors.Common_Conflict, Msg: "a request with the same idempotency key is in progress"})
+			return "", false
+		}
+
+		select {
+		case <-c.Request.Context().Done():
+			c.Abort()
+			return "", false
+		case <-time.After(idempotencyPoll):
+		}
+	}
+}
+
+// end stores the response of a claimed request. The key is released, so that the
+// request can be retried, after server errors, panics and requests never answered.
+func (idem *Idempotency) end(c *gin.Context, key string) {
+	writer, ok := c.Writer.(*recordingWriter)
+	if !ok {
+		return
+	}
+	c.Writer = writer.ResponseWriter
+
+	if r := recover(); r != nil {
+		if err := idem.Store.Release(c, key, writer.owner); err != nil {
+			log.Ctx(c).Error("fail to release idempotency key", zap.String("key", key), zap.Error(err))
+		}
+		panic(r)
+	}
+
+	var err error
+	if !writer.Written() || writer.Status() >= 500 {
+		err = idem.Store.Release(c, key, writer.owner)
+	} else {
+		err = idem.Store.Finish(c, key, &idempotency.Record{
+			Owner:       writer.owner,
+			Hash:        writer.hash,
+			Status:      writer.Status(),
+			ContentType: writer.Header().Get("Content-Type"),
+			Body:        writer.body.Bytes(),
+		}, idem.ttl())
+	}
+	if err == idempotency.ErrClaimLost {
+		// the request outlived its claim, the response of the retry is kept
+		log.Ctx(c).Warn("idempotency key claimed by a retry", zap.String("key", key))
+	} else if err != nil {
+		log.Ctx(c).Error("fail to store idempotent response", zap.String("key", key), zap.Error(err))
+	}
+}
+
+// Idempotent makes the endpoint honor the Idempotency-Key header, with records
+// kept for ttl, 24 hours by default.
+func (ep *Create) Idempotent(store idempotency.Store, ttl ...time.Duration) *Create {
+	ep.Idempotency = &Idempotency{Store: store}
+	if len(ttl) > 0 {
+		ep.Idempotency.TTL = ttl[0]
+	}
+	return ep
+}
+
+// Idempotent makes the Create endpoints of the builder honor the Idempotency-Key header
+func (builder *EndpointBuilder) Idempotent(store idempotency.Store, ttl ...time.Duration) *EndpointBuilder {
+	for _, iep := range builder.endPoints {
+		if ep, ok := iep.(*Create); ok {
+			ep.Idempotent(store, ttl...)
+		}
+	}
+	return builder
+}
+
+func hashOf(body string) string {
+	sum := sha256.Sum256([]byte(body))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,154 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sdjnlh/communal"
+	"github.com/sdjnlh/communal/errors"
+	"github.com/sdjnlh/communal/idempotency"
+	"github.com/sdjnlh/communal/log"
+	"github.com/sdjnlh/communal/rpc"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestIdempotentCreate(t *testing.T) {
+	log.Logger.Logger = zap.NewNop()
+	gin.SetMode(gin.TestMode)
+
+	created := 0
+	fail := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fail {
+			w.WriteHeader(http.StatusInternalServerError)
+			_ = json.NewEncoder(w).Encode(errors.ServerError())
+			return
+		}
+		created++
+		p := &post{}
+		_ = json.NewDecoder(r.Body).Decode(p)
+		p.Id = int64(created)
+		_ = json.NewEncoder(w).Encode(&communal.Result{Ok: true, Data: p})
+	}))
+	defer server.Close()
+	rpc.SetClient(rpc.NewHttpClient(rpc.Config{Services: map[string]rpc.ServiceConfig{"post": {Url: server.URL}}}))
+	defer rpc.SetClient(rpc.NewHttpClient(rpc.Config{}))
+
+	store := idempotency.NewMemory()
+	builder := NewEndpointBuilder("post", "post", "/posts").RpcOn()
+	builder.NewCreate().Creator(func(c *gin.Context) (interface{}, error) { return &post{}, nil })
+	builder.Api().AlwaysPassRightCheck().Idempotent(store, time.Minute)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set(communal.UserIdKey, int64(3))
+	})
+	builder.RegisterAll(router)
+
+	serve := func(key string, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/posts", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if key != "" {
+			req.Header.Set(IdempotencyKeyHeader, key)
+		}
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	first := serve("a", `{"title":"hello"}`)
+	assert.Equal(t, http.StatusOK, first.Code)
+	replay := serve("a", `{"title":"hello"}`)
+	assert.Equal(t, http.StatusOK, replay.Code)
+	assert.Equal(t, first.Body.String(), replay.Body.String())
+	assert.Equal(t, "true", replay.Header().Get(IdempotentReplayedHeader))
+	assert.Equal(t, 1, created)
+
+	w := serve("a", `{"title":"other"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), `"name":"Idempotency-Key"`)
+
+	serve("", `{"title":"hello"}`)
+	serve("", `{"title":"hello"}`)
+	assert.Equal(t, 3, created, "requests without a key are not deduplicated")
+
+	_, _, _ = store.Start(context.Background(), "post:3:b", hashOf(`{"title":"hello"}`), time.Minute)
+	w = serve("b", `{"title":"hello"}`)
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	fail = true
+	w = serve("c", `{"title":"hello"}`)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	fail = false
+	w = serve("c", `{"title":"hello"}`)
+	assert.Equal(t, http.StatusOK, w.Code, "failed requests can be retried")
+	assert.Empty(t, w.Header().Get(IdempotentReplayedHeader))
+}
+
+type ttlStore struct {
+	idempotency.Store
+	started  time.Duration
+	finished time.Duration
+}
+
+func (store *ttlStore) Start(ctx context.Context, key string, hash string, ttl time.Duration) (*idempotency.Record, bool, error) {
+	store.started = ttl
+	return store.Store.Start(ctx, key, hash, ttl)
+}
+
+func (store *ttlStore) Finish(ctx context.Context, key string, record *idempotency.Record, ttl time.Duration) error {
+	store.finished = ttl
+	return store.Store.Finish(ctx, key, record, ttl)
+}
+
+func TestIdempotentCreate_Release(t *testing.T) {
+	log.Logger.Logger = zap.NewNop()
+	gin.SetMode(gin.TestMode)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(&communal.Result{Ok: true, Data: &post{}})
+	}))
+	defer server.Close()
+	rpc.SetClient(rpc.NewHttpClient(rpc.Config{Services: map[string]rpc.ServiceConfig{"post": {Url: server.URL}}}))
+	defer rpc.SetClient(rpc.NewHttpClient(rpc.Config{}))
+
+	store := &ttlStore{Store: idempotency.NewMemory()}
+	panics := true
+	builder := NewEndpointBuilder("post", "post", "/posts").RpcOn()
+	builder.NewCreate().Creator(func(c *gin.Context) (interface{}, error) { return &post{}, nil })
+	builder.Api().AlwaysPassRightCheck().Idempotent(store).BeforePersist(func(c *gin.Context, ep *Endpoint, domain interface{}) error {
+		if panics {
+			panic("boom")
+		}
+		return nil
+	})
+	router := gin.New()
+	router.Use(gin.CustomRecovery(func(c *gin.Context, err interface{}) {
+		c.AbortWithStatus(http.StatusInternalServerError)
+	}))
+	builder.RegisterAll(router)
+
+	serve := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/posts", strings.NewReader(`{"title":"hello"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(IdempotencyKeyHeader, "a")
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusInternalServerError, serve().Code)
+	assert.Equal(t, DefaultIdempotencyLock, store.started, "pending keys are claimed for the lock duration")
+
+	panics = false
+	w := serve()
+	assert.Equal(t, http.StatusOK, w.Code, "keys of panicking requests are released")
+	assert.Empty(t, w.Header().Get(IdempotentReplayedHeader))
+	assert.Equal(t, DefaultIdempotencyTTL, store.finished)
+}
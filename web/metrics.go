@@ -0,0 +1,41 @@
+package web
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sdjnlh/communal/errors"
+	"github.com/sdjnlh/communal/metrics"
+)
+
+var (
+	requestsTotal   = metrics.NewCounter("http_requests_total", "Requests served, by route and endpoint.", "method", "route", "endpoint", "status")
+	requestDuration = metrics.NewHistogram("http_request_duration_seconds", "Latency of requests, by route and endpoint.", nil, "method", "route", "endpoint")
+	bizErrorsTotal  = metrics.NewCounter("biz_errors_total", "Failed requests, by error code.", "code", "endpoint")
+)
+
+func init() {
+	metrics.Register(requestsTotal, requestDuration, bizErrorsTotal)
+}
+
+// Metrics counts requests and their latency by route and endpoint, and failures by
+// error code. Requests to routes not registered are counted under an empty route.
+func Metrics(c *gin.Context) {
+	start := time.Now()
+	c.Next()
+
+	route := c.FullPath()
+	endpoint := ""
+	if ep := EndpointOf(c); ep != nil {
+		endpoint = ep.Name()
+	}
+	requestsTotal.Inc(c.Request.Method, route, endpoint, strconv.Itoa(c.Writer.Status()))
+	requestDuration.ObserveDuration(time.Since(start), c.Request.Method, route, endpoint)
+	if failure, ok := c.Get(failureKey); ok {
+		bizErrorsTotal.Inc(errors.CodeOf(failure.(error)).Code, endpoint)
+	}
+}
+
+// MetricsHandler serves the metrics of the default registry, to be routed on /metrics
+var MetricsHandler = gin.WrapH(metrics.Handler())
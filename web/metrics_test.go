@@ -0,0 +1,34 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sdjnlh/communal/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetrics(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.Use(Metrics)
+	router.GET("/metrics", MetricsHandler)
+	router.GET("/things/:id", func(c *gin.Context) { c.Status(http.StatusOK) })
+	router.GET("/broken", func(c *gin.Context) { ApiFail(c, errors.Conflict()) })
+
+	for _, path := range []string{"/things/1", "/things/2", "/broken"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	body := w.Body.String()
+	assert.Contains(t, body, `http_requests_total{method="GET",route="/things/:id",endpoint="",status="200"} 2`)
+	assert.Contains(t, body, `http_requests_total{method="GET",route="/broken",endpoint="",status="409"} 1`)
+	assert.Contains(t, body, `http_request_duration_seconds_count{method="GET",route="/things/:id",endpoint=""} 2`)
+	assert.Contains(t, body, `biz_errors_total{code="`+errors.Common_Conflict+`",endpoint=""} 1`)
+}
@@ -0,0 +1,120 @@
+package web
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	FormatJson = "json"
+	FormatHtml = "html"
+
+	// formatKey keeps the format negotiated for the request in the gin context
+	formatKey = "communal.format"
+	// jsonSuffix asks for json on the routes of negotiated endpoints, e.g. /articles.json
+	jsonSuffix = ".json"
+)
+
+// Negotiated makes the endpoint serve both the page set with SetPage and the json api,
+// as negotiated by Format
+func (ep *Endpoint) Negotiated() *Endpoint {
+	ep.Type = END_POINT_TYPE_NEGOTIATED
+	ep.Success = EndpointNegotiatedSuccess
+	ep.Fail = EndpointNegotiatedFail
+	return ep
+}
+
+// Negotiated makes the endpoints of the builder serve both pages and json
+func (builder *EndpointBuilder) Negotiated() *EndpointBuilder {
+	builder.endpointType = END_POINT_TYPE_NEGOTIATED
+	builder.applyType()
+	return builder
+}
+
+func EndpointNegotiatedSuccess(c *gin.Context, md *Endpoint, data interface{}) {
+	if Format(c) == FormatJson {
+		EndpointApiSuccess(c, md, data)
+	} else {
+		EndpointHtmlSuccess(c, md, data)
+	}
+}
+
+func EndpointNegotiatedFail(c *gin.Context, md *Endpoint, err error) {
+	if Format(c) == FormatJson {
+		EndpointApiFail(c, md, err)
+	} else {
+		EndpointHtmlFail(c, md, err)
+	}
+}
+
+// Format answers json or html for the request, asked for by a .json suffix of the path,
+// the format query param or else the Accept header, html by default
+func Format(c *gin.Context) string {
+	if format := c.GetString(formatKey); format != "" {
+		return format
+	}
+
+	format := FormatHtml
+	if strings.HasSuffix(c.Request.URL.Path, jsonSuffix) {
+		format = FormatJson
+	} else if param := strings.ToLower(c.Query("format")); param == FormatJson || param == FormatHtml {
+		format = param
+	} else if acceptsJson(c.GetHeader("Accept")) {
+		format = FormatJson
+	}
+	c.Set(formatKey, format)
+	return format
+}
+
+// negotiate settles the format of requests to negotiated endpoints, stripping the .json
+// suffix from the path param ending the route, routes ending with a static segment get
+// a .json twin instead
+func negotiate(c *gin.Context) {
+	c.Writer.Header().Add("Vary", "Accept")
+	if Format(c) == FormatJson && strings.HasSuffix(c.Request.URL.Path, jsonSuffix) && endsWithParam(c.FullPath()) && len(c.Params) > 0 {
+		last := &c.Params[len(c.Params)-1]
+		last.Value = strings.TrimSuffix(last.Value, jsonSuffix)
+	}
+	c.Next()
+}
+
+// acceptsJson tells whether accept prefers application/json to text/html, by quality
+// and then by order, wildcards count for html
+func acceptsJson(accept string) bool {
+	jsonQ, htmlQ := 0.0, 0.0
+	jsonAt, htmlAt := -1, -1
+	for i, item := range strings.Split(accept, ",") {
+		parts := strings.Split(item, ";")
+		media := strings.ToLower(strings.TrimSpace(parts[0]))
+		q := 1.0
+		for _, param := range parts[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if v, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+		switch media {
+		case "application/json":
+			if q > jsonQ {
+				jsonQ, jsonAt = q, i
+			}
+		case "text/html", "text/*", "*/*":
+			if q > htmlQ {
+				htmlQ, htmlAt = q, i
+			}
+		}
+	}
+	if jsonAt < 0 {
+		return false
+	}
+	return htmlAt < 0 || jsonQ > htmlQ || jsonQ == htmlQ && jsonAt < htmlAt
+}
+
+func endsWithParam(route string) bool {
+	segment := route[strings.LastIndexByte(route, '/')+1:]
+	return strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*")
+}
@@ -0,0 +1,103 @@
+package web
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sdjnlh/communal"
+	"github.com/sdjnlh/communal/errors"
+	"github.com/sdjnlh/communal/log"
+	"github.com/sdjnlh/communal/rpc"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestAcceptsJson(t *testing.T) {
+	assert.True(t, acceptsJson("application/json"))
+	assert.True(t, acceptsJson("application/json, text/plain, */*"))
+	assert.True(t, acceptsJson("text/html;q=0.5, application/json"))
+	assert.False(t, acceptsJson(""))
+	assert.False(t, acceptsJson("*/*"))
+	assert.False(t, acceptsJson("text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"))
+	assert.False(t, acceptsJson("application/json;q=0.5, text/html"))
+	assert.False(t, acceptsJson("application/json;q=0"))
+}
+
+func TestNegotiated(t *testing.T) {
+	log.Logger.Logger = zap.NewNop()
+	gin.SetMode(gin.TestMode)
+
+	var ids []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/List") {
+			_ = json.NewEncoder(w).Encode(&communal.FilterResult{Result: communal.Result{Ok: true, Data: []*post{{Title: "listed"}}}})
+			return
+		}
+		var raw json.RawMessage
+		_ = json.NewDecoder(r.Body).Decode(&raw)
+		id := strings.Trim(string(raw), `"`)
+		ids = append(ids, id)
+		if id == "400" {
+			_ = json.NewEncoder(w).Encode(&communal.Result{Error: errors.InvalidParams()})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(&communal.Result{Ok: true, Data: &post{Title: "remote"}})
+	}))
+	defer server.Close()
+	rpc.SetClient(rpc.NewHttpClient(rpc.Config{Services: map[string]rpc.ServiceConfig{"post": {Url: server.URL}}}))
+	defer rpc.SetClient(rpc.NewHttpClient(rpc.Config{}))
+
+	builder := NewEndpointBuilder("post", "post", "/posts").RpcOn()
+	builder.NewGet().Creator(func(c *gin.Context) (interface{}, error) { return &post{}, nil }).SetPage("detail")
+	builder.NewList().Creator(
+		func(c *gin.Context) (communal.Filter, error) { return &articleFilter{}, nil },
+		func(c *gin.Context) (interface{}, error) { return &[]*post{}, nil },
+	).SetPage("list")
+	builder.Negotiated().AlwaysPassRightCheck()
+	router := gin.New()
+	router.SetHTMLTemplate(template.Must(template.New("detail").Parse(`<h1>{{.Data.Title}}</h1>`)))
+	builder.RegisterAll(router)
+
+	serve := func(path string, accept string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := serve("/posts/7", "text/html,*/*;q=0.8")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "<h1>remote</h1>", w.Body.String())
+	assert.Equal(t, []string{"Accept"}, w.Header()["Vary"])
+
+	for _, path := range []string{"/posts/7.json", "/posts/7?format=json"} {
+		w = serve(path, "")
+		assert.Equal(t, http.StatusOK, w.Code, path)
+		assert.Contains(t, w.Header().Get("Content-Type"), "application/json")
+		assert.Contains(t, w.Body.String(), `"title":"remote"`)
+	}
+	w = serve("/posts/7", "application/json")
+	assert.Contains(t, w.Body.String(), `"title":"remote"`)
+	w = serve("/posts/7?format=html", "application/json")
+	assert.Equal(t, "<h1>remote</h1>", w.Body.String())
+	assert.Equal(t, []string{"7", "7", "7", "7", "7"}, ids)
+
+	w = serve("/posts.json", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"title":"listed"`)
+
+	w = serve("/posts/400", "application/json")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), errors.Common_InvalidParams)
+	w = serve("/posts/400", "")
+	assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+	assert.Equal(t, "/400.html", w.Header().Get("Location"))
+}
@@ -0,0 +1,318 @@
+package web
+
+import (
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sdjnlh/communal"
+	"github.com/sdjnlh/communal/app"
+	"github.com/sdjnlh/communal/openapi"
+	"github.com/sdjnlh/communal/sheet"
+	"github.com/sdjnlh/communal/util"
+)
+
+var (
+	buildersMu sync.Mutex
+	builders   []*EndpointBuilder
+
+	pathParamPattern = regexp.MustCompile(`[:*]([A-Za-z0-9_]+)`)
+)
+
+func trackBuilder(builder *EndpointBuilder) {
+	buildersMu.Lock()
+	defer buildersMu.Unlock()
+	for _, b := range builders {
+		if b == builder {
+			return
+		}
+	}
+	builders = append(builders, builder)
+}
+
+// RegisteredBuilders are the builders registered with RegisterAll so far
+func RegisteredBuilders() []*EndpointBuilder {
+	buildersMu.Lock()
+	defer buildersMu.Unlock()
+	return append([]*EndpointBuilder{}, builders...)
+}
+
+// DefaultUiAssets is where the Swagger UI page loads swagger-ui-dist from
+const DefaultUiAssets = "https://unpkg.com/swagger-ui-dist@4"
+
+// OpenAPI serves an OpenAPI 3 document of the api endpoints of the registered
+// builders at Path, and a Swagger UI page at UiPath when set. The document is
+// built on the first request, after all builders are registered.
+//
+// The Swagger UI assets are not embedded: the page loads them from UiAssets, the
+// unpkg CDN by default. Browsers without access to it need a self hosted copy of
+// swagger-ui-dist, whose url is set as UiAssets.
+type OpenAPI struct {
+	Info     openapi.Info
+	Servers  []openapi.Server
+	Path     string
+	UiPath   string
+	UiAssets string
+
+	once sync.Once
+	doc  *openapi.Document
+}
+
+func NewOpenAPI(title string, version string) *OpenAPI {
+	return &OpenAPI{Info: openapi.Info{Title: title, Version: version}, Path: "/openapi.json", UiAssets: DefaultUiAssets}
+}
+
+// OpenAPIConfig is the openapi config section of a web app, e.g.
+//
+//	openapi:
+//	  title: article api
+//	  version: 1.0.0
+//	  path: /api/openapi.json
+//	  uiPath: /api/docs
+//	  uiAssets: /static/swagger-ui-dist
+type OpenAPIConfig struct {
+	Title    string
+	Version  string
+	Path     string
+	UiPath   string
+	UiAssets string
+}
+
+// OpenAPIOf configures the document from the config of a started web app
+func OpenAPIOf(webapp *app.Web) *OpenAPI {
+	conf := OpenAPIConfig{}
+	if webapp.RawConfig != nil {
+		_ = webapp.RawConfig.UnmarshalKey("openapi", &conf)
+	}
+	if conf.Title == "" {
+		conf.Title = webapp.Name()
+	}
+	oa := NewOpenAPI(conf.Title, conf.Version)
+	if conf.Path != "" {
+		oa.Path = conf.Path
+	}
+	oa.UiPath = conf.UiPath
+	if conf.UiAssets != "" {
+		oa.UiAssets = conf.UiAssets
+	}
+	return oa
+}
+
+func (oa *OpenAPI) SetPath(path string) *OpenAPI {
+	oa.Path = path
+	return oa
+}
+
+// SwaggerUI enables the Swagger UI page, its assets are loaded from UiAssets, a CDN
+// unless assets is given
+func (oa *OpenAPI) SwaggerUI(path string, assets ...string) *OpenAPI {
+	oa.UiPath = path
+	if len(assets) > 0 {
+		oa.UiAssets = assets[0]
+	}
+	return oa
+}
+
+func (oa *OpenAPI) Register(router gin.IRouter) {
+	router.GET(oa.Path, func(c *gin.Context) {
+		oa.once.Do(func() {
+			oa.doc = BuildOpenAPI(oa.Info, RegisteredBuilders()...)
+			oa.doc.Servers = oa.Servers
+		})
+		c.JSON(http.StatusOK, oa.doc)
+	})
+	if oa.UiPath != "" {
+		router.GET(oa.UiPath, func(c *gin.Context) {
+			assets := strings.TrimSuffix(oa.UiAssets, "/")
+			if assets == "" {
+				assets = DefaultUiAssets
+			}
+			page := strings.NewReplacer("{{url}}", oa.Path, "{{assets}}", assets).Replace(swaggerUI)
+			c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(page))
+		})
+	}
+}
+
+// BuildOpenAPI documents the api endpoints of builders
+func BuildOpenAPI(info openapi.Info, builders ...*EndpointBuilder) *openapi.Document {
+	doc := openapi.NewDocument(info)
+	schemas := openapi.NewSchemas(doc)
+	schemas.Put("BizError", &openapi.Schema{
+		Type: "object",
+		Properties: map[string]*openapi.Schema{
+			"code":   {Type: "string"},
+			"msg":    {Type: "string"},
+			"name":   {Type: "string", Description: "the invalid field of field errors"},
+			"errors": {Type: "array", Items: openapi.Ref("BizError")},
+		},
+	})
+	schemas.Of(reflect.TypeOf(communal.Page{}))
+
+	for _, builder := range builders {
+		names := make([]string, 0, len(builder.endPoints))
+		for name := range builder.endPoints {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			iep := builder.endPoints[name]
+			meta, ok := iep.(interface{ Meta() *Endpoint })
+			if !ok || meta.Meta().Type == END_POINT_TYPE_HTML {
+				continue
+			}
+			ep := meta.Meta()
+			op := operation(schemas, iep)
+			op.Tags = []string{ep.Module.Name}
+			op.OperationId = util.LowerFirst(ep.Module.Name) + name
+			if op.Summary == "" {
+				op.Summary = name + " " + ep.Module.Name
+			}
+
+			path := pathParamPattern.ReplaceAllString(ep.Path(), "{$1}")
+			for _, match := range pathParamPattern.FindAllStringSubmatch(ep.Path(), -1) {
+				op.Parameters = append([]*openapi.Parameter{{Name: match[1], In: "path", Required: true, Schema: &openapi.Schema{Type: "string"}}}, op.Parameters...)
+			}
+			doc.AddOperation(path, strings.ToLower(ep.HttpMethod), op)
+		}
+	}
+	return doc
+}
+
+func operation(schemas *openapi.Schemas, iep IEndPoint) *openapi.Operation {
+	op := &openapi.Operation{Responses: map[string]*openapi.Response{
+		"400": {Description: "invalid params", Content: openapi.JsonContent(openapi.Ref("BizError"))},
+		"500": {Description: "failure", Content: openapi.JsonContent(resultSchema(nil, false))},
+	}}
+	ok := func(data *openapi.Schema, paged bool) {
+		op.Responses["200"] = &openapi.Response{Description: "ok", Content: openapi.JsonContent(resultSchema(data, paged))}
+	}
+
+	switch ep := iep.(type) {
+	case *Get:
+		ok(schemaOf(schemas, ep.DomainCreator), false)
+	case *Create:
+		domain := schemaOf(schemas, ep.DomainCreator)
+		op.RequestBody = &openapi.RequestBody{Required: true, Content: openapi.JsonContent(domain)}
+		ok(domain, false)
+	case *Update:
+		domain := schemaOf(schemas, idCreator(ep.DomainCreator))
+		op.RequestBody = &openapi.RequestBody{Required: true, Content: openapi.JsonContent(domain)}
+		ok(nil, false)
+	case *Patch:
+		domain := schemaOf(schemas, idCreator(ep.DomainCreator))
+		op.Summary = "patch with a JSON merge patch, only the given fields are updated"
+		op.RequestBody = &openapi.RequestBody{Required: true, Content: map[string]*openapi.MediaType{"application/merge-patch+json": {Schema: domain}}}
+		ok(domain, false)
+	case *List:
+		op.Parameters = queryOf(schemas, ep.FilterCreator)
+		op.Parameters = append(op.Parameters, &openapi.Parameter{Name: "expand", In: "query", Description: "comma separated relations", Schema: &openapi.Schema{Type: "string"}})
+		ok(schemaOf(schemas, ep.ArrayCreator), true)
+	case *Stats:
+		op.Parameters = append(queryOf(schemas, ep.FilterCreator),
+			&openapi.Parameter{Name: "agg", In: "query", Description: "aggregates, e.g. count,sum:amount", Schema: &openapi.Schema{Type: "string"}},
+			&openapi.Parameter{Name: "group", In: "query", Description: "comma separated group columns", Schema: &openapi.Schema{Type: "string"}},
+			&openapi.Parameter{Name: "bucket", In: "query", Description: "day, week or month", Schema: &openapi.Schema{Type: "string"}},
+		)
+		ok(schemas.Of(reflect.TypeOf(communal.Stats{})), false)
+	case *Delete:
+		ok(nil, false)
+	case *History:
+		op.Parameters = append(schemas.QueryParameters(reflect.TypeOf(communal.Page{})),
+			&openapi.Parameter{Name: "at", In: "query", Description: "RFC 3339 time to answer the entity as it was", Schema: &openapi.Schema{Type: "string", Format: "date-time"}})
+		ok(&openapi.Schema{Type: "array", Items: schemas.Of(reflect.TypeOf(communal.History{}))}, true)
+	case *Export:
+		op.Parameters = append(queryOf(schemas, ep.FilterCreator),
+			&openapi.Parameter{Name: "format", In: "query", Schema: &openapi.Schema{Type: "string", Description: "csv or xlsx"}})
+		op.Responses["200"] = &openapi.Response{Description: "ok", Content: map[string]*openapi.MediaType{
+			sheet.ContentType(sheet.FormatCSV):  {Schema: &openapi.Schema{Type: "string", Format: "binary"}},
+			sheet.ContentType(sheet.FormatXLSX): {Schema: &openapi.Schema{Type: "string", Format: "binary"}},
+		}}
+	case *Import:
+		op.RequestBody = &openapi.RequestBody{Required: true, Content: map[string]*openapi.MediaType{"multipart/form-data": {Schema: &openapi.Schema{
+			Type:       "object",
+			Properties: map[string]*openapi.Schema{"file": {Type: "string", Format: "binary"}},
+			Required:   []string{"file"},
+		}}}}
+		ok(schemas.Of(reflect.TypeOf(sheet.Report{})), false)
+	default:
+		ok(nil, false)
+	}
+	return op
+}
+
+func resultSchema(data *openapi.Schema, paged bool) *openapi.Schema {
+	schema := &openapi.Schema{Type: "object", Properties: map[string]*openapi.Schema{
+		"ok":  {Type: "boolean"},
+		"err": openapi.Ref("BizError"),
+	}}
+	if data != nil {
+		schema.Properties["data"] = data
+	}
+	if paged {
+		schema.Properties["page"] = openapi.Ref("Page")
+	}
+	return schema
+}
+
+// probe calls a creator to learn its type, creators of domains normally ignore the context
+func probe(create func(c *gin.Context) (interface{}, error)) (value interface{}) {
+	if create == nil {
+		return nil
+	}
+	defer func() {
+		if recover() != nil {
+			value = nil
+		}
+	}()
+	value, _ = create(&gin.Context{})
+	return value
+}
+
+func idCreator(create IdDomainCreator) DomainCreator {
+	if create == nil {
+		return nil
+	}
+	return func(c *gin.Context) (interface{}, error) {
+		return create(c)
+	}
+}
+
+func schemaOf(schemas *openapi.Schemas, create DomainCreator) *openapi.Schema {
+	value := probe(create)
+	if value == nil {
+		return &openapi.Schema{}
+	}
+	return schemas.Of(reflect.TypeOf(value))
+}
+
+func queryOf(schemas *openapi.Schemas, create FilterCreator) []*openapi.Parameter {
+	value := probe(func(c *gin.Context) (interface{}, error) {
+		return create(c)
+	})
+	if value == nil {
+		return nil
+	}
+	return schemas.QueryParameters(reflect.TypeOf(value))
+}
+
+const swaggerUI = `<!DOCTYPE html>
+<html>
+<head>
+  <meta charset="utf-8">
+  <title>API</title>
+  <link rel="stylesheet" href="{{assets}}/swagger-ui.css">
+</head>
+<body>
+<div id="swagger-ui"></div>
+<script src="{{assets}}/swagger-ui-bundle.js"></script>
+<script>
+  window.ui = SwaggerUIBundle({url: "{{url}}", dom_id: "#swagger-ui"});
+</script>
+</body>
+</html>
+`
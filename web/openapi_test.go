@@ -0,0 +1,82 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sdjnlh/communal"
+	"github.com/sdjnlh/communal/openapi"
+	"github.com/stretchr/testify/assert"
+	"xorm.io/xorm"
+)
+
+type articleFilter struct {
+	communal.Page
+	Title string `form:"title"`
+}
+
+func (filter *articleFilter) Apply(session *xorm.Session) {}
+
+func TestBuildOpenAPI(t *testing.T) {
+	builder := NewEndpointBuilder("article", "article", "/articles")
+	builder.NewGet().Creator(func(c *gin.Context) (interface{}, error) { return &article{}, nil })
+	builder.NewList().Creator(
+		func(c *gin.Context) (communal.Filter, error) { return &articleFilter{}, nil },
+		func(c *gin.Context) (interface{}, error) { return &[]*article{}, nil },
+	)
+	builder.NewCreate().Creator(func(c *gin.Context) (interface{}, error) { return &article{}, nil })
+	del := builder.NewDelete()
+	builder.Api()
+	del.Html()
+
+	doc := BuildOpenAPI(openapi.Info{Title: "test", Version: "1"}, builder)
+	assert.Contains(t, doc.Components.Schemas, "article")
+	assert.Contains(t, doc.Components.Schemas, "Page")
+
+	get := (*doc.Paths["/articles/{id}"])["get"]
+	assert.Equal(t, "articleGet", get.OperationId)
+	assert.Equal(t, "id", get.Parameters[0].Name)
+	assert.Equal(t, "path", get.Parameters[0].In)
+	assert.Equal(t, openapi.Ref("article"), get.Responses["200"].Content["application/json"].Schema.Properties["data"])
+
+	list := (*doc.Paths["/articles"])["get"]
+	data := list.Responses["200"].Content["application/json"].Schema
+	assert.Equal(t, openapi.Ref("article"), data.Properties["data"].Items)
+	assert.Equal(t, openapi.Ref("Page"), data.Properties["page"])
+	var params []string
+	for _, p := range list.Parameters {
+		params = append(params, p.Name)
+	}
+	assert.Contains(t, params, "title")
+	assert.Contains(t, params, "ps")
+
+	assert.NotNil(t, (*doc.Paths["/articles"])["post"].RequestBody)
+	assert.NotContains(t, *doc.Paths["/articles/{id}"], "delete", "html endpoints are not documented")
+}
+
+func TestOpenAPI_Register(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	NewOpenAPI("test", "1").SwaggerUI("/docs").Register(router)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	doc := &openapi.Document{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), doc))
+	assert.Equal(t, openapi.Version, doc.OpenAPI)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/docs", nil))
+	assert.Contains(t, w.Body.String(), `url: "/openapi.json"`)
+	assert.Contains(t, w.Body.String(), DefaultUiAssets+"/swagger-ui-bundle.js")
+
+	router = gin.New()
+	NewOpenAPI("test", "1").SwaggerUI("/docs", "/static/swagger/").Register(router)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/docs", nil))
+	assert.Contains(t, w.Body.String(), `href="/static/swagger/swagger-ui.css"`)
+	assert.NotContains(t, w.Body.String(), "unpkg")
+}
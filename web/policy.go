@@ -0,0 +1,138 @@
+package web
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/sdjnlh/communal"
+	"github.com/sdjnlh/communal/errors"
+	"github.com/sdjnlh/communal/log"
+	"github.com/sdjnlh/communal/policy"
+	"go.uber.org/zap"
+	"xorm.io/xorm"
+)
+
+// SubjectOf answers the claims of the current user, the values set in the context by
+// the state builder, like uid, orgId, role or group
+func SubjectOf(c *gin.Context) policy.Subject {
+	subject := policy.Subject{}
+	for key, value := range c.Keys {
+		subject[key] = value
+	}
+	return subject
+}
+
+// Policy makes the endpoint check policies on the entity it loads, answering 403 when
+// one of them denies. Update, Patch and Delete load the current entity, not the one
+// in the request, Update and Patch check the entity they write too, as Create and
+// Import do. History checks the current entity. List, Stats and Export read rows with
+// a filter, they can not check policies and refuse to register with policies unless
+// Scoped.
+func (ep *Endpoint) Policy(policies ...policy.Policy) *Endpoint {
+	ep.Policies = append(ep.Policies, policies...)
+	return ep
+}
+
+// Scoped tells that the filter of a List, Stats or Export endpoint restricts the rows
+// to those its policies allow, e.g. with an AfterBind hook setting the uid of the
+// user in the filter
+func (ep *Endpoint) Scoped() *Endpoint {
+	ep.scoped = true
+	return ep
+}
+
+// Policy adds policies to all the endpoints of the builder. Delete and History load
+// the entity with the creator of Get unless they have their own. List, Stats and
+// Export must be Scoped.
+func (builder *EndpointBuilder) Policy(policies ...policy.Policy) *EndpointBuilder {
+	builder.each(func(ep *Endpoint) { ep.Policy(policies...) })
+	var get *Get
+	for _, iep := range builder.endPoints {
+		if ep, ok := iep.(*Get); ok {
+			get = ep
+		}
+	}
+	for _, iep := range builder.endPoints {
+		switch ep := iep.(type) {
+		case *Delete:
+			if ep.DomainCreator == nil && get != nil {
+				ep.DomainCreator = get.DomainCreator
+			}
+		case *History:
+			if ep.DomainCreator == nil && get != nil {
+				ep.DomainCreator = get.DomainCreator
+			}
+		}
+	}
+	return builder
+}
+
+// checkScoped panics when policies are set on an endpoint reading rows with a filter
+// which is not Scoped, as the policies would silently not be checked
+func (ep *Endpoint) checkScoped() {
+	if len(ep.Policies) > 0 && !ep.scoped {
+		panic("policies are not checked by " + ep.Name() + ", scope its filter and mark it Scoped")
+	}
+}
+
+// authorize checks the policies of the endpoint on entity
+func (ep *Endpoint) authorize(c *gin.Context, entity interface{}) error {
+	if len(ep.Policies) == 0 {
+		return nil
+	}
+	subject := SubjectOf(c)
+	for _, p := range ep.Policies {
+		if !p.Allow(subject, entity) {
+			log.Ctx(c).Info("policy denied", zap.String("policy", p.Name()), zap.String("endpoint", ep.Name()),
+				zap.Int64("uid", c.GetInt64(communal.UserIdKey)))
+			return errors.Forbidden()
+		}
+	}
+	return nil
+}
+
+// guard checks If-Match and the policies of the endpoint on the current domain, loaded
+// with create only when the request is conditional or the endpoint has policies, and
+// answered then. It is only used for rpc modules, whose rows can not be locked, write
+// guards the changes of the database.
+func (ep *Endpoint) guard(c *gin.Context, id int64, create DomainCreator) (interface{}, error) {
+	header := c.GetHeader("If-Match")
+	if (ep.ETag == nil || header == "") && len(ep.Policies) == 0 {
+		return nil, nil
+	}
+
+	current, err := ep.load(c, id, create)
+	if err != nil {
+		return nil, err
+	}
+	if err = ep.checkETag(header, current); err != nil {
+		return nil, err
+	}
+	return current, ep.authorize(c, current)
+}
+
+// write runs persist, usually the BeforePersist hooks, and change in a tracked
+// transaction of the module. When the request is conditional or the endpoint has
+// policies, they are checked first on the current domain, loaded with create and
+// locked until change is committed.
+func (ep *Endpoint) write(c *gin.Context, op string, id int64, create DomainCreator, persist func() error, change func(ss *xorm.Session) error) error {
+	header := c.GetHeader("If-Match")
+	if (ep.ETag == nil || header == "") && len(ep.Policies) == 0 {
+		if err := persist(); err != nil {
+			return err
+		}
+		return ep.Module.Track(c, op, id, change)
+	}
+
+	current, err := create(c)
+	if err != nil {
+		return err
+	}
+	return ep.Module.TrackIf(c, op, id, current, func() error {
+		if err := ep.checkETag(header, current); err != nil {
+			return err
+		}
+		if err := ep.authorize(c, current); err != nil {
+			return err
+		}
+		return persist()
+	}, change)
+}
@@ -0,0 +1,113 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sdjnlh/communal"
+	"github.com/sdjnlh/communal/log"
+	"github.com/sdjnlh/communal/policy"
+	"github.com/sdjnlh/communal/rpc"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+type ownedPost struct {
+	communal.DBase `xorm:"extends"`
+	Uid            int64  `json:"uid,string"`
+	Title          string `json:"title" valid:"required"`
+}
+
+func TestPolicy(t *testing.T) {
+	core, logs := observer.New(zapcore.InfoLevel)
+	log.Logger.Logger = zap.New(core)
+	defer func() { log.Logger.Logger = zap.NewNop() }()
+	gin.SetMode(gin.TestMode)
+
+	var methods []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		methods = append(methods, r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:])
+		_ = json.NewEncoder(w).Encode(&communal.Result{Ok: true, Data: &ownedPost{Uid: 5, Title: "remote"}})
+	}))
+	defer server.Close()
+	rpc.SetClient(rpc.NewHttpClient(rpc.Config{Services: map[string]rpc.ServiceConfig{"post": {Url: server.URL}}}))
+	defer rpc.SetClient(rpc.NewHttpClient(rpc.Config{}))
+
+	builder := NewEndpointBuilder("post", "post", "/posts").RpcOn()
+	builder.NewGet().Creator(func(c *gin.Context) (interface{}, error) { return &ownedPost{}, nil })
+	builder.NewCreate().Creator(func(c *gin.Context) (interface{}, error) { return &ownedPost{}, nil })
+	builder.NewUpdate().Creator(func(c *gin.Context) (communal.IdInf, error) { return &ownedPost{}, nil })
+	builder.NewDelete()
+	builder.NewList().Creator(func(c *gin.Context) (communal.Filter, error) { return &articleFilter{}, nil }, nil)
+	builder.Api().AlwaysPassRightCheck().Policy(policy.AnyOf("ownerOrAdmin", policy.Owner("uid"), policy.MustExpr("admin", `user.role == "admin"`)))
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		uid, _ := strconv.ParseInt(c.GetHeader("X-Uid"), 10, 64)
+		c.Set(communal.UserIdKey, uid)
+		if role := c.GetHeader("X-Role"); role != "" {
+			c.Set(policy.RoleKey, role)
+		}
+	})
+	// the rows of List are not checked, it must scope its filter
+	assert.Panics(t, func() { builder.GetEndpoint("List").Register(gin.New()) })
+	builder.GetEndpoint("List").(*List).Scoped()
+	builder.RegisterAll(router)
+
+	serve := func(method string, uid string, role string, owner ...string) int {
+		w := httptest.NewRecorder()
+		var body *strings.Reader
+		if len(owner) > 0 {
+			body = strings.NewReader(`{"id":"7","uid":"` + owner[0] + `","title":"mine"}`)
+		} else {
+			body = strings.NewReader("")
+		}
+		path := "/posts/7"
+		if method == http.MethodPost {
+			path = "/posts"
+		}
+		req := httptest.NewRequest(method, path, body)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Uid", uid)
+		req.Header.Set("X-Role", role)
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, serve(http.MethodGet, "5", ""))
+	assert.Equal(t, http.StatusForbidden, serve(http.MethodGet, "6", ""))
+	assert.Equal(t, http.StatusOK, serve(http.MethodGet, "6", "admin"))
+
+	methods = nil
+	// the current entity is checked, not the one claimed by the request
+	assert.Equal(t, http.StatusForbidden, serve(http.MethodPut, "6", "", "6"))
+	assert.Equal(t, []string{"Get"}, methods)
+	assert.Equal(t, http.StatusOK, serve(http.MethodPut, "5", "", "5"))
+	assert.Equal(t, []string{"Get", "Get", "Update"}, methods)
+	// the domain written is checked too
+	methods = nil
+	assert.Equal(t, http.StatusForbidden, serve(http.MethodPut, "5", "", "6"))
+	assert.Equal(t, []string{"Get"}, methods)
+
+	methods = nil
+	assert.Equal(t, http.StatusForbidden, serve(http.MethodPost, "5", "", "6"))
+	assert.Equal(t, http.StatusOK, serve(http.MethodPost, "5", "", "5"))
+	assert.Equal(t, []string{"Create"}, methods)
+
+	methods = nil
+	assert.Equal(t, http.StatusForbidden, serve(http.MethodDelete, "6", ""))
+	assert.Equal(t, http.StatusOK, serve(http.MethodDelete, "5", ""))
+	assert.Equal(t, []string{"Get", "Get", "Delete"}, methods)
+
+	denials := logs.FilterMessage("policy denied").All()
+	if assert.Len(t, denials, 5) {
+		assert.Equal(t, "ownerOrAdmin", denials[0].ContextMap()["policy"])
+		assert.Equal(t, "post:get", denials[0].ContextMap()["endpoint"])
+	}
+}
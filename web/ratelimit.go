@@ -0,0 +1,171 @@
+package web
+
+import (
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sdjnlh/communal/app"
+	"github.com/sdjnlh/communal/log"
+	"github.com/sdjnlh/communal/ratelimit"
+	"github.com/sdjnlh/communal/util"
+	"go.uber.org/zap"
+)
+
+var (
+	routeEndpoints sync.Map
+
+	rateLimitKeysMu sync.RWMutex
+	rateLimitKeys   = map[string]ratelimit.KeyFunc{"ip": ratelimit.ByIP, "uid": ratelimit.ByUid}
+)
+
+// EndpointOf answers the endpoint serving the route of c, nil for routes not
+// registered by an endpoint.
+func EndpointOf(c *gin.Context) *Endpoint {
+	if ep, ok := routeEndpoints.Load(c.Request.Method + " " + c.FullPath()); ok {
+		return ep.(*Endpoint)
+	}
+	return nil
+}
+
+// fullPath answers the route of path registered on router, as answered by
+// gin.Context.FullPath
+func fullPath(router gin.IRouter, relative string) string {
+	group, ok := router.(interface{ BasePath() string })
+	if !ok || relative == "" {
+		return relative
+	}
+	joined := path.Join(group.BasePath(), relative)
+	if strings.HasSuffix(relative, "/") && !strings.HasSuffix(joined, "/") {
+		joined += "/"
+	}
+	return joined
+}
+
+// RegisterRateLimitKey makes a key extractor available to the key of rate limit rules
+func RegisterRateLimitKey(name string, key ratelimit.KeyFunc) {
+	rateLimitKeysMu.Lock()
+	rateLimitKeys[name] = key
+	rateLimitKeysMu.Unlock()
+}
+
+// RateLimitConfig is the ratelimit config section of a web app. Rules are keyed by
+// route, with or without the method, or by endpoint name, e.g.
+//
+//	ratelimit:
+//	  default:
+//	    rate: 100
+//	    per: 1m
+//	  rules:
+//	    POST /login:
+//	      rate: 5
+//	      per: 1m
+//	    sms:send:
+//	      rate: 1
+//	      per: 1m
+//	      algorithm: window
+//	    article:list:
+//	      rate: 10
+//	      per: 1s
+//	      burst: 20
+//	      key: uid
+//	  trustedProxies:
+//	    - 10.0.0.0/8
+//
+// Requests are keyed by the peer address, or by the X-Forwarded-For header when they
+// come from one of TrustedProxies.
+type RateLimitConfig struct {
+	Default        *RateLimitRule
+	Rules          map[string]*RateLimitRule
+	TrustedProxies []string
+}
+
+// RateLimitRule limits Rate requests Per duration, with the token bucket algorithm
+// by default, keyed by ip unless Key names another extractor.
+type RateLimitRule struct {
+	Rate      int
+	Per       time.Duration
+	Burst     int
+	Algorithm string
+	Key       string
+}
+
+func (rule *RateLimitRule) rule(name string) *ratelimit.Rule {
+	rateLimitKeysMu.RLock()
+	key := rateLimitKeys[rule.Key]
+	rateLimitKeysMu.RUnlock()
+	return &ratelimit.Rule{
+		Name:  name,
+		Limit: ratelimit.Limit{Rate: rule.Rate, Per: rule.Per, Burst: rule.Burst, Algorithm: rule.Algorithm},
+		Key:   key,
+	}
+}
+
+// match answers the rule of the route of c, by method and route, route and
+// endpoint name in turn, then the default one.
+func (conf *RateLimitConfig) match(c *gin.Context) *ratelimit.Rule {
+	route := c.FullPath()
+	names := []string{c.Request.Method + " " + route, route}
+	if ep := EndpointOf(c); ep != nil {
+		names = append(names, ep.Name())
+	}
+	for _, name := range names {
+		// keys of config maps are lower cased
+		if rule := conf.Rules[strings.ToLower(name)]; rule != nil {
+			return rule.rule(name)
+		}
+	}
+	if conf.Default != nil {
+		return conf.Default.rule("default")
+	}
+	return nil
+}
+
+// RateLimitHandler limits requests by the ratelimit config of webapp, counting them
+// in the redis of the app when configured, otherwise in memory.
+func RateLimitHandler(webapp *app.Web) gin.HandlerFunc {
+	conf := &RateLimitConfig{}
+	if webapp.Started() {
+		if webapp.RawConfig != nil {
+			_ = webapp.RawConfig.UnmarshalKey("ratelimit", conf)
+		}
+	} else {
+		webapp.Subscribe("ratelimit", conf)
+	}
+
+	// the redis of the app is set when it starts, after the handler is made
+	var once sync.Once
+	var handler gin.HandlerFunc
+	return func(c *gin.Context) {
+		once.Do(func() {
+			if webapp.Redis != nil {
+				handler = RateLimit(ratelimit.NewRedis(webapp.Redis), conf)
+			} else {
+				handler = RateLimit(ratelimit.NewMemory(), conf)
+			}
+		})
+		handler(c)
+	}
+}
+
+// RateLimit limits requests by the rules of conf with limiter, keying them by ip behind
+// the trusted proxies of conf. Limited requests are failed like the endpoint of their
+// route fails, with ApiFail for other routes.
+func RateLimit(limiter ratelimit.Limiter, conf *RateLimitConfig) gin.HandlerFunc {
+	proxies, err := util.ParseProxies(conf.TrustedProxies)
+	if err != nil {
+		log.Logger.Warn("invalid trusted proxy", zap.Error(err))
+	}
+	return ratelimit.Handler(limiter, conf.match, ratelimit.Options{Proxies: proxies, Fail: failRoute})
+}
+
+// failRoute fails a request aborted by a middleware the way the endpoint of its route does
+func failRoute(c *gin.Context, err error) {
+	if ep := EndpointOf(c); ep != nil && ep.Fail != nil {
+		ep.Fail(c, ep, err)
+		return
+	}
+	ApiFail(c, err)
+}
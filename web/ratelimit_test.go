@@ -0,0 +1,50 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sdjnlh/communal/ratelimit"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	conf := &RateLimitConfig{
+		Default: &RateLimitRule{Rate: 100, Per: time.Minute},
+		Rules: map[string]*RateLimitRule{
+			"post /login":  {Rate: 1, Per: time.Minute},
+			"comment:list": {Rate: 2, Per: time.Minute, Algorithm: ratelimit.SlidingWindow, Key: "uid"},
+		},
+	}
+	router := gin.New()
+	router.Use(RateLimit(ratelimit.NewMemory(), conf))
+	router.POST("/login", func(c *gin.Context) { c.Status(http.StatusOK) })
+	router.GET("/ping", func(c *gin.Context) { c.Status(http.StatusOK) })
+	builder := NewEndpointBuilder("comment", "comment", "/comments")
+	builder.NewList().Creator(nil, nil)
+	builder.Api()
+	builder.GetEndpoint("List").(*List).Endpoint.register(router.Group("/api"), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	serve := func(method string, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		return w
+	}
+
+	assert.Equal(t, http.StatusOK, serve(http.MethodPost, "/login").Code)
+	assert.Equal(t, http.StatusTooManyRequests, serve(http.MethodPost, "/login").Code)
+
+	assert.Equal(t, "2", serve(http.MethodGet, "/api/comments").Header().Get("RateLimit-Limit"))
+	serve(http.MethodGet, "/api/comments")
+	assert.Equal(t, http.StatusTooManyRequests, serve(http.MethodGet, "/api/comments").Code)
+
+	w := serve(http.MethodGet, "/ping")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "100", w.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "/api/comments", fullPath(router.Group("/api"), "/comments"))
+	assert.Equal(t, "/api/comments/", fullPath(router.Group("/api/"), "/comments/"))
+}
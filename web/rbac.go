@@ -0,0 +1,39 @@
+package web
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/sdjnlh/communal"
+	"github.com/sdjnlh/communal/log"
+	"github.com/sdjnlh/communal/rbac"
+	"go.uber.org/zap"
+)
+
+// RbacRightChecker grants the requests of users having a permission matching the name
+// of the endpoint, {module}:{rightKey}. It reads the user id from the context, so it
+// works with the jwt and the session state stores alike.
+func RbacRightChecker(r *rbac.Rbac) func(c *gin.Context, ep *Endpoint) bool {
+	return func(c *gin.Context, ep *Endpoint) bool {
+		uid := c.GetInt64(communal.UserIdKey)
+		if uid <= 0 {
+			return false
+		}
+		granted, err := r.Can(c, uid, ep.Name())
+		if err != nil {
+			log.Ctx(c).Error("fail to check permission", zap.Int64("uid", uid), zap.String("permission", ep.Name()), zap.Error(err))
+			return false
+		}
+		if !granted {
+			log.Ctx(c).Info("permission denied", zap.Int64("uid", uid), zap.String("permission", ep.Name()))
+		}
+		return granted
+	}
+}
+
+func (ep *Endpoint) Rbac(r *rbac.Rbac) *Endpoint {
+	ep.RightChecker = RbacRightChecker(r)
+	return ep
+}
+
+func (builder *EndpointBuilder) Rbac(r *rbac.Rbac) *EndpointBuilder {
+	return builder.SetRightChecker(RbacRightChecker(r))
+}
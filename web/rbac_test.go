@@ -0,0 +1,94 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sdjnlh/communal"
+	"github.com/sdjnlh/communal/log"
+	"github.com/sdjnlh/communal/rbac"
+	"github.com/sdjnlh/communal/rpc"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestRbacRightChecker(t *testing.T) {
+	log.Logger.Logger = zap.NewNop()
+	gin.SetMode(gin.TestMode)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(&communal.Result{Ok: true, Data: &post{Title: "remote"}})
+	}))
+	defer server.Close()
+	rpc.SetClient(rpc.NewHttpClient(rpc.Config{Services: map[string]rpc.ServiceConfig{"post": {Url: server.URL}}}))
+	defer rpc.SetClient(rpc.NewHttpClient(rpc.Config{}))
+
+	ctx := context.Background()
+	r := rbac.New(rbac.NewMemoryStore(), rbac.NewMemoryCache())
+	reader := &rbac.Role{Name: "reader"}
+	assert.NoError(t, r.AddRole(ctx, reader))
+	assert.NoError(t, r.Grant(ctx, reader.Id, "post:*"))
+	assert.NoError(t, r.Assign(ctx, 1, reader.Id))
+
+	builder := NewEndpointBuilder("post", "post", "/posts").RpcOn()
+	builder.NewGet().Creator(func(c *gin.Context) (interface{}, error) { return &post{}, nil })
+	builder.Api().Rbac(r)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		if uid := c.GetHeader("X-Uid"); uid == "1" {
+			c.Set(communal.UserIdKey, int64(1))
+		} else if uid == "2" {
+			c.Set(communal.UserIdKey, int64(2))
+		}
+	})
+	builder.RegisterAll(router)
+
+	serve := func(uid string) int {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/posts/7", nil)
+		req.Header.Set("X-Uid", uid)
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+	assert.Equal(t, http.StatusOK, serve("1"))
+	assert.Equal(t, http.StatusUnauthorized, serve("2"))
+	assert.Equal(t, http.StatusUnauthorized, serve(""))
+}
+
+func TestAdminRightChecker(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	check := func(rights interface{}) bool {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		if rights != nil {
+			c.Set(communal.UserRightKey, rights)
+		}
+		return AdminRightChecker(c, "post:get")
+	}
+	assert.True(t, check("post:list,post:get"))
+	assert.True(t, check([]interface{}{"post:*"}))
+	assert.True(t, check([]string{"*"}))
+	assert.True(t, check(map[string]interface{}{"post:get": true}))
+	assert.False(t, check(map[string]interface{}{"post:get": false}))
+	assert.False(t, check("post:list"))
+	// without rights nor sessions
+	assert.False(t, check(nil))
+}
+
+func TestDefaultRightChecker(t *testing.T) {
+	log.Logger.Logger = zap.NewNop()
+	gin.SetMode(gin.TestMode)
+
+	builder := NewEndpointBuilder("post", "post", "/posts").RpcOn()
+	builder.NewGet().Creator(func(c *gin.Context) (interface{}, error) { return &post{}, nil })
+	builder.Api()
+	router := gin.New()
+	builder.RegisterAll(router)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/posts/7", nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
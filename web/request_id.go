@@ -0,0 +1,46 @@
+package web
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sdjnlh/communal/log"
+)
+
+const maxRequestIdLen = 128
+
+// RequestId accepts the X-Request-ID of the request or generates one, stores it in
+// the gin context and the context of the request and echoes it in the response.
+// Loggers got with log.Ctx during the request add it to their entries.
+func RequestId(c *gin.Context) {
+	requestId := c.GetHeader(log.RequestIdHeader)
+	if !validRequestId(requestId) {
+		requestId = NewRequestId()
+	}
+
+	c.Set(log.RequestIdKey, requestId)
+	c.Request = c.Request.WithContext(log.WithRequestId(c.Request.Context(), requestId))
+	c.Header(log.RequestIdHeader, requestId)
+	c.Next()
+}
+
+// NewRequestId generates a random request id
+func NewRequestId() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// validRequestId accepts printable ascii ids, so that they are safe to log and echo
+func validRequestId(id string) bool {
+	if id == "" || len(id) > maxRequestIdLen {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
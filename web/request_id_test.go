@@ -0,0 +1,59 @@
+package web
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sdjnlh/communal"
+	bizerrors "github.com/sdjnlh/communal/errors"
+	"github.com/sdjnlh/communal/log"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestRequestId(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	log.Logger.Logger = zap.New(core)
+	defer func() { log.Logger.Logger = zap.NewNop() }()
+	gin.SetMode(gin.TestMode)
+
+	var fromRequest string
+	router := gin.New()
+	router.Use(RequestId)
+	router.GET("/fail", func(c *gin.Context) {
+		fromRequest = communal.RequestIdFrom(c.Request.Context())
+		log.Ctx(c).Info("failing")
+		ApiFail(c, errors.New("boom"))
+	})
+	router.GET("/missing", func(c *gin.Context) {
+		ApiFail(c, bizerrors.NotFound())
+	})
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/fail", nil)
+	req.Header.Set(log.RequestIdHeader, "abc-1")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, "abc-1", w.Header().Get(log.RequestIdHeader))
+	assert.Equal(t, "abc-1", fromRequest)
+	assert.Contains(t, w.Body.String(), `"requestId":"abc-1"`)
+	assert.Equal(t, "abc-1", logs.All()[0].ContextMap()[log.RequestIdKey])
+
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/missing", nil)
+	req.Header.Set(log.RequestIdHeader, "abc-2")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Contains(t, w.Body.String(), `"code":"c.NOT_FOUND"`)
+	assert.Contains(t, w.Body.String(), `"requestId":"abc-2"`, "client errors carry the request id too")
+
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/fail", nil)
+	req.Header.Set(log.RequestIdHeader, "bad id\n")
+	router.ServeHTTP(w, req)
+	assert.Len(t, w.Header().Get(log.RequestIdHeader), 32, "invalid ids are replaced")
+}
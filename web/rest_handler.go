@@ -34,25 +34,25 @@ func (handler *RestHandler) Fail(c *gin.Context) {
 }
 
 func (handler *RestHandler) FailWithCode(c *gin.Context, code string) {
-	c.AbortWithStatusJSON(http.StatusInternalServerError, errors.SimpleBizError{Code: code})
+	ApiFail(c, &errors.SimpleBizError{Code: code})
 }
 
 func (handler *RestHandler) FailWithMessage(c *gin.Context, code string, message string) {
-	c.AbortWithStatusJSON(http.StatusInternalServerError, errors.SimpleBizError{Code: code, Msg: message})
+	ApiFail(c, &errors.SimpleBizError{Code: code, Msg: message})
 }
 
 func (handler *RestHandler) FailWithError(c *gin.Context, err error) {
-	log.Logger.Warn("api fail", zap.Error(err))
-	c.AbortWithStatus(http.StatusInternalServerError)
+	logFailure(c, "api fail", err)
+	ApiFail(c, err)
 }
 
 func (handler *RestHandler) FailWithBizError(c *gin.Context, err errors.BizError) {
-	log.Logger.Warn("api fail", zap.Error(err))
-	c.AbortWithStatusJSON(http.StatusInternalServerError, err)
+	logFailure(c, "api fail", err)
+	ApiFail(c, err)
 }
 
 func (handler *RestHandler) RPCError(c *gin.Context) {
-	c.AbortWithStatusJSON(http.StatusInternalServerError, errors.RPCFailed())
+	ApiFail(c, errors.RPCFailed())
 }
 
 func (handler *RestHandler) BadRequest(c *gin.Context) {
@@ -60,8 +60,11 @@ func (handler *RestHandler) BadRequest(c *gin.Context) {
 }
 
 func (handler *RestHandler) BadRequestWithError(c *gin.Context, err error) {
-	log.Logger.Warn("api fail", zap.Error(err))
-	c.AbortWithStatusJSON(http.StatusBadRequest, err)
+	logFailure(c, "api fail", err)
+	if _, ok := err.(errors.BizError); !ok {
+		err = errors.InvalidParams()
+	}
+	c.AbortWithStatusJSON(http.StatusBadRequest, errors.Public(err))
 }
 
 func (handler *RestHandler) Unauthorized(c *gin.Context) {
@@ -78,8 +81,8 @@ func (handler *RestHandler) NotFound(c *gin.Context) {
 
 func (handler *RestHandler) ResultWithError(c *gin.Context, result communal.IResult, err error) {
 	if err != nil {
-		log.Logger.Warn("api fail", zap.Error(err))
-		c.AbortWithStatus(http.StatusInternalServerError)
+		logFailure(c, "api fail", err)
+		ApiFail(c, err)
 	} else {
 		handler.Result(c, result)
 	}
@@ -98,38 +101,56 @@ func (handler *RestHandler) Result(c *gin.Context, result communal.IResult) {
 	}
 
 	if result.Err() != nil {
-		switch result.Err().GetCode() {
-		case errors.Common_InvalidParams:
-			c.AbortWithStatusJSON(http.StatusBadRequest, result.Err())
-			break
-		case errors.Common_NotFound:
-			c.AbortWithStatusJSON(http.StatusNotFound, result.Err())
-			break
-		case errors.Common_Unauthorized:
-			c.AbortWithStatusJSON(http.StatusUnauthorized, result.Err())
-			break
-		case errors.Common_Forbidden:
-			c.AbortWithStatusJSON(http.StatusForbidden, result.Err())
-			break
-		default:
-			c.AbortWithStatusJSON(http.StatusInternalServerError, result.Err())
-			break
-		}
-
+		ApiFail(c, result.Err())
 		return
 	}
 
 	c.AbortWithStatus(http.StatusInternalServerError)
 }
 
+// logFailure logs err, with its cause and stack, at the level registered for its code
+func logFailure(c *gin.Context, msg string, err error) {
+	recordFailure(c, err)
+	logger := log.Ctx(c)
+	fields := []zap.Field{zap.String("error", err.Error())}
+	if stack := errors.StackOf(err); stack != "" {
+		fields = append(fields, zap.String("stack", stack))
+	}
+	switch errors.LevelOf(err) {
+	case errors.LevelDebug:
+		logger.Debug(msg, fields...)
+	case errors.LevelInfo:
+		logger.Info(msg, fields...)
+	case errors.LevelWarn:
+		logger.Warn(msg, fields...)
+	default:
+		logger.Error(msg, fields...)
+	}
+}
+
+// clientFailure is the body of client errors, the BizError with the request id
+type clientFailure struct {
+	*errors.SimpleBizError
+	RequestId string `json:"requestId,omitempty"`
+}
+
+// ApiFail answers err with the status registered for its code. Details which are not
+// public, e.g. of server errors and errors which are not BizErrors, are replaced by the
+// default message. Failures carry the request id to find their logs.
 func ApiFail(c *gin.Context, err error) {
-	if be, ok := err.(errors.BizError); ok {
-		if be.GetCode() == errors.Common_InvalidParams {
-			c.AbortWithStatusJSON(http.StatusBadRequest, err)
-			return
-		}
+	recordFailure(c, err)
+	status := errors.StatusOf(err)
+	be := errors.Public(err)
+	requestId := communal.RequestIdFrom(c)
+	if status >= http.StatusInternalServerError {
+		c.AbortWithStatusJSON(status, &communal.Result{Ok: false, Error: be, RequestId: requestId})
+		return
+	}
+	if sbe, ok := be.(*errors.SimpleBizError); ok && requestId != "" {
+		c.AbortWithStatusJSON(status, &clientFailure{SimpleBizError: sbe, RequestId: requestId})
+		return
 	}
-	c.AbortWithStatusJSON(http.StatusInternalServerError, &communal.Result{Ok: false, Error: errors.ServerErrorWithMsg(err.Error())})
+	c.AbortWithStatusJSON(status, be)
 }
 
 func (handler *RestHandler) ValidateInt64Id(c *gin.Context) (id int64, err error) {
@@ -0,0 +1,49 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sdjnlh/communal"
+	"github.com/sdjnlh/communal/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApiFail(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	errors.Register(errors.Code{Code: "order.CLOSED", Status: http.StatusUnprocessableEntity, Message: "order closed", Level: errors.LevelInfo, Public: true})
+
+	fail := func(err error) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Set(communal.RequestIdKey, "r1")
+		ApiFail(c, err)
+		return w
+	}
+
+	w := fail(fmt.Errorf("pq: password authentication failed for user admin"))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.JSONEq(t, `{"ok":false,"err":{"code":"c.SERVER_ERROR","msg":"server error"},"requestId":"r1"}`, w.Body.String())
+
+	w = fail(&errors.SimpleBizError{Code: "order.CLOSED", Msg: "order 7 is closed"})
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.JSONEq(t, `{"code":"order.CLOSED","msg":"order 7 is closed","requestId":"r1"}`, w.Body.String())
+
+	for err, status := range map[error]int{
+		errors.NotFound():        http.StatusNotFound,
+		errors.Unauthorized():    http.StatusUnauthorized,
+		errors.Forbidden():       http.StatusForbidden,
+		errors.TooManyRequests(): http.StatusTooManyRequests,
+	} {
+		assert.Equal(t, status, fail(err).Code, err.(errors.BizError).GetCode())
+	}
+
+	w = httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/orders/7", nil)
+	HtmlFail(c, "order.html", errors.Unauthorized())
+	assert.Equal(t, "/login.html", w.Header().Get("Location"))
+}
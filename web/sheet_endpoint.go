@@ -0,0 +1,363 @@
+package web
+
+import (
+	"database/sql"
+	"io"
+	"net/http"
+	"reflect"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sdjnlh/communal"
+	"github.com/sdjnlh/communal/errors"
+	"github.com/sdjnlh/communal/log"
+	"github.com/sdjnlh/communal/sheet"
+	"github.com/sdjnlh/communal/validator"
+	"go.uber.org/zap"
+)
+
+const (
+	exportFlushRows   = 200
+	defaultImportSize = 100
+)
+
+// Export streams the rows matched by the filter as csv or xlsx, chosen by the format query param
+type Export struct {
+	FilterCreator FilterCreator
+	DomainCreator DomainCreator
+	*Endpoint
+}
+
+func (ep *Export) Register(router gin.IRouter, handlers ...gin.HandlerFunc) {
+	if ep.FilterCreator == nil || ep.DomainCreator == nil {
+		panic("filter and domain creator needed for Export endpoint")
+	}
+	ep.checkScoped()
+	ep.checkHooks(ep)
+	ep.Endpoint.register(router, append(handlers, ep.Do)...)
+}
+
+func (ep *Export) Creator(filterCreator FilterCreator, domainCreator DomainCreator) *Export {
+	ep.FilterCreator = filterCreator
+	ep.DomainCreator = domainCreator
+	return ep
+}
+
+func (ep *Export) Do(c *gin.Context) {
+	log.Ctx(c).Debug("export " + ep.Module.Name)
+	if !ep.RightChecker(c, ep.Endpoint) {
+		ep.Fail(c, ep.Endpoint, errors.Unauthorized())
+		return
+	}
+
+	format := sheet.Format(c.DefaultQuery("format", sheet.FormatCSV))
+	if format == "" {
+		ep.Fail(c, ep.Endpoint, errors.InvalidParams().AddError(errors.InvalidField("format", "unsupported", "format should be csv or xlsx")))
+		return
+	}
+
+	filter, err := ep.FilterCreator(c)
+	if err != nil {
+		ep.Fail(c, ep.Endpoint, err)
+		return
+	}
+	if err = ep.hook(c, ep.Hooks.beforeBind, filter); err != nil {
+		ep.Fail(c, ep.Endpoint, err)
+		return
+	}
+	if err = ep.Bind(c, filter); err != nil {
+		ep.Fail(c, ep.Endpoint, err)
+		return
+	}
+	if err = ep.hook(c, ep.Hooks.afterBind, filter); err != nil {
+		ep.Fail(c, ep.Endpoint, err)
+		return
+	}
+	domain, err := ep.DomainCreator(c)
+	if err != nil {
+		ep.Fail(c, ep.Endpoint, err)
+		return
+	}
+	if ep.Module.RpcOn {
+		ep.Fail(c, ep.Endpoint, errors.RPCFailedWithMsg("export is not available for rpc modules"))
+		return
+	}
+
+	// conditions of the filter only, export is never paged
+	cs := ep.Module.Db.NewSession()
+	defer cs.Close()
+	filter.Apply(cs)
+
+	ss := ep.Module.Db.NewSession()
+	defer ss.Close()
+	rows, err := ss.Table(ep.Module.TableName).Where(cs.Conds()).Asc("id").Rows(domain)
+	if err != nil {
+		ep.Fail(c, ep.Endpoint, err)
+		return
+	}
+	defer rows.Close()
+
+	c.Header("Content-Type", sheet.ContentType(format))
+	c.Header("Content-Disposition", `attachment; filename="`+ep.Module.Name+"."+format+`"`)
+	c.Status(http.StatusOK)
+
+	mapping := sheet.NewMapping(domain)
+	w, err := sheet.NewWriter(format, c.Writer)
+	if err == nil {
+		err = w.Write(mapping.Header())
+	}
+
+	bean := reflect.ValueOf(domain).Elem()
+	for count := 1; err == nil && rows.Next(); count++ {
+		bean.Set(reflect.Zero(bean.Type()))
+		if err = rows.Scan(domain); err != nil {
+			break
+		}
+		err = w.Write(mapping.Record(domain))
+		if err == nil && count%exportFlushRows == 0 {
+			err = w.Flush()
+			c.Writer.Flush()
+		}
+	}
+	// xorm answers sql.ErrNoRows once all rows are read
+	if err == nil && rows.Err() != sql.ErrNoRows {
+		err = rows.Err()
+	}
+	if err == nil {
+		err = w.Close()
+	}
+	if err != nil {
+		// the response has been started, it can only be cut short
+		log.Ctx(c).Error("fail to export "+ep.Module.Name, zap.Error(err))
+	}
+}
+
+// Import inserts the rows of an uploaded csv or xlsx file, sent as the multipart field "file".
+// Every row is validated with RuleSet, valid rows are inserted in batches of BatchSize
+// and the per row errors are answered as a sheet.Report. The id, crt, lut, status and dtd
+// columns are ignored, the base fields of domains having InitBaseFields are initialized.
+// Hooks run on every row as for Create, an error failing the row.
+type Import struct {
+	DomainCreator DomainCreator
+	RuleSet       string
+	BatchSize     int
+	*Endpoint
+}
+
+func (ep *Import) Register(router gin.IRouter, handlers ...gin.HandlerFunc) {
+	if ep.DomainCreator == nil {
+		panic("domain creator needed for Import endpoint")
+	}
+	ep.checkHooks(ep)
+	ep.Endpoint.register(router, append(handlers, ep.Do)...)
+}
+
+func (ep *Import) Creator(domainCreator DomainCreator) *Import {
+	ep.DomainCreator = domainCreator
+	return ep
+}
+
+func (ep *Import) SetRuleSet(ruleSet string) *Import {
+	ep.RuleSet = ruleSet
+	return ep
+}
+
+func (ep *Import) SetBatchSize(size int) *Import {
+	ep.BatchSize = size
+	return ep
+}
+
+type importRow struct {
+	row    int
+	domain interface{}
+}
+
+func (ep *Import) Do(c *gin.Context) {
+	log.Ctx(c).Debug("import " + ep.Module.Name)
+	if !ep.RightChecker(c, ep.Endpoint) {
+		ep.Fail(c, ep.Endpoint, errors.Unauthorized())
+		return
+	}
+	if ep.Module.RpcOn {
+		ep.Fail(c, ep.Endpoint, errors.RPCFailedWithMsg("import is not available for rpc modules"))
+		return
+	}
+
+	file, header, err := c.Request.FormFile("file")
+	if err != nil {
+		ep.Fail(c, ep.Endpoint, errors.InvalidParams().AddError(errors.InvalidField("file", "empty", "no file uploaded")))
+		return
+	}
+	defer file.Close()
+
+	format := sheet.Format(c.DefaultQuery("format", header.Filename))
+	if format == "" {
+		ep.Fail(c, ep.Endpoint, errors.InvalidParams().AddError(errors.InvalidField("format", "unsupported", "format should be csv or xlsx")))
+		return
+	}
+	reader, err := sheet.NewReader(format, file, header.Size)
+	if err != nil {
+		ep.Fail(c, ep.Endpoint, errors.InvalidParams().AddError(errors.InvalidField("file", errors.FIELD_BAD_FORMAT, err.Error())))
+		return
+	}
+	head, err := reader.Read()
+	if err != nil {
+		ep.Fail(c, ep.Endpoint, errors.InvalidParams().AddError(errors.InvalidField("file", errors.FIELD_BAD_FORMAT, "no header row")))
+		return
+	}
+
+	probe, err := ep.DomainCreator(c)
+	if err != nil {
+		ep.Fail(c, ep.Endpoint, err)
+		return
+	}
+	binder := sheet.NewMapping(probe).Bind(head).Ignore(communal.ServerColumns...)
+
+	report := &sheet.Report{}
+	var batch []importRow
+	for row := 2; ; row++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// earlier batches are saved, the rest of the file is reported unreadable
+			report.Fail(row, errors.InvalidParams().AddError(errors.InvalidField("file", errors.FIELD_BAD_FORMAT, err.Error())))
+			break
+		}
+		if isBlank(record) {
+			continue
+		}
+		report.Total++
+
+		domain, err := ep.DomainCreator(c)
+		if err != nil {
+			ep.Fail(c, ep.Endpoint, err)
+			return
+		}
+		if init, ok := domain.(interface{ InitBaseFields() }); ok {
+			init.InitBaseFields()
+		}
+		if err = ep.hook(c, ep.Hooks.beforeBind, domain); err == nil {
+			if err = binder.Decode(record, domain); err == nil {
+				err = validator.ValidateStruct(domain, ep.RuleSet)
+			}
+		}
+		if err == nil {
+			if err = ep.hook(c, ep.Hooks.afterBind, domain); err == nil {
+				if err = ep.hook(c, ep.Hooks.beforePersist, domain); err == nil {
+					err = ep.authorize(c, domain)
+				}
+			}
+		}
+		if err != nil {
+			report.Fail(row, asBizError(err))
+			continue
+		}
+
+		if batch = append(batch, importRow{row: row, domain: domain}); len(batch) >= ep.batchSize() {
+			ep.insert(c, batch, report)
+			batch = batch[:0]
+		}
+	}
+	ep.insert(c, batch, report)
+
+	ep.Success(c, ep.Endpoint, &communal.Result{Ok: true, Data: report})
+}
+
+func (ep *Import) batchSize() int {
+	if ep.BatchSize > 0 {
+		return ep.BatchSize
+	}
+	return defaultImportSize
+}
+
+// insert writes a batch with one multi row insert, the rows of a failed batch are all
+// reported. Rows failing AfterPersist hooks are reported although they are saved.
+func (ep *Import) insert(c *gin.Context, batch []importRow, report *sheet.Report) {
+	if len(batch) == 0 {
+		return
+	}
+
+	rows := reflect.MakeSlice(reflect.SliceOf(reflect.TypeOf(batch[0].domain)), 0, len(batch))
+	for _, item := range batch {
+		rows = reflect.Append(rows, reflect.ValueOf(item.domain))
+	}
+
+	ss := ep.Module.Db.NewSession()
+	defer ss.Close()
+	err := ss.Begin()
+	if err == nil {
+		if _, err = ss.Table(ep.Module.TableName).Insert(rows.Interface()); err == nil {
+			err = ss.Commit()
+		}
+	}
+	if err != nil {
+		log.Ctx(c).Error("fail to import "+ep.Module.Name, zap.Error(err))
+		_ = ss.Rollback()
+		for _, item := range batch {
+			report.Fail(item.row, errors.ServerErrorWithMsg("fail to save row"))
+		}
+		return
+	}
+	report.Imported += len(batch)
+	for _, item := range batch {
+		if err = ep.hook(c, ep.Hooks.afterPersist, item.domain); err != nil {
+			report.Fail(item.row, asBizError(err))
+		}
+	}
+}
+
+func isBlank(record []string) bool {
+	for _, value := range record {
+		if value != "" {
+			return false
+		}
+	}
+	return true
+}
+
+func asBizError(err error) errors.BizError {
+	var be errors.BizError
+	if errors.As(err, &be) {
+		return be
+	}
+	return errors.Wrap(err, errors.Common_ServerError)
+}
+
+func (builder *EndpointBuilder) NewExport(endpointName ...string) *Export {
+	name := "Export"
+	if len(endpointName) > 0 {
+		name = endpointName[0]
+	}
+
+	var ep = &Export{
+		Endpoint: &Endpoint{
+			Module:     builder.Module,
+			HttpMethod: "Get",
+			RpcMethod:  "Export",
+			RouterPath: "/export",
+			RightKey:   "export",
+		},
+	}
+	builder.endPoints[name] = IEndPoint(ep)
+	return ep
+}
+
+func (builder *EndpointBuilder) NewImport(endpointName ...string) *Import {
+	name := "Import"
+	if len(endpointName) > 0 {
+		name = endpointName[0]
+	}
+
+	var ep = &Import{
+		Endpoint: &Endpoint{
+			Module:     builder.Module,
+			HttpMethod: "Post",
+			RpcMethod:  "Import",
+			RouterPath: "/import",
+			RightKey:   "import",
+		},
+	}
+	builder.endPoints[name] = IEndPoint(ep)
+	return ep
+}
@@ -0,0 +1,140 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sdjnlh/communal"
+	"github.com/sdjnlh/communal/internal/dbtest"
+	"github.com/sdjnlh/communal/log"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"xorm.io/xorm"
+)
+
+type sheetPost struct {
+	communal.Base `xorm:"extends"`
+	Title         string `json:"title" valid:"required"`
+}
+
+type sheetFilter struct {
+	communal.Page
+	Title string `form:"title"`
+}
+
+func (filter *sheetFilter) Apply(session *xorm.Session) {
+	if filter.Title != "" {
+		session.Where("title = ?", filter.Title)
+	}
+}
+
+func sheetRouter(configure func(builder *EndpointBuilder)) (*gin.Engine, *dbtest.DB) {
+	log.Logger.Logger = zap.NewNop()
+	gin.SetMode(gin.TestMode)
+
+	engine, db := dbtest.Open()
+	builder := NewEndpointBuilder("post", "post", "/posts")
+	builder.Module.SetDB(engine)
+	configure(builder)
+	builder.Api().AlwaysPassRightCheck()
+	router := gin.New()
+	builder.RegisterAll(router)
+	return router, db
+}
+
+func TestExport(t *testing.T) {
+	router, db := sheetRouter(func(builder *EndpointBuilder) {
+		builder.NewExport().Creator(
+			func(c *gin.Context) (communal.Filter, error) { return &sheetFilter{}, nil },
+			func(c *gin.Context) (interface{}, error) { return &sheetPost{}, nil },
+		)
+	})
+	db.Rows("FROM `post`", []string{"id", "status", "title"},
+		[]interface{}{int64(3), int64(1), "first"}, []interface{}{int64(4), int64(1), "second"})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/posts/export", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `attachment; filename="post.csv"`, w.Header().Get("Content-Disposition"))
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	assert.Len(t, lines, 3)
+	assert.Equal(t, "\ufeffid,crt,lut,status,title", strings.TrimSpace(lines[0]))
+	assert.True(t, strings.HasPrefix(lines[1], "3,"))
+	assert.True(t, strings.HasSuffix(strings.TrimSpace(lines[2]), ",1,second"))
+}
+
+func importRequest(t *testing.T, content string) *http.Request {
+	body := &bytes.Buffer{}
+	mw := multipart.NewWriter(body)
+	fw, err := mw.CreateFormFile("file", "posts.csv")
+	assert.NoError(t, err)
+	_, _ = fw.Write([]byte(content))
+	assert.NoError(t, mw.Close())
+	req := httptest.NewRequest(http.MethodPost, "/posts/import", body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	return req
+}
+
+func TestImport(t *testing.T) {
+	var persisted []string
+	router, db := sheetRouter(func(builder *EndpointBuilder) {
+		builder.NewImport().Creator(func(c *gin.Context) (interface{}, error) { return &sheetPost{}, nil }).
+			SetBatchSize(2).
+			BeforePersist(func(c *gin.Context, ep *Endpoint, domain interface{}) error {
+				persisted = append(persisted, domain.(*sheetPost).Title)
+				return nil
+			})
+	})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, importRequest(t, "id,status,title\n99,0,a\n99,0,\n99,0,b\n99,0,c\n"))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	report := importReport(t, w)
+	assert.Equal(t, 4, report.Total)
+	assert.Equal(t, 3, report.Imported)
+	assert.Len(t, report.Errors, 1)
+	assert.Equal(t, 3, report.Errors[0].Row)
+	assert.Equal(t, []string{"a", "b", "c"}, persisted)
+
+	inserts := db.Find("INSERT INTO `post`")
+	assert.Len(t, inserts, 2)
+	for _, arg := range inserts[0].Args {
+		assert.NotEqual(t, int64(99), arg, "imported id")
+	}
+	assert.Contains(t, inserts[0].Args, int64(1), "status reset")
+}
+
+func TestImport_ReadError(t *testing.T) {
+	router, db := sheetRouter(func(builder *EndpointBuilder) {
+		builder.NewImport().Creator(func(c *gin.Context) (interface{}, error) { return &sheetPost{}, nil }).SetBatchSize(1)
+	})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, importRequest(t, "title\na\nb\"c\"\nd\n"))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	report := importReport(t, w)
+	assert.Equal(t, 1, report.Imported)
+	assert.Len(t, report.Errors, 1)
+	assert.Equal(t, 3, report.Errors[0].Row)
+	assert.Len(t, db.Find("INSERT INTO `post`"), 1)
+}
+
+type testReport struct {
+	Total    int
+	Imported int
+	Errors   []struct{ Row int }
+}
+
+func importReport(t *testing.T, w *httptest.ResponseRecorder) *testReport {
+	result := &struct{ Data *testReport }{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), result))
+	return result.Data
+}
@@ -1,13 +1,14 @@
 package web
 
 import (
-	"fmt"
 	"html/template"
 	"strconv"
 	"strings"
 	"time"
 	//ginJson "github.com/gin-gonic/gin/json"
 	"encoding/json"
+
+	"github.com/sdjnlh/communal/log"
 )
 
 func Timing(t time.Time, format string) string {
@@ -85,7 +86,7 @@ var CommonFuncMap template.FuncMap
 
 func MergeFuncMap(fm template.FuncMap, fms ...template.FuncMap) {
 	if fm == nil {
-		fmt.Errorf("fail to merge FuncMap, nil target")
+		log.Logger.Warn("fail to merge FuncMap, nil target")
 		return
 	}
 
@@ -108,4 +109,6 @@ func init() {
 	CommonFuncMap["nn"] = notNil
 	CommonFuncMap["seq"] = StringEqual
 	CommonFuncMap["mpv"] = MapValue
+	CommonFuncMap["csrfField"] = csrfField
+	CommonFuncMap["csrfToken"] = csrfTokenOf
 }